@@ -0,0 +1,82 @@
+package folder
+
+import (
+	"full/libs/db"
+	"full/libs/models"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	flagCommand := &cobra.Command{
+		Use:   "edit",
+		Short: "Edit folder",
+		Long:  "Change the scan rules of a folder, the next scan applies them",
+		Run: func(cmd *cobra.Command, args []string) {
+			conn, err := db.Connect()
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+
+			id, err := cmd.Flags().GetString("filter-id")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			p, err := cmd.Flags().GetString("filter-path")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			if len(id) == 0 && len(p) == 0 {
+				log.Error().Msg("One of --filter-id or --filter-path is required")
+				return
+			}
+
+			folders, err := models.LoadFolders(conn, models.Folder{Id: id, Path: p})
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			switch len(folders) {
+			case 0:
+				log.Error().Str("id", id).Str("path", p).Msg("Cannot find folder")
+				return
+			case 1:
+			default:
+				log.Error().Str("id", id).Str("path", p).Msg("Found multiple folders")
+				return
+			}
+
+			var f = folders[0]
+			var rules = f.ScanRules()
+			rules.FolderId = f.Id
+			if err := applyRulesFlags(cmd, rules, true); err != nil {
+				log.Err(err).Send()
+				return
+			}
+			if err := rules.Save(conn); err != nil {
+				log.Err(err).Send()
+				return
+			}
+
+			log.Info().
+				Str("id", f.Id).
+				Str("path", f.Path).
+				Strs("include", rules.Include).
+				Strs("exclude", rules.Exclude).
+				Int("max-depth", rules.MaxDepth).
+				Bool("hidden", rules.IncludeHidden).
+				Bool("skip-symlinks", rules.SkipSymlinks).
+				Msg("Updated scan rules")
+		},
+	}
+
+	flagCommand.PersistentFlags().String("filter-id", "", "Filter by id")
+	flagCommand.PersistentFlags().String("filter-path", "", "Filter by path")
+	addRulesFlags(flagCommand)
+
+	FolderCmd.AddCommand(flagCommand)
+}
@@ -1,15 +1,18 @@
 package folder
 
 import (
+	"fmt"
 	"full/libs/db"
 	"full/libs/models"
+	"full/libs/scanner"
 	"full/libs/utils"
-	"time"
+	"os"
+	"os/signal"
+	"runtime"
 
 	"github.com/rs/zerolog/log"
 	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
-	"github.com/vansante/go-ffprobe"
 )
 
 func init() {
@@ -54,34 +57,49 @@ func init() {
 				return
 			}
 
-			if tx := conn.Create(newFolder); tx.Error != nil {
+			newFolder.Rules = &models.ScanRules{FolderId: newFolder.Id}
+			if err := applyRulesFlags(cmd, newFolder.Rules, false); err != nil {
 				log.Err(err).Send()
 				return
 			}
 
-			var videos = newFolder.GetVideos()
-			log.Info().Int("count", len(videos)).Msg("Collecting video informations")
-			bar := progressbar.Default(int64(len(videos)))
-			for _, v := range videos {
-				bar.Add(1)
-				data, err := ffprobe.GetProbeData(v.FilePath, 120000*time.Millisecond)
-				if err != nil {
-					log.Err(err).Str("file", v.FilePath).Str("id", v.Id).Send()
-					continue
-				}
-				v.Duration = data.Format.Duration()
+			if tx := conn.Create(newFolder); tx.Error != nil {
+				log.Err(tx.Error).Send()
+				return
+			}
+			if err := newFolder.Rules.Save(conn); err != nil {
+				log.Err(err).Send()
+				return
 			}
 
-			if tx := conn.CreateInBatches(videos, 100); tx.Error != nil {
-				log.Err(tx.Error).Send()
+			workers, err := cmd.Flags().GetInt("workers")
+			if err != nil {
+				log.Err(err).Send()
 				return
 			}
 
+			log.Info().Msg("Collecting video informations")
+			bar := progressbar.Default(-1, "Scanning")
+			var libScanner = scanner.New(conn, workers)
+			libScanner.OnProgress = func(progress scanner.Progress) {
+				bar.Describe(fmt.Sprintf("Scanning (seen: %d, probed: %d, failed: %d)", progress.Seen, progress.Probed, progress.Failed))
+				bar.Set64(progress.Probed + progress.Failed)
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+			if err := libScanner.Scan(ctx, *newFolder); err != nil {
+				log.Err(err).Send()
+			}
+			bar.Finish()
+
 			log.Info().Str("path", p).Send()
 		},
 	}
 
 	flagCommand.PersistentFlags().StringP("path", "p", "", "Folder path")
+	flagCommand.PersistentFlags().IntP("workers", "w", runtime.NumCPU(), "Number of files probed at the same time")
+	addRulesFlags(flagCommand)
 
 	FolderCmd.AddCommand(flagCommand)
 }
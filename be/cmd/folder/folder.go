@@ -1,6 +1,8 @@
 package folder
 
 import (
+	"full/libs/models"
+
 	"github.com/spf13/cobra"
 )
 
@@ -9,3 +11,56 @@ var FolderCmd = &cobra.Command{
 	Short: "Folder short",
 	Long:  "Folder long",
 }
+
+func addRulesFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringSlice("include", nil, "Glob patterns of the files to scan, all the files when empty")
+	cmd.PersistentFlags().StringSlice("exclude", models.DefaultExclude, "Glob patterns of the files and folders to skip")
+	cmd.PersistentFlags().Int("max-depth", 0, "Number of folder levels to scan, 0 means no limit")
+	cmd.PersistentFlags().Bool("hidden", false, "Scan hidden files and folders")
+	cmd.PersistentFlags().Bool("skip-symlinks", false, "Ignore symbolic links")
+}
+
+// applyRulesFlags copies the rule flags into rules, when onlyChanged is set
+// the flags not given by the user are ignored
+func applyRulesFlags(cmd *cobra.Command, rules *models.ScanRules, onlyChanged bool) error {
+	var use = func(name string) bool {
+		return !onlyChanged || cmd.Flags().Changed(name)
+	}
+
+	if use("include") {
+		include, err := cmd.Flags().GetStringSlice("include")
+		if err != nil {
+			return err
+		}
+		rules.Include = include
+	}
+	if use("exclude") {
+		exclude, err := cmd.Flags().GetStringSlice("exclude")
+		if err != nil {
+			return err
+		}
+		rules.Exclude = exclude
+	}
+	if use("max-depth") {
+		maxDepth, err := cmd.Flags().GetInt("max-depth")
+		if err != nil {
+			return err
+		}
+		rules.MaxDepth = maxDepth
+	}
+	if use("hidden") {
+		hidden, err := cmd.Flags().GetBool("hidden")
+		if err != nil {
+			return err
+		}
+		rules.IncludeHidden = hidden
+	}
+	if use("skip-symlinks") {
+		skipSymlinks, err := cmd.Flags().GetBool("skip-symlinks")
+		if err != nil {
+			return err
+		}
+		rules.SkipSymlinks = skipSymlinks
+	}
+	return rules.Validate()
+}
@@ -8,6 +8,7 @@ import (
 	"full/cmd/serve"
 	"full/cmd/user"
 	"full/cmd/video"
+	"full/libs/media"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -16,6 +17,22 @@ import (
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use: "full",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		for flagName, kind := range map[string]media.Kind{
+			"video-types":   media.KindVideo,
+			"picture-types": media.KindPicture,
+		} {
+			if !cmd.Flags().Changed(flagName) {
+				continue
+			}
+			exts, err := cmd.Flags().GetStringSlice(flagName)
+			if err != nil {
+				return err
+			}
+			media.Default.Accept(kind, exts...)
+		}
+		return nil
+	},
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
@@ -36,6 +53,8 @@ func init() {
 	// will be global for your application.
 
 	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.full.yaml)")
+	rootCmd.PersistentFlags().StringSlice("video-types", media.Default.Extensions(media.KindVideo), "Accepted video extensions")
+	rootCmd.PersistentFlags().StringSlice("picture-types", media.Default.Extensions(media.KindPicture), "Accepted picture extensions")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -3,9 +3,18 @@ package serve
 import (
 	"embed"
 	"fmt"
+	"full/libs/ffmpeg"
+	"full/libs/hls"
+	"full/libs/models"
 	"full/libs/routes"
+	"full/libs/signedurl"
+	"full/libs/throttle"
+	"full/libs/thumbnail"
+	"full/libs/trickplay"
+	"full/libs/watcher"
 	"net"
 	"net/http"
+	"runtime"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -22,6 +31,9 @@ var fsys embed.FS
 const (
 	default_IpAddress string = "0.0.0.0"
 	default_Port      int    = 6004
+
+	default_CacheDir      string = "cache"
+	default_UrlSecretFile string = "url-secret.key"
 )
 
 var (
@@ -29,6 +41,14 @@ var (
 		Name: "videoplayer_video_counter",
 		Help: "The total number of files visible within this service",
 	})
+	activeStreams = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "videoplayer_active_streams",
+		Help: "The number of video streams being served",
+	})
+	rejectedStreams = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "videoplayer_rejected_streams_total",
+		Help: "The number of video streams refused by the stream limits",
+	}, []string{"limit"})
 	ServeCmd = &cobra.Command{
 		Use:   "serve",
 		Short: "Serve",
@@ -44,9 +64,116 @@ var (
 				log.Err(err).Send()
 				return
 			}
+			watch, err := cmd.Flags().GetBool("watch")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			watchDebounce, err := cmd.Flags().GetDuration("watch-debounce")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			scanWorkers, err := cmd.Flags().GetInt("scan-workers")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			cacheDir, err := cmd.Flags().GetString("cache-dir")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			thumbnailWidth, err := cmd.Flags().GetInt("thumbnail-width")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			thumbnailPosition, err := cmd.Flags().GetString("thumbnail-position")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			trickplayInterval, err := cmd.Flags().GetDuration("trickplay-interval")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			trickplayWidth, err := cmd.Flags().GetInt("trickplay-width")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			hlsSegment, err := cmd.Flags().GetDuration("hls-segment")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			hlsIdleTimeout, err := cmd.Flags().GetDuration("hls-idle-timeout")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			hlsCacheSize, err := cmd.Flags().GetInt64("hls-cache-size")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			hlsLadder, err := cmd.Flags().GetString("hls-ladder")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			ladder, err := hls.ParseLadder(hlsLadder)
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			ffmpegPath, err := cmd.Flags().GetString("ffmpeg")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			ffmpeg.SetBinPath(ffmpegPath)
+			watchedThreshold, err := cmd.Flags().GetFloat64("watched-threshold")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			if err := models.SetWatchedThreshold(watchedThreshold); err != nil {
+				log.Err(err).Send()
+				return
+			}
+			maxStreamsPerUser, err := cmd.Flags().GetInt("max-streams-per-user")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			maxStreams, err := cmd.Flags().GetInt("max-streams")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			userBandwidth, err := cmd.Flags().GetInt64("user-bandwidth")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			urlSecretFile, err := cmd.Flags().GetString("url-secret-file")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			var urlSecret []byte
+			if len(urlSecretFile) > 0 {
+				if urlSecret, err = signedurl.LoadSecret(urlSecretFile); err != nil {
+					log.Err(err).Send()
+					return
+				}
+			}
 
 			cors := cors.New(cors.Options{
-				AllowedMethods: []string{http.MethodGet, http.MethodPost},
+				AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut},
 				AllowedOrigins: []string{
 					"http://localhost:3000",
 					"http://localhost:6004",
@@ -69,6 +196,33 @@ var (
 				OpenApiSpecEndpoint:   "/oapi/_specs",
 				OpenApiSpecFullUrl:    fmt.Sprintf("http://%s/oapi/_specs", server.Addr),
 				OpenApiScalarEndpoint: "/oapi/scalar",
+
+				EnableWatcher:   watch,
+				WatcherDebounce: watchDebounce,
+
+				ScanWorkers: scanWorkers,
+
+				CacheDir:          cacheDir,
+				ThumbnailWidth:    thumbnailWidth,
+				ThumbnailPosition: thumbnailPosition,
+
+				TrickplayInterval: trickplayInterval,
+				TrickplayWidth:    trickplayWidth,
+
+				HlsSegmentDuration: hlsSegment,
+				HlsIdleTimeout:     hlsIdleTimeout,
+				HlsCacheSize:       hlsCacheSize << 20,
+				HlsLadder:          ladder,
+
+				Streams: throttle.Config{
+					MaxPerUser:    maxStreamsPerUser,
+					MaxTotal:      maxStreams,
+					UserBandwidth: userBandwidth * 1000 / 8,
+					Active:        activeStreams,
+					Rejected:      rejectedStreams,
+				},
+
+				UrlSecret: urlSecret,
 			})
 			routes.WebServer.Handle("/metrics", promhttp.Handler())
 
@@ -84,4 +238,22 @@ func init() {
 
 	ServeCmd.PersistentFlags().IPP("address", "a", net.ParseIP(default_IpAddress), "Host")
 	ServeCmd.PersistentFlags().IntP("port", "p", default_Port, "Port")
+	ServeCmd.PersistentFlags().BoolP("watch", "w", true, "Watch the registered folders for changes")
+	ServeCmd.PersistentFlags().Int("scan-workers", runtime.NumCPU(), "Number of files probed at the same time while scanning")
+	ServeCmd.PersistentFlags().Duration("watch-debounce", watcher.DefaultDebounce, "Quiet period before a changed file is processed")
+	ServeCmd.PersistentFlags().String("ffmpeg", ffmpeg.BinPath(), "Path of the ffmpeg executable")
+	ServeCmd.PersistentFlags().String("cache-dir", default_CacheDir, "Folder for the generated files (thumbnails, previews, ...)")
+	ServeCmd.PersistentFlags().Int("thumbnail-width", thumbnail.DefaultWidth, "Width of the generated thumbnails")
+	ServeCmd.PersistentFlags().String("thumbnail-position", thumbnail.DefaultPosition, "Position of the thumbnail frame, a percentage (10%) or a duration (1m30s)")
+	ServeCmd.PersistentFlags().Duration("trickplay-interval", trickplay.DefaultInterval, "Time between two frames of the seek previews, 0 disables them")
+	ServeCmd.PersistentFlags().Int("trickplay-width", trickplay.DefaultWidth, "Width of a single frame of the seek previews")
+	ServeCmd.PersistentFlags().Duration("hls-segment", hls.DefaultSegmentDuration, "Duration of a single HLS segment")
+	ServeCmd.PersistentFlags().Duration("hls-idle-timeout", hls.DefaultIdleTimeout, "Time without requests after which an HLS transcoder is stopped")
+	ServeCmd.PersistentFlags().Int64("hls-cache-size", hls.DefaultCacheSize>>20, "Maximum size of the cached HLS segments (MB)")
+	ServeCmd.PersistentFlags().String("hls-ladder", hls.DefaultLadder, "HLS renditions offered next to the source, like 720p:2800k,480p:1200k. Empty disables them")
+	ServeCmd.PersistentFlags().Float64("watched-threshold", models.DefaultWatchedThreshold, "Part of a video to play before it counts as watched, between 0 and 1")
+	ServeCmd.PersistentFlags().Int("max-streams-per-user", 0, "Number of videos a single user can stream at the same time, 0 disables the limit")
+	ServeCmd.PersistentFlags().Int("max-streams", 0, "Number of videos streamed at the same time, 0 disables the limit")
+	ServeCmd.PersistentFlags().Int64("user-bandwidth", 0, "Maximum bandwidth of the streams of a single user (kbit/s), 0 disables the limit")
+	ServeCmd.PersistentFlags().String("url-secret-file", default_UrlSecretFile, "File with the secret signing the stream urls, it is generated when missing. Replace it to revoke every signed url, empty disables them")
 }
@@ -24,8 +24,6 @@ func init() {
 				return
 			}
 
-			_ = conn
-
 			var (
 				asker        = utils.AskUserPromptWithValidator(cmd)
 				askerOptions = utils.AskUserForOptions(cmd)
@@ -69,6 +67,7 @@ func init() {
 				return
 			}
 
+			var selected models.Video
 			switch options[idx] {
 			case "id":
 				id, err := asker("id", "Id", validateId)
@@ -77,6 +76,10 @@ func init() {
 					return
 				}
 				log.Info().Str("Id", id).Send()
+				if tx := conn.First(&selected, models.Video{Id: id}); tx.Error != nil {
+					log.Err(tx.Error).Send()
+					return
+				}
 			case "filepath":
 				var videos []models.Video
 				if tx := conn.Find(&videos); tx.Error != nil {
@@ -105,6 +108,22 @@ func init() {
 					return
 				}
 				log.Info().Any("selected", videos[idx]).Send()
+				selected = videos[idx]
+			}
+
+			removeFile, err := cmd.Flags().GetBool("remove-file")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+
+			confirm := utils.AskUserYN(cmd)
+			if !confirm("confirm", fmt.Sprintf("Are you sure to delete `%s`", selected.FilePath)) {
+				log.Info().Msg("Aborted")
+				return
+			}
+			if err := selected.Delete(conn, removeFile); err != nil {
+				log.Err(err).Send()
 			}
 		},
 	}
@@ -112,6 +131,8 @@ func init() {
 	flagCommand.PersistentFlags().String("id", "", "Video id")
 	flagCommand.PersistentFlags().StringP("filepath", "f", "", "File path")
 	flagCommand.PersistentFlags().StringP("filter-flag", "m", "", "Filter flag")
+	flagCommand.PersistentFlags().Bool("remove-file", false, "Delete the file from the disk too")
+	flagCommand.PersistentFlags().BoolP("confirm", "y", false, "Delete without prompt")
 
 	VideoCmd.AddCommand(flagCommand)
 }
@@ -0,0 +1,110 @@
+package video
+
+import (
+	"fmt"
+	"full/libs/db"
+	"full/libs/models"
+	"full/libs/utils"
+
+	"github.com/manifoldco/promptui"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	flagCommand := &cobra.Command{
+		Use:   "duplicates",
+		Short: "Find duplicated videos",
+		Long:  "List the videos with the same size, duration and content, then choose the copy to keep. Without --remove-files the deleted copies are found again by the next scan",
+		Run: func(cmd *cobra.Command, args []string) {
+			conn, err := db.Connect()
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+
+			groups, err := models.FindDuplicates(conn.WithContext(cmd.Context()))
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			if len(groups) == 0 {
+				log.Info().Msg("Cannot find duplicated videos")
+				return
+			}
+
+			var wasted int64
+			for idx, g := range groups {
+				wasted += g.Wasted
+				fmt.Printf("%d) %s x%d, wasted %s\n", idx+1, utils.FormatSize(g.Size), len(g.Videos), utils.FormatSize(g.Wasted))
+				for _, v := range g.Videos {
+					fmt.Printf("\t%s %s\n", v.Id, v.FilePath)
+				}
+			}
+			fmt.Printf("Wasted space: %s in %d groups\n", utils.FormatSize(wasted), len(groups))
+
+			listOnly, err := cmd.Flags().GetBool("list")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			removeFiles, err := cmd.Flags().GetBool("remove-files")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			if listOnly {
+				return
+			}
+			// The copies left on the disk would be added back by the next scan
+			if !removeFiles {
+				log.Error().Msg("The copies can be deleted only with their files, use --remove-files or --list")
+				return
+			}
+
+			confirm := utils.AskUserYN(cmd)
+			for idx, g := range groups {
+				var selector = promptui.Select{
+					Label: fmt.Sprintf("Group %d/%d, choose the copy to keep", idx+1, len(groups)),
+					Items: append(g.Videos, models.Video{Title: "Skip"}),
+					Size:  10,
+					Templates: &promptui.SelectTemplates{
+						Label:    "{{ . }}",
+						Active:   "• {{ if .FilePath }}{{ .FilePath | yellow }}{{ else }}{{ .Title | yellow }}{{ end }}",
+						Inactive: "  {{ if .FilePath }}{{ .FilePath }}{{ else }}{{ .Title }}{{ end }}",
+						Selected: "• {{ if .FilePath }}{{ .FilePath | green }}{{ else }}{{ .Title | green }}{{ end }}",
+					},
+				}
+				choice, _, err := selector.Run()
+				if err != nil {
+					log.Err(err).Send()
+					return
+				}
+				if choice >= len(g.Videos) {
+					continue
+				}
+
+				others, err := g.Others(g.Videos[choice].Id)
+				if err != nil {
+					log.Err(err).Send()
+					continue
+				}
+				if !confirm("confirm", fmt.Sprintf("Are you sure to delete %d videos and their files (%s)", len(others), utils.FormatSize(g.Wasted))) {
+					log.Info().Msg("Skipped")
+					continue
+				}
+				for _, v := range others {
+					if err := v.Delete(conn.WithContext(cmd.Context()), removeFiles); err != nil {
+						log.Err(err).Send()
+					}
+				}
+			}
+		},
+	}
+
+	flagCommand.PersistentFlags().BoolP("list", "l", false, "Only list the duplicated videos")
+	flagCommand.PersistentFlags().Bool("remove-files", false, "Delete the removed copies together with their files, required unless listing")
+	flagCommand.PersistentFlags().BoolP("confirm", "y", false, "Delete without prompt")
+
+	VideoCmd.AddCommand(flagCommand)
+}
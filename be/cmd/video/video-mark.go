@@ -0,0 +1,80 @@
+package video
+
+import (
+	"fmt"
+	"full/libs/db"
+	"full/libs/models"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	flagCommand := &cobra.Command{
+		Use:   "mark [id or file path]...",
+		Short: "Mark videos as watched",
+		Long:  "Mark videos as watched or not, for a single user too when it is given",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			conn, err := db.Connect()
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+
+			unwatched, err := cmd.Flags().GetBool("unwatched")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			userFilter, err := cmd.Flags().GetString("user")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+
+			var user *models.User
+			if len(userFilter) > 0 {
+				var users []models.User
+				if tx := conn.Where("id = ? OR username = ? OR email = ?", userFilter, userFilter, userFilter).Find(&users); tx.Error != nil {
+					log.Err(tx.Error).Send()
+					return
+				}
+				if len(users) != 1 {
+					log.Error().Str("user", userFilter).Int("found", len(users)).Msg("Cannot find a single user")
+					return
+				}
+				user = &users[0]
+			}
+
+			for _, arg := range args {
+				var vids []models.Video
+				if tx := conn.Where("id = ? OR file_path = ?", arg, arg).Find(&vids); tx.Error != nil {
+					log.Err(tx.Error).Send()
+					return
+				}
+				if len(vids) != 1 {
+					log.Err(fmt.Errorf("cannot find a single video with id or file path `%s`", arg)).Int("found", len(vids)).Send()
+					continue
+				}
+				// The command line is an administrator action, the flag shared by every user changes
+				if err := vids[0].SetWatched(conn, !unwatched); err != nil {
+					log.Err(err).Str("id", vids[0].Id).Send()
+					continue
+				}
+				if user != nil {
+					if _, err := models.MarkWatched(conn, &vids[0], user, !unwatched); err != nil {
+						log.Err(err).Str("id", vids[0].Id).Send()
+						continue
+					}
+				}
+				log.Info().Str("id", vids[0].Id).Str("filePath", vids[0].FilePath).Bool("watched", !unwatched).Msg("Marked video")
+			}
+		},
+	}
+
+	flagCommand.PersistentFlags().Bool("unwatched", false, "Mark the videos as not watched, the progress of the user goes back to the start")
+	flagCommand.PersistentFlags().StringP("user", "u", "", "Id, username or email of the user to mark the videos for")
+
+	VideoCmd.AddCommand(flagCommand)
+}
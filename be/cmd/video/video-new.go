@@ -3,10 +3,12 @@ package video
 import (
 	"fmt"
 	"full/libs/db"
+	"full/libs/media"
 	"full/libs/models"
 	"full/libs/utils"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
@@ -33,8 +35,8 @@ func init() {
 					}
 				}
 
-				if filepath.Ext(file) != ".mp4" {
-					return fmt.Errorf("`%s` is not a .mp4 file", file)
+				if !media.IsVideo(file) {
+					return fmt.Errorf("`%s` is not a supported video file (%s)", file, strings.Join(media.Default.Extensions(media.KindVideo), ", "))
 				}
 				return nil
 			}
@@ -67,11 +69,15 @@ func init() {
 			} else {
 				video.Size = stats.Size()
 			}
+			if err = video.GenerateFingerprint(); err != nil {
+				log.Err(err).Send()
+			}
 
 			base, file := filepath.Split(video.FilePath)
 			video.Title = file
 			video.Folder = models.NewFolder(base)
 			video.GenerateId()
+			video.LinkStreams()
 			video.Attributes.Watched = askerConfirm("watched", "Watched")
 
 			var folder models.Folder
@@ -0,0 +1,93 @@
+package video
+
+import (
+	"fmt"
+	"full/libs/db"
+	"full/libs/models"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	flagCommand := &cobra.Command{
+		Use:   "tag [id or file path]...",
+		Short: "Change the tags of videos",
+		Long:  "Add and remove tags of videos, without flags the current tags are shown",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			conn, err := db.Connect()
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+
+			add, err := cmd.Flags().GetStringSlice("add")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			remove, err := cmd.Flags().GetStringSlice("remove")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+			replace, err := cmd.Flags().GetBool("replace")
+			if err != nil {
+				log.Err(err).Send()
+				return
+			}
+
+			for _, arg := range args {
+				var vids []models.Video
+				if tx := conn.Where("id = ? OR file_path = ?", arg, arg).Find(&vids); tx.Error != nil {
+					log.Err(tx.Error).Send()
+					return
+				}
+				if len(vids) != 1 {
+					log.Err(fmt.Errorf("cannot find a single video with id or file path `%s`", arg)).Int("found", len(vids)).Send()
+					continue
+				}
+				var v = &vids[0]
+				if err := v.LoadTags(conn); err != nil {
+					log.Err(err).Str("id", v.Id).Send()
+					continue
+				}
+
+				var changes = []struct {
+					change models.TagChange
+					names  []string
+				}{{models.TagsAdd, add}, {models.TagsRemove, remove}}
+				if replace {
+					changes[0].change = models.TagsReplace
+				}
+				var failed bool
+				for _, c := range changes {
+					if len(c.names) == 0 && c.change != models.TagsReplace {
+						continue
+					}
+					if err := v.ChangeTags(conn, c.change, c.names); err != nil {
+						log.Err(err).Str("id", v.Id).Send()
+						failed = true
+						break
+					}
+				}
+				if failed {
+					continue
+				}
+
+				var names = make([]string, 0, len(v.Tags))
+				for _, t := range v.Tags {
+					names = append(names, t.Name)
+				}
+				log.Info().Str("id", v.Id).Str("filePath", v.FilePath).Strs("tags", names).Msg("Video tags")
+			}
+		},
+	}
+
+	flagCommand.PersistentFlags().StringSliceP("add", "a", []string{}, "Tags to add, comma separated or repeated")
+	flagCommand.PersistentFlags().StringSliceP("remove", "r", []string{}, "Tags to remove, comma separated or repeated")
+	flagCommand.PersistentFlags().Bool("replace", false, "Replace the current tags with the added ones, no tag added clears them")
+
+	VideoCmd.AddCommand(flagCommand)
+}
@@ -3,6 +3,9 @@ module full
 go 1.24.0
 
 require (
+	dario.cat/mergo v1.0.2
+	github.com/MarceloPetrucio/go-scalar-api-reference v0.0.0-20240521013641-ce5d2efe0e06
+	github.com/fsnotify/fsnotify v1.9.0
 	github.com/graphql-go/graphql v0.8.1
 	github.com/manifoldco/promptui v0.9.0
 	github.com/prometheus/client_golang v1.22.0
@@ -14,8 +17,6 @@ require (
 )
 
 require (
-	dario.cat/mergo v1.0.2 // indirect
-	github.com/MarceloPetrucio/go-scalar-api-reference v0.0.0-20240521013641-ce5d2efe0e06 // indirect
 	github.com/beorn7/perks v1.0.1 // indirect
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
 	github.com/chzyer/readline v0.0.0-20180603132655-2972be24d48e // indirect
@@ -0,0 +1,45 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+var binPath = "ffmpeg"
+
+func SetBinPath(newBinPath string) {
+	binPath = newBinPath
+}
+
+func BinPath() string {
+	return binPath
+}
+
+// Command returns an ffmpeg command that is killed as soon as ctx is done,
+// the common flags to keep the output quiet are always prepended
+func Command(ctx context.Context, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, binPath, append([]string{"-hide_banner", "-loglevel", "error", "-nostdin"}, args...)...)
+}
+
+// Run executes ffmpeg and returns its stderr as error when it fails
+func Run(ctx context.Context, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := Command(ctx, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); len(msg) > 0 {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// Timestamp formats a duration the way ffmpeg expects it for -ss and -t
+func Timestamp(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
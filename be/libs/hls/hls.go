@@ -0,0 +1,385 @@
+package hls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"full/libs/ffmpeg"
+	"full/libs/models"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultSegmentDuration time.Duration = time.Second * 6
+	DefaultIdleTimeout     time.Duration = time.Second * 30
+	DefaultCacheSize       int64         = 5 << 30
+
+	// ffmpeg is stopped when it is this many segments ahead of the viewer
+	maxAhead int = 20
+	// A segment not generated yet is waited when it is at most this many
+	// segments after the last one produced, otherwise ffmpeg is restarted there
+	maxWaitAhead int = 3
+
+	segmentTimeout time.Duration = time.Second * 30
+	janitorTick    time.Duration = time.Second * 10
+	pollInterval   time.Duration = time.Millisecond * 200
+)
+
+var ErrSegmentNotFound = errors.New("segment out of range")
+
+type Config struct {
+	Dir             string
+	SegmentDuration time.Duration
+	IdleTimeout     time.Duration
+	// CacheSize is the maximum number of bytes of segments kept on disk
+	CacheSize int64
+	// Ladder are the renditions offered next to the source
+	Ladder []Variant
+}
+
+// Manager runs an ffmpeg process for every video being watched and keeps the
+// produced segments in a bounded on-disk cache
+type Manager struct {
+	cfg      Config
+	sessions map[string]*session
+	mut      sync.Mutex
+}
+
+func New(cfg Config) (*Manager, error) {
+	if cfg.SegmentDuration < time.Second {
+		cfg.SegmentDuration = DefaultSegmentDuration
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = DefaultIdleTimeout
+	}
+	if cfg.CacheSize <= 0 {
+		cfg.CacheSize = DefaultCacheSize
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	m := &Manager{cfg: cfg, sessions: map[string]*session{}}
+	go m.janitor()
+	return m, nil
+}
+
+func (m *Manager) SegmentDuration() time.Duration {
+	return m.cfg.SegmentDuration
+}
+
+// session is a video encoded with a variant, at most one ffmpeg process runs for it
+type session struct {
+	video   models.Video
+	variant Variant
+	dir     string
+
+	cmd         *exec.Cmd
+	cancel      context.CancelFunc
+	process     *process
+	start       int
+	lastRequest int
+	mut         sync.Mutex
+
+	// lastAccessed is guarded by the lock of the manager
+	lastAccessed time.Time
+}
+
+// process is a single run of ffmpeg, err is set before done is closed so it
+// is read without the lock of the session once done is closed
+type process struct {
+	done chan struct{}
+	err  error
+}
+
+func (m *Manager) session(v *models.Video, variant Variant) *session {
+	var key = v.Id + "/" + variant.Id()
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	s, ok := m.sessions[key]
+	if !ok {
+		s = &session{
+			video:   *v,
+			variant: variant,
+			dir:     filepath.Join(m.cfg.Dir, v.Id, variant.Id()),
+		}
+		m.sessions[key] = s
+	}
+	s.lastAccessed = time.Now()
+	return s
+}
+
+// Segments returns the number of segments of the video
+func (m *Manager) Segments(v *models.Video) int {
+	var count = int(v.Duration / m.cfg.SegmentDuration)
+	if v.Duration%m.cfg.SegmentDuration > 0 {
+		count++
+	}
+	return count
+}
+
+// Segment returns the path of the segment, generating it when needed.
+// A segment far from the running process restarts ffmpeg from there
+func (m *Manager) Segment(ctx context.Context, v *models.Video, variant Variant, index int) (string, error) {
+	if index < 0 || index >= m.Segments(v) {
+		return "", ErrSegmentNotFound
+	}
+
+	var s = m.session(v, variant)
+	var file = s.segmentPath(index)
+
+	s.mut.Lock()
+	s.lastRequest = index
+	if exists(file) {
+		s.mut.Unlock()
+		return file, nil
+	}
+	if !s.running() || index < s.start || index > s.produced()+maxWaitAhead {
+		if err := m.startLocked(s, index); err != nil {
+			s.mut.Unlock()
+			return "", err
+		}
+	}
+	var p = s.process
+	s.mut.Unlock()
+
+	var timeout = time.NewTimer(segmentTimeout)
+	defer timeout.Stop()
+	var ticker = time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		if exists(file) {
+			return file, nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-timeout.C:
+			return "", fmt.Errorf("timeout waiting for segment %d of video id=`%s`", index, v.Id)
+		case <-p.done:
+			if exists(file) {
+				return file, nil
+			}
+			var err = p.err
+			if err == nil {
+				err = fmt.Errorf("ffmpeg exited before segment %d of video id=`%s`", index, v.Id)
+			}
+			return "", err
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *session) segmentPath(index int) string {
+	return filepath.Join(s.dir, strconv.Itoa(index)+".ts")
+}
+
+func (s *session) running() bool {
+	if s.process == nil {
+		return false
+	}
+	select {
+	case <-s.process.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// produced returns the index of the last segment written by the running process
+func (s *session) produced() int {
+	var last = s.start - 1
+	for exists(s.segmentPath(last + 1)) {
+		last++
+	}
+	return last
+}
+
+// startLocked replaces the running process with one starting at the given
+// segment, s.mut must be held
+func (m *Manager) startLocked(s *session, index int) error {
+	s.stopLocked()
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var cmd = ffmpeg.Command(ctx, s.variant.args(&s.video, s.dir, index, m.cfg.SegmentDuration)...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return err
+	}
+	log.Info().Str("id", s.video.Id).Str("variant", s.variant.Id()).Int("segment", index).Msg("Started HLS transcoder")
+
+	// The process never takes s.mut, stopLocked waits for it while holding the lock
+	var p = &process{done: make(chan struct{})}
+	s.cmd, s.cancel, s.process, s.start = cmd, cancel, p, index
+	go func() {
+		err := cmd.Wait()
+		if ctx.Err() == nil && err != nil {
+			log.Err(err).Str("id", s.video.Id).Str("stderr", strings.TrimSpace(stderr.String())).Msg("HLS transcoder failed")
+			p.err = fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		close(p.done)
+	}()
+	return nil
+}
+
+// stopLocked kills the running process, s.mut must be held
+func (s *session) stopLocked() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	if s.process != nil {
+		<-s.process.done
+	}
+	s.cancel = nil
+	s.cmd = nil
+	// Partial segments are written as temporary files
+	if tmp, err := filepath.Glob(filepath.Join(s.dir, "*.tmp")); err == nil {
+		for _, f := range tmp {
+			os.Remove(f)
+		}
+	}
+}
+
+// takeSessions removes from the manager the sessions matching fn and returns
+// them together with the ones left. The sessions are stopped by the caller
+// without m.mut, a process slow to exit must not block the other viewers
+func (m *Manager) takeSessions(fn func(s *session) bool) (taken []*session, left []*session) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	for key, s := range m.sessions {
+		if fn(s) {
+			taken = append(taken, s)
+			delete(m.sessions, key)
+		} else {
+			left = append(left, s)
+		}
+	}
+	return taken, left
+}
+
+func (s *session) stop() {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.stopLocked()
+}
+
+// Close stops every ffmpeg process
+func (m *Manager) Close() {
+	taken, _ := m.takeSessions(func(*session) bool { return true })
+	for _, s := range taken {
+		s.stop()
+	}
+}
+
+// janitor stops the processes nobody is watching or that are too far ahead
+// and keeps the cache under its size
+func (m *Manager) janitor() {
+	for range time.Tick(janitorTick) {
+		idle, active := m.takeSessions(func(s *session) bool {
+			return time.Since(s.lastAccessed) > m.cfg.IdleTimeout
+		})
+		for _, s := range idle {
+			s.mut.Lock()
+			if s.running() {
+				log.Info().Str("id", s.video.Id).Str("variant", s.variant.Id()).Msg("Stopped idle HLS transcoder")
+			}
+			s.stopLocked()
+			s.mut.Unlock()
+		}
+		for _, s := range active {
+			s.mut.Lock()
+			if s.running() && s.produced() >= s.lastRequest+maxAhead {
+				s.stopLocked()
+			}
+			s.mut.Unlock()
+		}
+
+		if err := m.evict(); err != nil {
+			log.Err(err).Msg("Cannot clean the HLS cache")
+		}
+	}
+}
+
+type cachedFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// evict removes the oldest segments until the cache fits its size,
+// the segments just requested by a viewer are kept
+func (m *Manager) evict() error {
+	var files []cachedFile
+	var total int64
+	err := filepath.WalkDir(m.cfg.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(p) != ".ts" {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, cachedFile{path: p, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil || total <= m.cfg.CacheSize {
+		return err
+	}
+
+	var protected = map[string]bool{}
+	_, sessions := m.takeSessions(func(*session) bool { return false })
+	for _, s := range sessions {
+		s.mut.Lock()
+		for idx := max(s.lastRequest-1, 0); idx <= s.lastRequest+maxWaitAhead; idx++ {
+			protected[s.segmentPath(idx)] = true
+		}
+		s.mut.Unlock()
+	}
+
+	slices.SortFunc(files, func(a, b cachedFile) int { return a.modTime.Compare(b.modTime) })
+	for _, f := range files {
+		if total <= m.cfg.CacheSize {
+			break
+		}
+		if protected[f.path] {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Err(err).Send()
+			continue
+		}
+		total -= f.size
+	}
+	return nil
+}
+
+// Remove deletes the cached segments of the video
+func (m *Manager) Remove(videoId string) error {
+	taken, _ := m.takeSessions(func(s *session) bool { return s.video.Id == videoId })
+	for _, s := range taken {
+		s.stop()
+	}
+	return os.RemoveAll(filepath.Join(m.cfg.Dir, videoId))
+}
+
+func exists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
@@ -0,0 +1,131 @@
+package hls
+
+import (
+	"cmp"
+	"fmt"
+	"full/libs/models"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultLadder are the renditions offered next to the source, see ParseLadder
+const DefaultLadder string = "1080p:5000k,720p:2800k,480p:1200k"
+
+// ParseLadder reads a comma separated list of renditions like "720p:2800k",
+// the bit rate accepts the k and M suffixes. An empty string means no renditions
+func ParseLadder(s string) ([]Variant, error) {
+	var out []Variant
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		quality, rate, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid rendition `%s`, expected a value like 720p:2800k", item)
+		}
+		height, err := ParseQuality(quality)
+		if err != nil || height == 0 {
+			return nil, fmt.Errorf("invalid rendition `%s`, cannot read the height", item)
+		}
+		bitrate, err := parseBitrate(rate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rendition `%s`: %w", item, err)
+		}
+		if slices.ContainsFunc(out, func(vr Variant) bool { return vr.Height == height }) {
+			return nil, fmt.Errorf("rendition %dp is repeated", height)
+		}
+		out = append(out, Variant{Name: fmt.Sprintf("%dp", height), Height: height, VideoBitrate: bitrate})
+	}
+	slices.SortFunc(out, func(a, b Variant) int { return cmp.Compare(b.Height, a.Height) })
+	return out, nil
+}
+
+// ParseQuality reads a height like "720p" or "720", an empty string is 0 (no limit)
+func ParseQuality(s string) (int, error) {
+	s = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "p")
+	if len(s) == 0 {
+		return 0, nil
+	}
+	height, err := strconv.Atoi(s)
+	if err != nil || height < 0 {
+		return 0, fmt.Errorf("invalid quality `%s`, expected a height like 720p", s)
+	}
+	return height, nil
+}
+
+func parseBitrate(s string) (int64, error) {
+	var multiplier int64 = 1
+	switch {
+	case strings.HasSuffix(s, "k"), strings.HasSuffix(s, "K"):
+		multiplier, s = 1_000, s[:len(s)-1]
+	case strings.HasSuffix(s, "M"), strings.HasSuffix(s, "m"):
+		multiplier, s = 1_000_000, s[:len(s)-1]
+	}
+	value, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid bit rate `%s`", s)
+	}
+	return value * multiplier, nil
+}
+
+// Variants returns the variants offered for the video, highest first: the source
+// and the renditions not above its resolution. When maxHeight is set the higher
+// ones are dropped, the lowest variant is kept anyway
+func (m *Manager) Variants(v *models.Video, maxHeight int) []Variant {
+	var out = []Variant{SourceVariant}
+	var sourceHeight int
+	if s := v.MainVideoStream(); s != nil {
+		sourceHeight = s.Height
+	}
+	// Without the source resolution the renditions could upscale the video
+	if sourceHeight > 0 {
+		for _, vr := range m.cfg.Ladder {
+			if vr.Height <= sourceHeight {
+				out = append(out, vr)
+			}
+		}
+	}
+	if maxHeight <= 0 {
+		return out
+	}
+
+	var allowed []Variant
+	for _, vr := range out {
+		var height = vr.Height
+		if height == 0 {
+			height = sourceHeight
+		}
+		if height <= maxHeight {
+			allowed = append(allowed, vr)
+		}
+	}
+	if len(allowed) == 0 {
+		return out[len(out)-1:]
+	}
+	return allowed
+}
+
+// Variant finds an offered variant of the video by id, the name optionally
+// followed by the index of the audio track. maxHeight is applied like in Variants
+func (m *Manager) Variant(v *models.Video, id string, maxHeight int) (Variant, bool) {
+	var name, audio, withAudio = strings.Cut(id, audioSeparator)
+	var variants = m.Variants(v, maxHeight)
+	idx := slices.IndexFunc(variants, func(vr Variant) bool { return vr.Name == name })
+	if idx < 0 {
+		return Variant{}, false
+	}
+	if !withAudio {
+		return variants[idx], true
+	}
+	index, err := strconv.Atoi(audio)
+	if err != nil {
+		return Variant{}, false
+	}
+	var s = v.AudioStream(index)
+	if s == nil {
+		return Variant{}, false
+	}
+	return variants[idx].WithAudio(s), true
+}
@@ -0,0 +1,103 @@
+package hls
+
+import (
+	"full/libs/models"
+	"slices"
+	"testing"
+)
+
+func TestParseLadder(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   string
+		want    []Variant
+		wantErr bool
+	}{
+		{name: "empty", input: "", want: nil},
+		{name: "only separators", input: " , ,", want: nil},
+		{
+			name:  "default",
+			input: DefaultLadder,
+			want: []Variant{
+				{Name: "1080p", Height: 1080, VideoBitrate: 5_000_000},
+				{Name: "720p", Height: 720, VideoBitrate: 2_800_000},
+				{Name: "480p", Height: 480, VideoBitrate: 1_200_000},
+			},
+		},
+		{
+			name:  "sorted highest first",
+			input: "480p:1200k, 1080:5M",
+			want: []Variant{
+				{Name: "1080p", Height: 1080, VideoBitrate: 5_000_000},
+				{Name: "480p", Height: 480, VideoBitrate: 1_200_000},
+			},
+		},
+		{
+			name:  "suffixes and plain bit rate",
+			input: "720P:2800K,360p:1m,240p:300000",
+			want: []Variant{
+				{Name: "720p", Height: 720, VideoBitrate: 2_800_000},
+				{Name: "360p", Height: 360, VideoBitrate: 1_000_000},
+				{Name: "240p", Height: 240, VideoBitrate: 300_000},
+			},
+		},
+		{name: "missing bit rate", input: "720p", wantErr: true},
+		{name: "empty bit rate", input: "720p:", wantErr: true},
+		{name: "zero bit rate", input: "720p:0k", wantErr: true},
+		{name: "negative bit rate", input: "720p:-5k", wantErr: true},
+		{name: "invalid bit rate", input: "720p:fast", wantErr: true},
+		{name: "missing height", input: ":2800k", wantErr: true},
+		{name: "zero height", input: "0p:2800k", wantErr: true},
+		{name: "invalid height", input: "hd:2800k", wantErr: true},
+		{name: "repeated height", input: "720p:2800k,720:1M", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLadder(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLadder(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParseLadder(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManagerVariant(t *testing.T) {
+	var ladder, err = ParseLadder(DefaultLadder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m = Manager{cfg: Config{Ladder: ladder}}
+	var video = &models.Video{Streams: []models.VideoStream{
+		{Index: 0, Type: models.StreamTypeVideo, Codec: "h264", Height: 1080},
+		{Index: 1, Type: models.StreamTypeAudio, Codec: "aac"},
+	}}
+
+	var tests = []struct {
+		name      string
+		id        string
+		maxHeight int
+		want      string
+		wantOk    bool
+	}{
+		{name: "source", id: "source", want: "source", wantOk: true},
+		{name: "rendition", id: "720p", want: "720p", wantOk: true},
+		{name: "with audio", id: "720p" + audioSeparator + "1", want: "720p", wantOk: true},
+		{name: "unknown audio", id: "720p" + audioSeparator + "5", wantOk: false},
+		{name: "unknown variant", id: "240p", wantOk: false},
+		{name: "below the limit", id: "480p", maxHeight: 720, want: "480p", wantOk: true},
+		{name: "at the limit", id: "720p", maxHeight: 720, want: "720p", wantOk: true},
+		{name: "above the limit", id: "1080p", maxHeight: 720, wantOk: false},
+		{name: "source above the limit", id: "source", maxHeight: 720, wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := m.Variant(video, tt.id, tt.maxHeight)
+			if ok != tt.wantOk || got.Name != tt.want {
+				t.Errorf("Variant(%q, %d) = %q %v, want %q %v", tt.id, tt.maxHeight, got.Name, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package hls
+
+import (
+	"fmt"
+	"full/libs/ffmpeg"
+	"full/libs/models"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Variant describes how the segments of a video are produced
+type Variant struct {
+	Name string `json:"name"`
+	// Height of the output, 0 keeps the source resolution
+	Height int `json:"height,omitempty"`
+	// VideoBitrate is the target bit rate (bit/s) when transcoding, 0 uses a constant quality
+	VideoBitrate int64 `json:"videoBitrate,omitempty"`
+	// Audio is the only audio track of the segments, nil keeps the main one
+	Audio *models.VideoStream `json:"-"`
+}
+
+// audioSeparator splits the name of the variant from the audio track in the id, like 720p-a2
+const audioSeparator string = "-a"
+
+// WithAudio returns the variant delivering only the given audio track
+func (vr Variant) WithAudio(s *models.VideoStream) Variant {
+	vr.Audio = s
+	return vr
+}
+
+// Id names the variant in the urls and in the cache, the audio track is part of it
+func (vr Variant) Id() string {
+	if vr.Audio == nil {
+		return vr.Name
+	}
+	return fmt.Sprintf("%s%s%d", vr.Name, audioSeparator, vr.Audio.Index)
+}
+
+func (vr Variant) audio(v *models.Video) *models.VideoStream {
+	if vr.Audio != nil {
+		return vr.Audio
+	}
+	return v.MainAudioStream()
+}
+
+// SourceVariant keeps the resolution of the file, the audio already playable
+// by browsers is copied without transcoding
+var SourceVariant = Variant{Name: "source"}
+
+// Browsers play aac (or mp3) inside MPEG-TS segments. The video is always
+// transcoded: the key frames of a copied stream do not fall on the segment
+// boundaries announced by the playlist
+var copyAudioCodecs = []string{"aac", "mp3"}
+
+const (
+	transcodeVideoCodecs string = "avc1.640028"
+	transcodeAudioCodecs string = "mp4a.40.2"
+)
+
+func (vr Variant) copyAudio(v *models.Video) bool {
+	var s = vr.audio(v)
+	return s != nil && slices.Contains(copyAudioCodecs, strings.ToLower(s.Codec))
+}
+
+// args builds the ffmpeg arguments producing the segments from index onwards into dir
+func (vr Variant) args(v *models.Video, dir string, index int, segment time.Duration) []string {
+	var start = time.Duration(index) * segment
+	var args []string
+	if start > 0 {
+		args = append(args, "-ss", ffmpeg.Timestamp(start))
+	}
+	args = append(args, "-i", v.FilePath, "-map", "0:v:0")
+	if s := vr.audio(v); s != nil {
+		args = append(args, "-map", fmt.Sprintf("0:%d", s.Index))
+	} else {
+		args = append(args, "-map", "0:a:0?")
+	}
+	args = append(args, "-sn", "-dn")
+
+	args = append(args,
+		"-c:v", "libx264", "-preset", "veryfast", "-pix_fmt", "yuv420p",
+		// Every segment must start with a key frame to be played on its own
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,%s+n_forced*%s)", ffmpeg.Timestamp(start), ffmpeg.Timestamp(segment)),
+	)
+	if vr.VideoBitrate > 0 {
+		args = append(args,
+			"-b:v", strconv.FormatInt(vr.VideoBitrate, 10),
+			"-maxrate", strconv.FormatInt(vr.VideoBitrate, 10),
+			"-bufsize", strconv.FormatInt(vr.VideoBitrate*2, 10),
+		)
+	} else {
+		args = append(args, "-crf", "23")
+	}
+	if vr.Height > 0 {
+		args = append(args, "-vf", fmt.Sprintf("scale=-2:%d", vr.Height))
+	}
+	if vr.copyAudio(v) {
+		args = append(args, "-c:a", "copy")
+	} else {
+		args = append(args, "-c:a", "aac", "-ac", "2", "-b:a", "160k")
+	}
+
+	return append(args,
+		"-copyts", "-avoid_negative_ts", "disabled",
+		"-f", "hls",
+		"-hls_time", ffmpeg.Timestamp(segment),
+		"-hls_list_size", "0",
+		"-hls_segment_type", "mpegts",
+		"-hls_flags", "temp_file+independent_segments",
+		"-start_number", strconv.Itoa(index),
+		"-hls_segment_filename", filepath.Join(dir, "%d.ts"),
+		filepath.Join(dir, "ffmpeg.m3u8"),
+	)
+}
+
+// bandwidth estimates the peak bit rate of the variant
+func (vr Variant) bandwidth(v *models.Video) int64 {
+	if vr.VideoBitrate > 0 {
+		return vr.VideoBitrate + 160_000
+	}
+	var total int64
+	for _, s := range v.Streams {
+		total += s.BitRate
+	}
+	if total == 0 && v.Duration > 0 {
+		total = v.Size * 8 / int64(max(v.Duration/time.Second, 1))
+	}
+	return max(total, 1)
+}
+
+// resolution returns the size of the output frames, 0x0 when it is unknown
+func (vr Variant) resolution(v *models.Video) (int, int) {
+	var s = v.MainVideoStream()
+	if s == nil || s.Width == 0 || s.Height == 0 {
+		return 0, 0
+	}
+	if vr.Height == 0 || vr.Height >= s.Height {
+		return s.Width, s.Height
+	}
+	var width = s.Width * vr.Height / s.Height
+	return width + width%2, vr.Height
+}
+
+func (vr Variant) codecs(v *models.Video) string {
+	// The codec of a copied audio stream is unknown, a partial list would be wrong
+	if vr.copyAudio(v) {
+		return ""
+	}
+	return transcodeVideoCodecs + "," + transcodeAudioCodecs
+}
+
+// MasterPlaylist lists the variants of the video, their playlists are
+// referenced relative to the master one. query is appended to their urls
+func MasterPlaylist(v *models.Video, variants []Variant, query string) string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+	for _, vr := range variants {
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d", vr.bandwidth(v))
+		if w, h := vr.resolution(v); w > 0 {
+			fmt.Fprintf(&b, ",RESOLUTION=%dx%d", w, h)
+		}
+		if c := vr.codecs(v); len(c) > 0 {
+			fmt.Fprintf(&b, ",CODECS=\"%s\"", c)
+		}
+		fmt.Fprintf(&b, ",NAME=\"%s\"\n%s/index.m3u8%s\n", vr.Name, vr.Id(), query)
+	}
+	return b.String()
+}
+
+// MediaPlaylist lists every segment of the video, they are generated when
+// requested so the player can seek anywhere before they exist. query is appended to their urls
+func (m *Manager) MediaPlaylist(v *models.Video, query string) string {
+	var segment = m.cfg.SegmentDuration
+	var count = m.Segments(v)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXT-X-INDEPENDENT-SEGMENTS\n", int((segment+time.Second-1)/time.Second))
+	for idx := range count {
+		var length = segment
+		if idx == count-1 {
+			length = v.Duration - time.Duration(idx)*segment
+		}
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%d.ts%s\n", length.Seconds(), idx, query)
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+	return b.String()
+}
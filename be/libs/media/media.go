@@ -0,0 +1,208 @@
+package media
+
+import (
+	"mime"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type Kind uint8
+
+const (
+	KindUnknown Kind = iota
+	KindVideo
+	KindPicture
+	KindAsset
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindVideo:
+		return "video"
+	case KindPicture:
+		return "picture"
+	case KindAsset:
+		return "asset"
+	default:
+		return "unknown"
+	}
+}
+
+type Type struct {
+	Extension string `json:"extension"`
+	MimeType  string `json:"mimeType"`
+	Kind      Kind   `json:"kind"`
+}
+
+type Registry struct {
+	types map[string]Type
+	mut   sync.RWMutex
+}
+
+var (
+	builtin []Type = []Type{
+		{Extension: ".mp4", MimeType: "video/mp4", Kind: KindVideo},
+		{Extension: ".m4v", MimeType: "video/x-m4v", Kind: KindVideo},
+		{Extension: ".mkv", MimeType: "video/x-matroska", Kind: KindVideo},
+		{Extension: ".webm", MimeType: "video/webm", Kind: KindVideo},
+		{Extension: ".mov", MimeType: "video/quicktime", Kind: KindVideo},
+		{Extension: ".avi", MimeType: "video/x-msvideo", Kind: KindVideo},
+
+		{Extension: ".jpg", MimeType: "image/jpeg", Kind: KindPicture},
+		{Extension: ".jpeg", MimeType: "image/jpeg", Kind: KindPicture},
+		{Extension: ".png", MimeType: "image/png", Kind: KindPicture},
+		{Extension: ".gif", MimeType: "image/gif", Kind: KindPicture},
+		{Extension: ".webp", MimeType: "image/webp", Kind: KindPicture},
+
+		{Extension: ".css", MimeType: "text/css", Kind: KindAsset},
+		{Extension: ".csv", MimeType: "text/csv", Kind: KindAsset},
+		{Extension: ".html", MimeType: "text/html", Kind: KindAsset},
+		{Extension: ".js", MimeType: "text/javascript", Kind: KindAsset},
+		{Extension: ".json", MimeType: "application/json", Kind: KindAsset},
+		{Extension: ".md", MimeType: "text/markdown", Kind: KindAsset},
+		{Extension: ".mjs", MimeType: "text/javascript", Kind: KindAsset},
+		{Extension: ".otf", MimeType: "font/otf", Kind: KindAsset},
+		{Extension: ".pdf", MimeType: "application/pdf", Kind: KindAsset},
+		{Extension: ".php", MimeType: "application/x-httpd-php", Kind: KindAsset},
+		{Extension: ".svg", MimeType: "image/svg+xml", Kind: KindAsset},
+		{Extension: ".ttf", MimeType: "font/ttf", Kind: KindAsset},
+		{Extension: ".woff", MimeType: "font/woff", Kind: KindAsset},
+		{Extension: ".woff2", MimeType: "font/woff2", Kind: KindAsset},
+		{Extension: ".xml", MimeType: "application/xml", Kind: KindAsset},
+	}
+
+	// Default is the registry used by the scanners, the CLI and the web server
+	Default *Registry = NewRegistry(builtin...)
+)
+
+func NewRegistry(types ...Type) *Registry {
+	var r = &Registry{types: map[string]Type{}}
+	for _, t := range types {
+		r.Register(t)
+	}
+	return r
+}
+
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if len(ext) > 0 && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+func (r *Registry) Register(t Type) {
+	t.Extension = normalizeExt(t.Extension)
+	if len(t.Extension) == 0 {
+		return
+	}
+	r.mut.Lock()
+	r.types[t.Extension] = t
+	r.mut.Unlock()
+}
+
+func (r *Registry) Unregister(ext string) {
+	r.mut.Lock()
+	delete(r.types, normalizeExt(ext))
+	r.mut.Unlock()
+}
+
+// Accept replaces every registered type of the given kind with the given
+// extensions, unknown extensions get their mime type from the standard library
+func (r *Registry) Accept(kind Kind, exts ...string) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	for ext, t := range r.types {
+		if t.Kind == kind {
+			delete(r.types, ext)
+		}
+	}
+
+	for _, ext := range exts {
+		ext = normalizeExt(ext)
+		if len(ext) == 0 {
+			continue
+		}
+		var t = Type{Extension: ext, Kind: kind}
+		if idx := slices.IndexFunc(builtin, func(b Type) bool { return b.Extension == ext }); idx >= 0 {
+			t.MimeType = builtin[idx].MimeType
+		} else if m := mime.TypeByExtension(ext); len(m) > 0 {
+			t.MimeType = strings.Split(m, ";")[0]
+		} else {
+			t.MimeType = "application/octet-stream"
+		}
+		r.types[ext] = t
+	}
+}
+
+// Lookup resolves the media type of a file from its extension only
+func (r *Registry) Lookup(file string) (Type, bool) {
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+	t, ok := r.types[normalizeExt(filepath.Ext(file))]
+	return t, ok
+}
+
+// Detect resolves the media type of a file from its extension, the content of
+// the file is sniffed only when the extension is missing or ambiguous
+func (r *Registry) Detect(file string) (Type, bool) {
+	if t, ok := r.Lookup(file); ok {
+		return t, true
+	}
+	if !Ambiguous(filepath.Ext(file)) {
+		return Type{}, false
+	}
+	return r.Sniff(file)
+}
+
+func (r *Registry) Is(file string, kind Kind) bool {
+	t, ok := r.Detect(file)
+	return ok && t.Kind == kind
+}
+
+func (r *Registry) Extensions(kind Kind) (exts []string) {
+	r.mut.RLock()
+	for ext, t := range r.types {
+		if t.Kind == kind {
+			exts = append(exts, ext)
+		}
+	}
+	r.mut.RUnlock()
+	slices.Sort(exts)
+	return
+}
+
+func (r *Registry) byMimeType(mimeType string, kinds ...Kind) (Type, bool) {
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+	var found []Type
+	for _, t := range r.types {
+		if t.MimeType == mimeType && (len(kinds) == 0 || slices.Contains(kinds, t.Kind)) {
+			found = append(found, t)
+		}
+	}
+	if len(found) == 0 {
+		return Type{}, false
+	}
+	slices.SortFunc(found, func(a, b Type) int { return strings.Compare(a.Extension, b.Extension) })
+	return found[0], true
+}
+
+func Lookup(file string) (Type, bool) {
+	return Default.Lookup(file)
+}
+
+func Detect(file string) (Type, bool) {
+	return Default.Detect(file)
+}
+
+func IsVideo(file string) bool {
+	return Default.Is(file, KindVideo)
+}
+
+func IsPicture(file string) bool {
+	return Default.Is(file, KindPicture)
+}
@@ -0,0 +1,74 @@
+package media
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+const sniffLength int = 512
+
+// ambiguous are the extensions telling nothing about the content: downloads,
+// temporary copies and generic binary files
+var ambiguous = []string{"", ".bin", ".dat", ".tmp", ".part", ".download", ".crdownload"}
+
+// Ambiguous reports whether the content of a file with the extension has to be sniffed,
+// numeric extensions like .001 of split files are ambiguous too
+func Ambiguous(ext string) bool {
+	ext = normalizeExt(ext)
+	if slices.Contains(ambiguous, ext) {
+		return true
+	}
+	return strings.Trim(ext, ".0123456789") == ""
+}
+
+// SniffMimeType returns the mime type detected from the first bytes of the file
+func SniffMimeType(file string) (string, error) {
+	fd, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+
+	var header = make([]byte, sniffLength)
+	n, err := io.ReadFull(fd, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return sniffBytes(header[:n]), nil
+}
+
+func sniffBytes(header []byte) string {
+	switch {
+	case len(header) >= 12 && bytes.Equal(header[4:8], []byte("ftyp")):
+		switch string(header[8:12]) {
+		case "qt  ":
+			return "video/quicktime"
+		case "M4V ", "M4VH", "M4VP":
+			return "video/x-m4v"
+		default:
+			return "video/mp4"
+		}
+	case bytes.HasPrefix(header, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		if bytes.Contains(header, []byte("webm")) {
+			return "video/webm"
+		}
+		return "video/x-matroska"
+	case len(header) >= 12 && bytes.HasPrefix(header, []byte("RIFF")) && bytes.Equal(header[8:12], []byte("AVI ")):
+		return "video/x-msvideo"
+	}
+	return strings.Split(http.DetectContentType(header), ";")[0]
+}
+
+// Sniff resolves the media type of a file from its content, only the types
+// registered within the registry are considered valid
+func (r *Registry) Sniff(file string) (Type, bool) {
+	mimeType, err := SniffMimeType(file)
+	if err != nil {
+		return Type{}, false
+	}
+	return r.byMimeType(mimeType, KindVideo, KindPicture)
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// DuplicateGroup holds the videos with the same size, duration and fingerprint
+type DuplicateGroup struct {
+	Fingerprint string        `json:"fingerprint"`
+	Size        int64         `json:"size"`
+	Duration    time.Duration `json:"duration"`
+	Videos      []Video       `json:"videos"`
+	// Wasted is the space used by every copy but one
+	Wasted int64 `json:"wasted"`
+}
+
+// FindDuplicates groups the existing videos sharing the same content, the
+// groups wasting more space come first. Videos without a fingerprint are ignored
+func FindDuplicates(conn *gorm.DB) ([]DuplicateGroup, error) {
+	var keys []struct {
+		Fingerprint string
+		Size        int64
+		Duration    time.Duration
+	}
+	if tx := conn.Model(&Video{}).
+		Select("fingerprint, size, duration").
+		Where("attr_exists = ? AND fingerprint <> ''", true).
+		Group("fingerprint, size, duration").
+		Having("count(*) > 1").
+		Scan(&keys); tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	var groups = make([]DuplicateGroup, 0, len(keys))
+	for _, k := range keys {
+		var g = DuplicateGroup{Fingerprint: k.Fingerprint, Size: k.Size, Duration: k.Duration}
+		if tx := conn.
+			Where("attr_exists = ? AND fingerprint = ? AND size = ? AND duration = ?", true, k.Fingerprint, k.Size, k.Duration).
+			Order("file_path").
+			Find(&g.Videos); tx.Error != nil {
+			return nil, tx.Error
+		}
+		if len(g.Videos) < 2 {
+			continue
+		}
+		g.Wasted = g.Size * int64(len(g.Videos)-1)
+		groups = append(groups, g)
+	}
+
+	slices.SortStableFunc(groups, func(a, b DuplicateGroup) int {
+		return cmp.Compare(b.Wasted, a.Wasted)
+	})
+	return groups, nil
+}
+
+// Others returns every video of the group but the one to keep
+func (g *DuplicateGroup) Others(keepId string) ([]Video, error) {
+	if !slices.ContainsFunc(g.Videos, func(v Video) bool { return v.Id == keepId }) {
+		return nil, fmt.Errorf("video with id=`%s` is not part of the group", keepId)
+	}
+	var out []Video
+	for _, v := range g.Videos {
+		if v.Id != keepId {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+// FindDuplicateGroup returns the group holding the video with the given id
+func FindDuplicateGroup(conn *gorm.DB, videoId string) (*DuplicateGroup, error) {
+	groups, err := FindDuplicates(conn)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		if slices.ContainsFunc(g.Videos, func(v Video) bool { return v.Id == videoId }) {
+			return &g, nil
+		}
+	}
+	return nil, fmt.Errorf("video with id=`%s` has no duplicates", videoId)
+}
+
+// Delete removes the video from the database, when removeFile is set the
+// file is deleted from the disk first. A file left on the disk would be added
+// back by the next scan, so without removeFile only the missing files are deleted
+func (v *Video) Delete(conn *gorm.DB, removeFile bool) error {
+	if removeFile {
+		if err := os.Remove(v.FilePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	} else if _, err := os.Stat(v.FilePath); err == nil {
+		return fmt.Errorf("the file `%s` still exists, the scan would add the video back", v.FilePath)
+	}
+	if tx := conn.Delete(v); tx.Error != nil {
+		return tx.Error
+	}
+	log.Info().Str("id", v.Id).Str("file", v.FilePath).Bool("removeFile", removeFile).Msg("Deleted video")
+	return nil
+}
@@ -3,22 +3,34 @@ package models
 import (
 	"errors"
 	"fmt"
+	"full/libs/media"
+	"io/fs"
 	"os"
 	"path"
-	"slices"
+	"path/filepath"
 	"strings"
 
 	"github.com/graphql-go/graphql"
 	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
 )
 
 type Folder struct {
 	Id           string `json:"id,omitempty" gorm:"primaryKey"`
 	Path         string `json:"path" gorm:"unique,index"`
 	AuthRequired bool   `json:"-"`
-	originalId   string `json:"-" gorm:"-"`
+	// Rules are stored in their own table, see LoadFolders
+	Rules      *ScanRules `json:"rules,omitempty" gorm:"-"`
+	originalId string     `json:"-" gorm:"-"`
+	rootPath   string     `json:"-" gorm:"-"`
 }
 
+var (
+	ErrLoginRequired       = errors.New("authentication required")
+	ErrAdminRequired       = errors.New("administrator permissions required")
+	ErrFolderNotRegistered = errors.New("folder is not registered")
+)
+
 func NewFolder(p string) *Folder {
 	return (&Folder{Path: p}).generateId()
 }
@@ -52,77 +64,191 @@ func (f *Folder) IsValidPath() bool {
 	return false
 }
 
-func (f *Folder) GetVideos() (vids []*Video) {
-	entries, err := os.ReadDir(f.Path)
-	if err != nil {
-		log.Err(err).Send()
-		return
+// CanAccess reports whether the user sees the content of the folder, user is nil when anonymous
+func (f *Folder) CanAccess(user *User) bool {
+	return !f.AuthRequired || user != nil
+}
+
+// Authorize checks that the user can access the content stored in the folder,
+// the registered folder is loaded since the copy embedded in videos and pictures
+// may be outdated. The content of folders not registered anymore is never served
+func (f *Folder) Authorize(conn *gorm.DB, user *User) error {
+	if f == nil || len(f.Id) == 0 {
+		return ErrFolderNotRegistered
 	}
-	for _, e := range entries {
-		var fullpath = path.Join(f.Path, e.Name())
-		if e.IsDir() {
-			var validId = f.originalId
-			if validId == "" {
-				validId = f.Id
-			}
-			vids = append(vids, (*Folder).GetVideos(&Folder{
-				Id:         validId,
-				Path:       fullpath,
-				originalId: validId,
-			},
-			)...)
-			continue
+	var folders []Folder
+	if tx := conn.Find(&folders, Folder{Id: f.Id}); tx.Error != nil {
+		return tx.Error
+	}
+	if len(folders) == 0 {
+		return fmt.Errorf("%w: id=`%s`", ErrFolderNotRegistered, f.Id)
+	}
+	if !folders[0].CanAccess(user) {
+		return fmt.Errorf("%w: folder id=`%s`", ErrLoginRequired, f.Id)
+	}
+	return nil
+}
+
+// AccessibleFolders returns the ids of the registered folders whose content the user can access
+func AccessibleFolders(conn *gorm.DB, user *User) (map[string]bool, error) {
+	var folders []Folder
+	if tx := conn.Find(&folders); tx.Error != nil {
+		return nil, tx.Error
+	}
+	var out = make(map[string]bool, len(folders))
+	for _, f := range folders {
+		if f.CanAccess(user) {
+			out[f.Id] = true
 		}
-		if path.Ext(fullpath) != ".mp4" {
-			continue
+	}
+	return out, nil
+}
+
+// ScanRules returns the rules of the folder, or the default ones when none has been set
+func (f *Folder) ScanRules() *ScanRules {
+	if f.Rules != nil {
+		return f.Rules
+	}
+	return DefaultScanRules()
+}
+
+func (f *Folder) root() string {
+	if len(f.rootPath) > 0 {
+		return f.rootPath
+	}
+	return f.Path
+}
+
+// Allows reports whether the scan rules keep the given path, every folder
+// between the registered root and the path is checked as well
+func (f *Folder) Allows(p string, isDir bool) bool {
+	rel, err := filepath.Rel(f.root(), p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	if rel == "." {
+		return true
+	}
+
+	var rules = f.ScanRules()
+	var parts = strings.Split(rel, string(filepath.Separator))
+	for idx := range parts[:len(parts)-1] {
+		if !rules.allows(filepath.Join(parts[:idx+1]...), true) {
+			return false
 		}
-		var size int64 = 0
-		info, err := e.Info()
+	}
+	return rules.allows(rel, isDir)
+}
+
+// walk calls visit for every file allowed by the scan rules, the symbolic
+// links to folders are followed once, so a loop is never scanned twice
+func (f *Folder) walk(visit func(dir *Folder, fullpath string, info fs.FileInfo)) {
+	var rules = f.ScanRules()
+	var visited = map[string]bool{}
+
+	var walkDir func(dir *Folder)
+	walkDir = func(dir *Folder) {
+		real, err := filepath.EvalSymlinks(dir.Path)
 		if err != nil {
 			log.Err(err).Send()
-		} else {
-			size = info.Size()
+			return
 		}
-		var v = Video{
-			Title:    e.Name(),
-			FilePath: fullpath,
-			Size:     size,
-			Folder:   f,
+		if visited[real] {
+			log.Warn().Str("path", dir.Path).Str("target", real).Msg("Skipping symlink loop")
+			return
+		}
+		visited[real] = true
+
+		entries, err := os.ReadDir(dir.Path)
+		if err != nil {
+			log.Err(err).Send()
+			return
 		}
-		v.GenerateId()
-		v.SetAttributes()
+		// The rules belong to the registered folder, they are not copied in every video
+		var owner = *dir
+		owner.Rules = nil
+		for _, e := range entries {
+			var fullpath = path.Join(dir.Path, e.Name())
+			var isLink = e.Type()&fs.ModeSymlink != 0
+			if isLink && rules.SkipSymlinks {
+				continue
+			}
+
+			// Links are resolved, the size and the kind are the ones of the target
+			var info fs.FileInfo
+			if isLink {
+				info, err = os.Stat(fullpath)
+			} else {
+				info, err = e.Info()
+			}
+			if err != nil {
+				log.Err(err).Send()
+				continue
+			}
 
-		vids = append(vids, &v)
+			rel, err := filepath.Rel(f.root(), fullpath)
+			if err != nil || !rules.allows(rel, info.IsDir()) {
+				continue
+			}
+			if info.IsDir() {
+				walkDir(f.Sub(fullpath))
+				continue
+			}
+			visit(&owner, fullpath, info)
+		}
 	}
+	walkDir(f)
+}
 
+func (f *Folder) GetVideos() (vids []*Video) {
+	// Every folder is listed once for the subtitles of all its videos
+	var listings = map[string]*subtitleListing{}
+	f.walk(func(dir *Folder, fullpath string, info fs.FileInfo) {
+		if media.IsVideo(fullpath) {
+			var parent = filepath.Dir(fullpath)
+			if _, ok := listings[parent]; !ok {
+				listings[parent] = listSubtitles(parent)
+			}
+			vids = append(vids, newVideo(fullpath, info.Size(), dir, listings[parent]))
+		}
+	})
 	return
 }
 
 func (f *Folder) GetPictures() (pics []*Picture) {
-	entries, err := os.ReadDir(f.Path)
+	f.walk(func(dir *Folder, fullpath string, info fs.FileInfo) {
+		if media.IsPicture(fullpath) {
+			var p = NewPicture(fullpath)
+			p.Folder = dir
+			pics = append(pics, &p)
+		}
+	})
+	return
+}
+
+// Contains reports whether the given file path is inside the folder
+func (f *Folder) Contains(file string) bool {
+	rel, err := filepath.Rel(f.Path, file)
 	if err != nil {
-		log.Err(err).Send()
-		return
+		return false
 	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
 
-	for _, e := range entries {
-		var fullpath = path.Join(f.Path, e.Name())
-		if e.IsDir() {
-			pics = append(pics, (*Folder).GetPictures(&Folder{
-				Id:         f.originalId,
-				Path:       fullpath,
-				originalId: f.originalId,
-			})...)
-			continue
-		}
-		if !slices.Contains([]string{".jpg", ".png", ".jpeg", ".gif"}, path.Ext(strings.ToLower(fullpath))) {
-			continue
-		}
-		var p = NewPicture(fullpath)
-		p.Folder = f
-		pics = append(pics, &p)
+// Sub returns the given directory as a sub folder of the registered root
+func (f *Folder) Sub(dir string) *Folder {
+	var validId = f.originalId
+	if validId == "" {
+		validId = f.Id
+	}
+	return &Folder{
+		Id:           validId,
+		Path:         dir,
+		AuthRequired: f.AuthRequired,
+		Rules:        f.Rules,
+		originalId:   validId,
+		rootPath:     f.root(),
 	}
-	return
 }
 
 func (*Folder) GetGQLType() *graphql.Output {
@@ -135,6 +261,19 @@ var (
 		Fields: graphql.Fields{
 			"id":   &graphql.Field{Type: graphql.String, Description: "Folder id (Generated) follows pattern: f-%d"},
 			"path": &graphql.Field{Type: graphql.String, Description: "Folder path on the system"},
+			"rules": &graphql.Field{
+				Type:        gql_ScanRulesType,
+				Description: "Rules applied while scanning the folder",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					switch f := p.Source.(type) {
+					case *Folder:
+						return f.ScanRules(), nil
+					case Folder:
+						return f.ScanRules(), nil
+					}
+					return nil, nil
+				},
+			},
 		},
 	})
 )
@@ -5,7 +5,9 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/graphql-go/graphql"
 	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
 )
 
 type Picture struct {
@@ -14,6 +16,8 @@ type Picture struct {
 	Title    string  `json:"title"`
 	Size     *int64  `json:"size"`
 	Folder   *Folder `json:"folder,omitempty" gorm:"embedded;embeddedPrefix:folder_"`
+	// Tags are stored as PictureTag links, the embedded folder id confuses the gorm relations
+	Tags []Tag `json:"tags,omitempty" gorm:"-"`
 }
 
 func (p *Picture) generateId() *Picture {
@@ -45,3 +49,32 @@ func (p *Picture) GetSize() *int64 {
 	p.Size = &size
 	return &size
 }
+
+// AfterDelete removes the tags together with the picture
+func (p *Picture) AfterDelete(tx *gorm.DB) error {
+	if len(p.Id) == 0 {
+		return nil
+	}
+	return tx.Where("picture_id = ?", p.Id).Delete(&PictureTag{}).Error
+}
+
+func (*Picture) GetGQLType() *graphql.Output {
+	return &gql_PictureType
+}
+
+var (
+	gql_PictureType graphql.Output = graphql.NewObject(graphql.ObjectConfig{
+		Name: "GQLPicture",
+		Fields: graphql.Fields{
+			"id":       &graphql.Field{Type: graphql.String, Description: "Picture id (Generated) follows pattern: p-%d"},
+			"title":    &graphql.Field{Type: graphql.String, Description: "Picture title"},
+			"filePath": &graphql.Field{Type: graphql.String, Description: "File path in the file system"},
+			"size":     &graphql.Field{Type: graphql.Int, Description: "Picture size (Byte)"},
+			"folder": &graphql.Field{
+				Type:        gql_FolderType,
+				Description: "Folder",
+			},
+			"tags": &graphql.Field{Type: graphql.NewList(gql_TagType), Description: "Tags of the picture"},
+		},
+	})
+)
@@ -0,0 +1,185 @@
+package models
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// HistoryGap is the pause after which the next progress starts a new playback session
+	HistoryGap time.Duration = time.Minute * 30
+
+	DefaultHistoryLimit int = 50
+	MaxHistoryLimit     int = 500
+
+	DefaultContinueWatchingLimit int = 20
+)
+
+// HistoryEntry is a playback session of a user: the part of the video played
+// from the same client without long pauses
+type HistoryEntry struct {
+	Id            uint          `json:"id" gorm:"primaryKey"`
+	UserId        string        `json:"-" gorm:"index"`
+	VideoId       string        `json:"videoId" gorm:"index"`
+	StartPosition time.Duration `json:"startPosition"`
+	EndPosition   time.Duration `json:"endPosition"`
+	StartedAt     time.Time     `json:"startedAt" gorm:"index"`
+	EndedAt       time.Time     `json:"endedAt"`
+	// Client is the user agent of the player
+	Client string `json:"client,omitempty"`
+	Video  *Video `json:"video,omitempty" gorm:"-"`
+}
+
+// MarshalJSON writes the positions in seconds, like the progress
+func (h HistoryEntry) MarshalJSON() ([]byte, error) {
+	type plain HistoryEntry
+	return json.Marshal(struct {
+		plain
+		StartPosition float64 `json:"startPosition"`
+		EndPosition   float64 `json:"endPosition"`
+	}{plain(h), h.StartPosition.Seconds(), h.EndPosition.Seconds()})
+}
+
+type HistoryPage struct {
+	Entries []HistoryEntry `json:"entries"`
+	Offset  int            `json:"offset"`
+	Limit   int            `json:"limit"`
+	Total   int64          `json:"total"`
+}
+
+// RecordHistory extends the current playback session of the user on the video
+// up to position, a new one starts after HistoryGap or from another client
+func RecordHistory(conn *gorm.DB, userId string, videoId string, position time.Duration, client string) error {
+	var now = time.Now()
+	var last []HistoryEntry
+	if tx := conn.Where("user_id = ? AND video_id = ? AND client = ? AND ended_at >= ?", userId, videoId, client, now.Add(-HistoryGap)).
+		Order("ended_at DESC").Limit(1).Find(&last); tx.Error != nil {
+		return tx.Error
+	}
+	if len(last) == 1 {
+		return conn.Model(&last[0]).UpdateColumns(map[string]any{
+			"end_position": position,
+			"ended_at":     now,
+		}).Error
+	}
+	return conn.Create(&HistoryEntry{
+		UserId:        userId,
+		VideoId:       videoId,
+		StartPosition: position,
+		EndPosition:   position,
+		StartedAt:     now,
+		EndedAt:       now,
+		Client:        client,
+	}).Error
+}
+
+// accessibleVideos selects the ids of the videos inside the folders the user can access
+func accessibleVideos(conn *gorm.DB, user *User) (*gorm.DB, error) {
+	accessible, err := AccessibleFolders(conn, user)
+	if err != nil {
+		return nil, err
+	}
+	var folders = make([]string, 0, len(accessible))
+	for id := range accessible {
+		folders = append(folders, id)
+	}
+	return conn.Model(&Video{}).Select("id").Where("folder_id IN ?", folders), nil
+}
+
+// attachVideos loads the videos referenced by ids, by id
+func attachVideos(conn *gorm.DB, ids []string) (map[string]*Video, error) {
+	var videos []Video
+	if tx := conn.Preload("Streams").Preload("Subtitles").Find(&videos, "id IN ?", ids); tx.Error != nil {
+		return nil, tx.Error
+	}
+	var out = make(map[string]*Video, len(videos))
+	for i := range videos {
+		out[videos[i].Id] = &videos[i]
+	}
+	return out, nil
+}
+
+// History lists a page of the playback sessions of the user, the latest first.
+// The sessions of videos the user cannot access anymore are left out
+func History(conn *gorm.DB, user *User, offset int, limit int) (*HistoryPage, error) {
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+	limit = min(limit, MaxHistoryLimit)
+	offset = max(offset, 0)
+
+	videos, err := accessibleVideos(conn, user)
+	if err != nil {
+		return nil, err
+	}
+	var query = conn.Model(&HistoryEntry{}).Where("user_id = ? AND video_id IN (?)", user.Id, videos).Session(&gorm.Session{})
+
+	var out = &HistoryPage{Offset: offset, Limit: limit, Entries: []HistoryEntry{}}
+	if tx := query.Count(&out.Total); tx.Error != nil {
+		return nil, tx.Error
+	}
+	if tx := query.Order("ended_at DESC").Offset(offset).Limit(limit).Find(&out.Entries); tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	var ids []string
+	for _, e := range out.Entries {
+		if !slices.Contains(ids, e.VideoId) {
+			ids = append(ids, e.VideoId)
+		}
+	}
+	found, err := attachVideos(conn, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range out.Entries {
+		out.Entries[i].Video = found[out.Entries[i].VideoId]
+	}
+	return out, nil
+}
+
+// ClearHistory removes every playback session of the user, their progress is kept
+func ClearHistory(conn *gorm.DB, user *User) (int64, error) {
+	tx := conn.Where("user_id = ?", user.Id).Delete(&HistoryEntry{})
+	return tx.RowsAffected, tx.Error
+}
+
+// ContinueWatching returns the videos the user started and did not complete,
+// the last watched first, with their progress
+func ContinueWatching(conn *gorm.DB, user *User, limit int) ([]Video, error) {
+	if limit <= 0 {
+		limit = DefaultContinueWatchingLimit
+	}
+	limit = min(limit, MaxHistoryLimit)
+
+	videos, err := accessibleVideos(conn, user)
+	if err != nil {
+		return nil, err
+	}
+	var progress []WatchProgress
+	videos = videos.Where("attr_exists = ?", true)
+	if tx := conn.Where("user_id = ? AND completed = ? AND position > 0 AND video_id IN (?)", user.Id, false, videos).
+		Order("last_watched DESC").Limit(limit).Find(&progress); tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	var ids = make([]string, 0, len(progress))
+	for _, p := range progress {
+		ids = append(ids, p.VideoId)
+	}
+	found, err := attachVideos(conn, ids)
+	if err != nil {
+		return nil, err
+	}
+	var out = make([]Video, 0, len(progress))
+	for _, p := range progress {
+		if v, ok := found[p.VideoId]; ok {
+			v.Progress = &p
+			out = append(out, *v)
+		}
+	}
+	return out, nil
+}
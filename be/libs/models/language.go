@@ -0,0 +1,77 @@
+package models
+
+import "strings"
+
+type language struct {
+	Code string
+	Name string
+	// Aliases are the ISO 639-2 codes and the names found in file names and stream tags
+	Aliases []string
+}
+
+var languages = []language{
+	{"en", "English", []string{"eng", "english"}},
+	{"it", "Italian", []string{"ita", "italian", "italiano"}},
+	{"fr", "French", []string{"fre", "fra", "french", "francais"}},
+	{"de", "German", []string{"ger", "deu", "german", "deutsch"}},
+	{"es", "Spanish", []string{"spa", "spanish", "espanol"}},
+	{"pt", "Portuguese", []string{"por", "portuguese", "portugues"}},
+	{"nl", "Dutch", []string{"dut", "nld", "dutch"}},
+	{"ru", "Russian", []string{"rus", "russian"}},
+	{"ja", "Japanese", []string{"jpn", "japanese"}},
+	{"zh", "Chinese", []string{"chi", "zho", "chinese"}},
+	{"ko", "Korean", []string{"kor", "korean"}},
+	{"ar", "Arabic", []string{"ara", "arabic"}},
+	{"sv", "Swedish", []string{"swe", "swedish"}},
+	{"da", "Danish", []string{"dan", "danish"}},
+	{"no", "Norwegian", []string{"nor", "nob", "nno", "norwegian"}},
+	{"fi", "Finnish", []string{"fin", "finnish"}},
+	{"pl", "Polish", []string{"pol", "polish"}},
+	{"cs", "Czech", []string{"cze", "ces", "czech"}},
+	{"hu", "Hungarian", []string{"hun", "hungarian"}},
+	{"el", "Greek", []string{"gre", "ell", "greek"}},
+	{"tr", "Turkish", []string{"tur", "turkish"}},
+	{"he", "Hebrew", []string{"heb", "hebrew"}},
+	{"hi", "Hindi", []string{"hin", "hindi"}},
+	{"ro", "Romanian", []string{"rum", "ron", "romanian"}},
+	{"uk", "Ukrainian", []string{"ukr", "ukrainian"}},
+}
+
+var languageIndex = func() map[string]*language {
+	var out = map[string]*language{}
+	for idx := range languages {
+		var l = &languages[idx]
+		out[l.Code] = l
+		for _, a := range l.Aliases {
+			out[a] = l
+		}
+	}
+	return out
+}()
+
+// NormalizeLanguage converts a language code or name to its ISO 639-1 code,
+// like "ita" or "Italian" to "it"
+func NormalizeLanguage(s string) (string, bool) {
+	if l, ok := languageIndex[strings.ToLower(strings.TrimSpace(s))]; ok {
+		return l.Code, true
+	}
+	return "", false
+}
+
+// SameLanguage reports whether two codes or names refer to the same language
+func SameLanguage(a string, b string) bool {
+	codeA, okA := NormalizeLanguage(a)
+	codeB, okB := NormalizeLanguage(b)
+	if okA && okB {
+		return codeA == codeB
+	}
+	return len(a) > 0 && strings.EqualFold(a, b)
+}
+
+// LanguageName returns the English name of the language, or the code itself when it is unknown
+func LanguageName(code string) string {
+	if l, ok := languageIndex[strings.ToLower(code)]; ok {
+		return l.Name
+	}
+	return code
+}
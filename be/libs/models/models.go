@@ -13,9 +13,19 @@ var (
 		&User{},
 		&Session{},
 		&Folder{},
+		&ScanRules{},
 		&Video{},
+		&VideoStream{},
+		&Subtitle{},
 		&Picture{},
 		&Page{},
+		&WatchProgress{},
+		&HistoryEntry{},
+		&Playlist{},
+		&PlaylistEntry{},
+		&Tag{},
+		&VideoTag{},
+		&PictureTag{},
 	}
 )
 
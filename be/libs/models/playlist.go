@@ -0,0 +1,314 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"gorm.io/gorm"
+)
+
+const (
+	// PlaylistPrivate playlists are visible to their owner only
+	PlaylistPrivate string = "private"
+	// PlaylistShared playlists are visible to everyone, only their owner can change them
+	PlaylistShared string = "shared"
+
+	MaxPlaylistName int = 200
+)
+
+var (
+	ErrPlaylistNotFound  = errors.New("cannot find playlist")
+	ErrPlaylistForbidden = errors.New("the playlist belongs to another user")
+)
+
+// Playlist is an ordered list of videos owned by a user
+type Playlist struct {
+	Id          string          `json:"id" gorm:"primaryKey"`
+	OwnerId     string          `json:"ownerId" gorm:"index"`
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Visibility  string          `json:"visibility" gorm:"index"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	UpdatedAt   time.Time       `json:"updatedAt"`
+	Entries     []PlaylistEntry `json:"entries" gorm:"foreignKey:PlaylistId"`
+}
+
+// PlaylistEntry is a video at a position of a playlist, the same video can be there more than once
+type PlaylistEntry struct {
+	Id         uint   `json:"id" gorm:"primaryKey"`
+	PlaylistId string `json:"-" gorm:"index"`
+	VideoId    string `json:"videoId" gorm:"index"`
+	Position   int    `json:"position"`
+	Video      *Video `json:"video,omitempty" gorm:"-"`
+}
+
+func NewPlaylist(owner *User, name string, description string, visibility string) (*Playlist, error) {
+	var p = Playlist{
+		OwnerId:     owner.Id,
+		Name:        strings.TrimSpace(name),
+		Description: strings.TrimSpace(description),
+		Visibility:  visibility,
+		Entries:     []PlaylistEntry{},
+	}
+	if len(p.Visibility) == 0 {
+		p.Visibility = PlaylistPrivate
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	p.Id = fmt.Sprintf("l-%d", hashFromString(fmt.Sprintf("%s#%s#%d", owner.Id, p.Name, time.Now().UnixNano())))
+	return &p, nil
+}
+
+func (p *Playlist) Validate() error {
+	if len(p.Name) == 0 {
+		return fmt.Errorf("the playlist name cannot be empty")
+	}
+	if len(p.Name) > MaxPlaylistName {
+		return fmt.Errorf("the playlist name cannot be longer than %d characters", MaxPlaylistName)
+	}
+	if !slices.Contains([]string{PlaylistPrivate, PlaylistShared}, p.Visibility) {
+		return fmt.Errorf("unknown visibility `%s`, it must be %s or %s", p.Visibility, PlaylistPrivate, PlaylistShared)
+	}
+	return nil
+}
+
+func (p *Playlist) CanView(user *User) bool {
+	return p.Visibility == PlaylistShared || p.CanEdit(user)
+}
+
+func (p *Playlist) CanEdit(user *User) bool {
+	return user != nil && user.Id == p.OwnerId
+}
+
+// LoadPlaylist returns the playlist with its entries in order
+func LoadPlaylist(conn *gorm.DB, id string) (*Playlist, error) {
+	var found []Playlist
+	if tx := conn.Preload("Entries", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	}).Limit(1).Find(&found, Playlist{Id: id}); tx.Error != nil {
+		return nil, tx.Error
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("%w with id=`%s`", ErrPlaylistNotFound, id)
+	}
+	return &found[0], nil
+}
+
+// Playlists returns the playlists of the user and the ones shared by the others, without their videos
+func Playlists(conn *gorm.DB, user *User) ([]Playlist, error) {
+	var query = conn.Where("visibility = ?", PlaylistShared)
+	if user != nil {
+		query = conn.Where("owner_id = ? OR visibility = ?", user.Id, PlaylistShared)
+	}
+	var out = []Playlist{}
+	if tx := query.Preload("Entries", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	}).Order("name").Find(&out); tx.Error != nil {
+		return nil, tx.Error
+	}
+	return out, nil
+}
+
+// Create stores the new playlist together with its entries
+func (p *Playlist) Create(conn *gorm.DB) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	return conn.Create(p).Error
+}
+
+// Update stores the name, the description and the visibility of the playlist
+func (p *Playlist) Update(conn *gorm.DB) error {
+	p.Name = strings.TrimSpace(p.Name)
+	p.Description = strings.TrimSpace(p.Description)
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	p.UpdatedAt = time.Now()
+	return conn.Model(&Playlist{Id: p.Id}).Select("name", "description", "visibility", "updated_at").Updates(map[string]any{
+		"name":        p.Name,
+		"description": p.Description,
+		"visibility":  p.Visibility,
+		"updated_at":  p.UpdatedAt,
+	}).Error
+}
+
+// Delete removes the playlist and its entries
+func (p *Playlist) Delete(conn *gorm.DB) error {
+	return conn.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("playlist_id = ?", p.Id).Delete(&PlaylistEntry{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Playlist{Id: p.Id}).Error
+	})
+}
+
+// AddVideos appends the videos at the end of the playlist, in the given order.
+// Every video must be in a folder the user can access
+func (p *Playlist) AddVideos(conn *gorm.DB, user *User, videoIds []string) error {
+	if len(videoIds) == 0 {
+		return fmt.Errorf("no video to add")
+	}
+	accessible, err := AccessibleFolders(conn, user)
+	if err != nil {
+		return err
+	}
+	var videos []Video
+	if tx := conn.Find(&videos, "id IN ?", videoIds); tx.Error != nil {
+		return tx.Error
+	}
+	for _, id := range videoIds {
+		var idx = slices.IndexFunc(videos, func(v Video) bool { return v.Id == id })
+		if idx < 0 {
+			return fmt.Errorf("cannot find video with id=`%s`", id)
+		}
+		if videos[idx].Folder == nil || !accessible[videos[idx].Folder.Id] {
+			return fmt.Errorf("video id=`%s` is not accessible", id)
+		}
+	}
+
+	var next = len(p.Entries)
+	var added = make([]PlaylistEntry, 0, len(videoIds))
+	for i, id := range videoIds {
+		added = append(added, PlaylistEntry{PlaylistId: p.Id, VideoId: id, Position: next + i})
+	}
+	return conn.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&added).Error; err != nil {
+			return err
+		}
+		p.Entries = append(p.Entries, added...)
+		return p.touch(tx)
+	})
+}
+
+// RemoveEntry removes a single entry, the following ones move up
+func (p *Playlist) RemoveEntry(conn *gorm.DB, entryId uint) error {
+	var idx = slices.IndexFunc(p.Entries, func(e PlaylistEntry) bool { return e.Id == entryId })
+	if idx < 0 {
+		return fmt.Errorf("cannot find entry id=`%d` in playlist id=`%s`", entryId, p.Id)
+	}
+	var entries = slices.Delete(slices.Clone(p.Entries), idx, idx+1)
+	return conn.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&PlaylistEntry{}, entryId).Error; err != nil {
+			return err
+		}
+		if err := p.savePositions(tx, entries); err != nil {
+			return err
+		}
+		p.Entries = entries
+		return nil
+	})
+}
+
+// Reorder moves the entries in the order of entryIds. The entries left out, like the ones
+// hidden from the user by AttachVideos, keep their place and the listed ones fill the others
+func (p *Playlist) Reorder(conn *gorm.DB, entryIds []uint) error {
+	if len(entryIds) == 0 {
+		return fmt.Errorf("the new order is empty")
+	}
+	var listed = make([]PlaylistEntry, 0, len(entryIds))
+	for _, id := range entryIds {
+		var idx = slices.IndexFunc(p.Entries, func(e PlaylistEntry) bool { return e.Id == id })
+		if idx < 0 {
+			return fmt.Errorf("cannot find entry id=`%d` in playlist id=`%s`", id, p.Id)
+		}
+		if slices.ContainsFunc(listed, func(e PlaylistEntry) bool { return e.Id == id }) {
+			return fmt.Errorf("entry id=`%d` is repeated", id)
+		}
+		listed = append(listed, p.Entries[idx])
+	}
+	var entries = slices.Clone(p.Entries)
+	var next = 0
+	for i, e := range entries {
+		if slices.Contains(entryIds, e.Id) {
+			entries[i] = listed[next]
+			next++
+		}
+	}
+	if err := conn.Transaction(func(tx *gorm.DB) error {
+		return p.savePositions(tx, entries)
+	}); err != nil {
+		return err
+	}
+	p.Entries = entries
+	return nil
+}
+
+// touch updates the time of the last change, the entries are left alone
+func (p *Playlist) touch(tx *gorm.DB) error {
+	p.UpdatedAt = time.Now()
+	return tx.Model(&Playlist{}).Where("id = ?", p.Id).UpdateColumn("updated_at", p.UpdatedAt).Error
+}
+
+func (p *Playlist) savePositions(tx *gorm.DB, entries []PlaylistEntry) error {
+	for i := range entries {
+		if entries[i].Position == i {
+			continue
+		}
+		entries[i].Position = i
+		if err := tx.Model(&entries[i]).UpdateColumn("position", i).Error; err != nil {
+			return err
+		}
+	}
+	return p.touch(tx)
+}
+
+// AttachVideos fills the videos of the entries, the ones the user cannot access are left out
+func (p *Playlist) AttachVideos(conn *gorm.DB, user *User) error {
+	accessible, err := AccessibleFolders(conn, user)
+	if err != nil {
+		return err
+	}
+	var ids = make([]string, 0, len(p.Entries))
+	for _, e := range p.Entries {
+		ids = append(ids, e.VideoId)
+	}
+	found, err := attachVideos(conn, ids)
+	if err != nil {
+		return err
+	}
+	var entries = make([]PlaylistEntry, 0, len(p.Entries))
+	for _, e := range p.Entries {
+		if v, ok := found[e.VideoId]; ok && v.Folder != nil && accessible[v.Folder.Id] {
+			e.Video = v
+			entries = append(entries, e)
+		}
+	}
+	p.Entries = entries
+	return nil
+}
+
+func (*Playlist) GetGQLType() *graphql.Output {
+	return &gql_PlaylistType
+}
+
+var (
+	gql_PlaylistEntryType graphql.Output = graphql.NewObject(graphql.ObjectConfig{
+		Name: "GQLPlaylistEntry",
+		Fields: graphql.Fields{
+			"id":       &graphql.Field{Type: graphql.Int, Description: "Entry id, used to reorder and remove it"},
+			"videoId":  &graphql.Field{Type: graphql.String, Description: "Video id"},
+			"position": &graphql.Field{Type: graphql.Int, Description: "Position in the playlist, from 0"},
+			"video":    &graphql.Field{Type: gql_VideoType, Description: "Video, missing when the user cannot access it"},
+		},
+	})
+
+	gql_PlaylistType graphql.Output = graphql.NewObject(graphql.ObjectConfig{
+		Name: "GQLPlaylist",
+		Fields: graphql.Fields{
+			"id":          &graphql.Field{Type: graphql.String, Description: "Playlist id (Generated) follows pattern: l-%d"},
+			"ownerId":     &graphql.Field{Type: graphql.String, Description: "Id of the user owning the playlist"},
+			"name":        &graphql.Field{Type: graphql.String, Description: "Playlist name"},
+			"description": &graphql.Field{Type: graphql.String, Description: "Playlist description"},
+			"visibility":  &graphql.Field{Type: graphql.String, Description: "One of private, shared"},
+			"createdAt":   &graphql.Field{Type: graphql.DateTime, Description: "Creation time"},
+			"updatedAt":   &graphql.Field{Type: graphql.DateTime, Description: "Last change"},
+			"entries":     &graphql.Field{Type: graphql.NewList(gql_PlaylistEntryType), Description: "Videos in order"},
+		},
+	})
+)
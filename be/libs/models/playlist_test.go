@@ -0,0 +1,71 @@
+package models
+
+import (
+	"slices"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestPlaylistReorder(t *testing.T) {
+	var tests = []struct {
+		name     string
+		entryIds []uint
+		want     []uint
+		wantErr  bool
+	}{
+		{name: "every entry", entryIds: []uint{4, 3, 2, 1}, want: []uint{4, 3, 2, 1}},
+		{name: "same order", entryIds: []uint{1, 2, 3, 4}, want: []uint{1, 2, 3, 4}},
+		{name: "hidden entries keep their place", entryIds: []uint{3, 1}, want: []uint{3, 2, 1, 4}},
+		{name: "single entry", entryIds: []uint{2}, want: []uint{1, 2, 3, 4}},
+		{name: "unknown entry", entryIds: []uint{4, 3, 2, 9}, wantErr: true},
+		{name: "repeated entry", entryIds: []uint{1, 1, 2, 3}, wantErr: true},
+		{name: "empty order", entryIds: []uint{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := conn.AutoMigrate(&Playlist{}, &PlaylistEntry{}); err != nil {
+				t.Fatal(err)
+			}
+			var p = Playlist{Id: "l-1", OwnerId: "u-1", Name: "test", Visibility: PlaylistPrivate}
+			for i := range 4 {
+				p.Entries = append(p.Entries, PlaylistEntry{Id: uint(i + 1), VideoId: "v-1", Position: i})
+			}
+			if err := p.Create(conn); err != nil {
+				t.Fatal(err)
+			}
+
+			err = p.Reorder(conn, tt.entryIds)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Reorder(%v) error = %v, wantErr %v", tt.entryIds, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				tt.want = []uint{1, 2, 3, 4}
+			}
+
+			var got []uint
+			for _, e := range p.Entries {
+				got = append(got, e.Id)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Reorder(%v) entries = %v, want %v", tt.entryIds, got, tt.want)
+			}
+			stored, err := LoadPlaylist(conn, p.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = got[:0]
+			for _, e := range stored.Entries {
+				got = append(got, e.Id)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Reorder(%v) stored entries = %v, want %v", tt.entryIds, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultWatchedThreshold is the part of a video after which it counts as
+// watched, the credits are usually skipped
+const DefaultWatchedThreshold float64 = 0.9
+
+var watchedThreshold = DefaultWatchedThreshold
+
+// SetWatchedThreshold changes the part of a video to play before it counts as watched
+func SetWatchedThreshold(threshold float64) error {
+	if threshold <= 0 || threshold > 1 {
+		return fmt.Errorf("the watched threshold must be between 0 and 1, got %g", threshold)
+	}
+	watchedThreshold = threshold
+	return nil
+}
+
+// WatchProgress is where a user stopped watching a video
+type WatchProgress struct {
+	UserId   string        `json:"-" gorm:"primaryKey"`
+	VideoId  string        `json:"videoId" gorm:"primaryKey;index"`
+	Position time.Duration `json:"position"`
+	// Watched is the time spent playing the video, it keeps growing when a part is watched again
+	Watched     time.Duration `json:"watched"`
+	Completed   bool          `json:"completed"`
+	LastWatched time.Time     `json:"lastWatched" gorm:"index"`
+}
+
+// MarshalJSON writes the position and the watched time in seconds, like the GraphQL API
+func (p WatchProgress) MarshalJSON() ([]byte, error) {
+	type plain WatchProgress
+	return json.Marshal(struct {
+		plain
+		Position float64 `json:"position"`
+		Watched  float64 `json:"watched"`
+	}{plain(p), p.Position.Seconds(), p.Watched.Seconds()})
+}
+
+// Update moves the progress to position after elapsed time of playback, the
+// video is completed once the position goes past the watched threshold of its duration
+func (p *WatchProgress) Update(v *Video, position time.Duration, elapsed time.Duration) error {
+	if position < 0 {
+		return fmt.Errorf("position cannot be negative")
+	}
+	if elapsed < 0 {
+		return fmt.Errorf("elapsed time cannot be negative")
+	}
+	if v.Duration > 0 {
+		position = min(position, v.Duration)
+		if float64(position) >= float64(v.Duration)*watchedThreshold {
+			p.Completed = true
+		}
+	}
+	p.VideoId = v.Id
+	p.Position = position
+	p.Watched += elapsed
+	p.LastWatched = time.Now()
+	return nil
+}
+
+// Save stores the progress, replacing the previous one of the same user and video
+func (p *WatchProgress) Save(conn *gorm.DB) error {
+	if len(p.UserId) == 0 || len(p.VideoId) == 0 {
+		return fmt.Errorf("progress without user or video")
+	}
+	return conn.Clauses(clause.OnConflict{UpdateAll: true}).Create(p).Error
+}
+
+// SetWatched changes the watched flag of the video shared by every user, only
+// the administrators and the progress reaching the watched threshold change it
+func (v *Video) SetWatched(conn *gorm.DB, watched bool) error {
+	if tx := conn.Model(v).UpdateColumn("attr_watched", watched); tx.Error != nil {
+		return tx.Error
+	}
+	v.Attributes.Watched = watched
+	return nil
+}
+
+// MarkWatched marks the video as watched or not for the user: the progress of
+// the user is completed or rewound to the start, the flag of the video is kept
+func MarkWatched(conn *gorm.DB, v *Video, user *User, watched bool) (*WatchProgress, error) {
+	if user == nil {
+		return nil, ErrLoginRequired
+	}
+	progress, err := LoadProgress(conn, user.Id, v.Id)
+	if err != nil {
+		return nil, err
+	}
+	progress.Completed = watched
+	if !watched {
+		progress.Position = 0
+	}
+	progress.LastWatched = time.Now()
+	if err := progress.Save(conn); err != nil {
+		return nil, err
+	}
+	return progress, nil
+}
+
+// LoadProgress returns the progress of the user on the video, an empty one when it was never watched
+func LoadProgress(conn *gorm.DB, userId string, videoId string) (*WatchProgress, error) {
+	var found []WatchProgress
+	if tx := conn.Limit(1).Find(&found, WatchProgress{UserId: userId, VideoId: videoId}); tx.Error != nil {
+		return nil, tx.Error
+	}
+	if len(found) == 0 {
+		return &WatchProgress{UserId: userId, VideoId: videoId}, nil
+	}
+	return &found[0], nil
+}
+
+// ProgressOf returns the progress of the user on every video watched, by video id
+func ProgressOf(conn *gorm.DB, userId string) (map[string]WatchProgress, error) {
+	var found []WatchProgress
+	if tx := conn.Find(&found, WatchProgress{UserId: userId}); tx.Error != nil {
+		return nil, tx.Error
+	}
+	var out = make(map[string]WatchProgress, len(found))
+	for _, p := range found {
+		out[p.VideoId] = p
+	}
+	return out, nil
+}
+
+func (*WatchProgress) GetGQLType() *graphql.Output {
+	return &gql_WatchProgressType
+}
+
+func gqlProgressResolver(fn func(p *WatchProgress) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		switch wp := p.Source.(type) {
+		case WatchProgress:
+			return fn(&wp), nil
+		case *WatchProgress:
+			return fn(wp), nil
+		}
+		return nil, nil
+	}
+}
+
+var (
+	gql_WatchProgressType graphql.Output = graphql.NewObject(graphql.ObjectConfig{
+		Name: "GQLWatchProgress",
+		Fields: graphql.Fields{
+			"videoId": &graphql.Field{Type: graphql.String, Description: "Video id"},
+			"position": &graphql.Field{
+				Type:        graphql.Float,
+				Description: "Position where the user stopped (seconds)",
+				Resolve: gqlProgressResolver(func(p *WatchProgress) any {
+					return p.Position.Seconds()
+				}),
+			},
+			"watched": &graphql.Field{
+				Type:        graphql.Float,
+				Description: "Time spent playing the video (seconds)",
+				Resolve: gqlProgressResolver(func(p *WatchProgress) any {
+					return p.Watched.Seconds()
+				}),
+			},
+			"completed":   &graphql.Field{Type: graphql.Boolean, Description: "Did the user reach the end of the video?"},
+			"lastWatched": &graphql.Field{Type: graphql.DateTime, Description: "Last time the user played the video"},
+		},
+	})
+)
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"gorm.io/gorm"
+)
+
+// DefaultExclude lists the folders created by NAS, trash bins and file systems,
+// they never hold anything worth scanning
+var DefaultExclude = []string{"@eaDir", "#recycle", "#snapshot", "$RECYCLE.BIN", "System Volume Information", "lost+found"}
+
+// ScanRules limits what is scanned inside a registered folder.
+// They are stored in their own table because Folder is embedded in videos and pictures
+type ScanRules struct {
+	FolderId string `json:"-" gorm:"primaryKey"`
+	// Include, when not empty, keeps only the files matching at least one pattern
+	Include []string `json:"include,omitempty" gorm:"serializer:json"`
+	// Exclude skips the files and the folders matching any pattern
+	Exclude []string `json:"exclude,omitempty" gorm:"serializer:json"`
+	// MaxDepth is the number of folder levels scanned, 1 means only the files
+	// directly inside the folder and 0 means no limit
+	MaxDepth      int  `json:"maxDepth,omitempty"`
+	IncludeHidden bool `json:"includeHidden"`
+	SkipSymlinks  bool `json:"skipSymlinks"`
+}
+
+func DefaultScanRules() *ScanRules {
+	return &ScanRules{Exclude: DefaultExclude}
+}
+
+// Validate checks the syntax of every pattern
+func (r *ScanRules) Validate() error {
+	for _, p := range slices.Concat(r.Include, r.Exclude) {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid pattern `%s`: %w", p, err)
+		}
+	}
+	if r.MaxDepth < 0 {
+		return fmt.Errorf("max depth cannot be negative")
+	}
+	return nil
+}
+
+// matches reports whether any pattern matches the entry, patterns without a
+// separator are checked against the name, the others against the path relative to the folder
+func matches(patterns []string, rel string) bool {
+	var name = filepath.Base(rel)
+	for _, p := range patterns {
+		var target = name
+		if strings.ContainsRune(p, '/') {
+			target = filepath.ToSlash(rel)
+		}
+		if ok, _ := filepath.Match(p, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// allows checks a single entry, rel is its path relative to the folder
+func (r *ScanRules) allows(rel string, isDir bool) bool {
+	var name = filepath.Base(rel)
+	if !r.IncludeHidden && strings.HasPrefix(name, ".") {
+		return false
+	}
+	if matches(r.Exclude, rel) {
+		return false
+	}
+
+	var depth = strings.Count(filepath.ToSlash(rel), "/") + 1
+	if isDir {
+		return r.MaxDepth == 0 || depth < r.MaxDepth
+	}
+	if r.MaxDepth > 0 && depth > r.MaxDepth {
+		return false
+	}
+	return len(r.Include) == 0 || matches(r.Include, rel)
+}
+
+// Save stores the rules of the folder, replacing the previous ones
+func (r *ScanRules) Save(conn *gorm.DB) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	return conn.Save(r).Error
+}
+
+// AfterDelete removes the scan rules together with the folder
+func (f *Folder) AfterDelete(tx *gorm.DB) error {
+	if len(f.Id) == 0 {
+		return nil
+	}
+	return tx.Where("folder_id = ?", f.Id).Delete(&ScanRules{}).Error
+}
+
+// LoadFolders finds the folders matching conds together with their scan rules
+func LoadFolders(conn *gorm.DB, conds ...any) ([]Folder, error) {
+	var folders []Folder
+	if tx := conn.Find(&folders, conds...); tx.Error != nil {
+		return nil, tx.Error
+	}
+	if len(folders) == 0 {
+		return folders, nil
+	}
+
+	var ids = make([]string, 0, len(folders))
+	for _, f := range folders {
+		ids = append(ids, f.Id)
+	}
+	var rules []ScanRules
+	if tx := conn.Where("folder_id IN ?", ids).Find(&rules); tx.Error != nil {
+		return nil, tx.Error
+	}
+	var byFolder = make(map[string]*ScanRules, len(rules))
+	for idx := range rules {
+		byFolder[rules[idx].FolderId] = &rules[idx]
+	}
+	for idx := range folders {
+		folders[idx].Rules = byFolder[folders[idx].Id]
+	}
+	return folders, nil
+}
+
+func (*ScanRules) GetGQLType() *graphql.Output {
+	return &gql_ScanRulesType
+}
+
+var (
+	gql_ScanRulesType graphql.Output = graphql.NewObject(graphql.ObjectConfig{
+		Name: "GQLScanRules",
+		Fields: graphql.Fields{
+			"include":       &graphql.Field{Type: graphql.NewList(graphql.String), Description: "Glob patterns of the files to keep"},
+			"exclude":       &graphql.Field{Type: graphql.NewList(graphql.String), Description: "Glob patterns of the files and folders to skip"},
+			"maxDepth":      &graphql.Field{Type: graphql.Int, Description: "Number of folder levels scanned, 0 means no limit"},
+			"includeHidden": &graphql.Field{Type: graphql.Boolean, Description: "Are hidden files and folders scanned?"},
+			"skipSymlinks":  &graphql.Field{Type: graphql.Boolean, Description: "Are symbolic links ignored?"},
+		},
+	})
+)
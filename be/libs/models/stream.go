@@ -0,0 +1,254 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/vansante/go-ffprobe"
+	"gorm.io/gorm"
+)
+
+const (
+	StreamTypeVideo    string = "video"
+	StreamTypeAudio    string = "audio"
+	StreamTypeSubtitle string = "subtitle"
+)
+
+type VideoStream struct {
+	Id            string  `json:"id" gorm:"primaryKey"`
+	VideoId       string  `json:"-" gorm:"index"`
+	Index         int     `json:"index"`
+	Type          string  `json:"type" gorm:"index"`
+	Codec         string  `json:"codec"`
+	Profile       string  `json:"profile,omitempty"`
+	Width         int     `json:"width,omitempty"`
+	Height        int     `json:"height,omitempty"`
+	FrameRate     float64 `json:"frameRate,omitempty"`
+	BitRate       int64   `json:"bitRate,omitempty"`
+	Channels      int     `json:"channels,omitempty"`
+	ChannelLayout string  `json:"channelLayout,omitempty"`
+	Language      string  `json:"language,omitempty"`
+	Default       bool    `json:"default"`
+	Forced        bool    `json:"forced"`
+	// HearingImpaired marks the subtitle streams describing the sounds too
+	HearingImpaired bool `json:"hearingImpaired,omitempty"`
+}
+
+func streamId(videoId string, index int) string {
+	return fmt.Sprintf("s-%d", hashFromString(fmt.Sprintf("%s#%d", videoId, index)))
+}
+
+// LinkStreams points the streams to the current id of the video, the stream
+// ids are derived from it and change with it
+func (v *Video) LinkStreams() {
+	for i := range v.Streams {
+		v.Streams[i].VideoId = v.Id
+		v.Streams[i].Id = streamId(v.Id, v.Streams[i].Index)
+	}
+}
+
+func NewVideoStream(videoId string, s *ffprobe.Stream) VideoStream {
+	bitRate, _ := strconv.ParseInt(s.BitRate, 10, 64)
+	return VideoStream{
+		Id:              streamId(videoId, s.Index),
+		VideoId:         videoId,
+		Index:           s.Index,
+		Type:            s.CodecType,
+		Codec:           s.CodecName,
+		Profile:         s.Profile,
+		Width:           s.Width,
+		Height:          s.Height,
+		FrameRate:       parseFrameRate(s.AvgFrameRate),
+		BitRate:         bitRate,
+		Channels:        s.Channels,
+		ChannelLayout:   s.ChannelLayout,
+		Language:        s.Tags.Language,
+		Default:         s.Disposition.Default == 1,
+		Forced:          s.Disposition.Forced == 1,
+		HearingImpaired: s.Disposition.HearingImpaired == 1,
+	}
+}
+
+// parseFrameRate converts the ffprobe fractions like "30000/1001" to a number
+func parseFrameRate(rate string) float64 {
+	num, den, found := strings.Cut(rate, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	if !found {
+		return n
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+// ReplaceStreams stores the probed streams of v, removing the previous ones
+func (v *Video) ReplaceStreams(conn *gorm.DB) error {
+	return conn.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("video_id = ?", v.Id).Delete(&VideoStream{}).Error; err != nil {
+			return err
+		}
+		if len(v.Streams) == 0 {
+			return nil
+		}
+		return tx.Create(&v.Streams).Error
+	})
+}
+
+// AfterDelete removes the streams, the subtitles, the tags, the playlist entries,
+// the progress and the history together with the video
+func (v *Video) AfterDelete(tx *gorm.DB) error {
+	if len(v.Id) == 0 {
+		return nil
+	}
+	if err := tx.Where("video_id = ?", v.Id).Delete(&VideoStream{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("video_id = ?", v.Id).Delete(&Subtitle{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("video_id = ?", v.Id).Delete(&VideoTag{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("video_id = ?", v.Id).Delete(&PlaylistEntry{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("video_id = ?", v.Id).Delete(&WatchProgress{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("video_id = ?", v.Id).Delete(&HistoryEntry{}).Error
+}
+
+func (v *Video) StreamsOf(streamType string) (streams []VideoStream) {
+	for _, s := range v.Streams {
+		if s.Type == streamType {
+			streams = append(streams, s)
+		}
+	}
+	return
+}
+
+// MainVideoStream returns the default video stream, or the first one
+func (v *Video) MainVideoStream() *VideoStream {
+	var streams = v.StreamsOf(StreamTypeVideo)
+	if len(streams) == 0 {
+		return nil
+	}
+	if idx := slices.IndexFunc(streams, func(s VideoStream) bool { return s.Default }); idx >= 0 {
+		return &streams[idx]
+	}
+	return &streams[0]
+}
+
+// MainAudioStream returns the default audio stream, or the first one
+func (v *Video) MainAudioStream() *VideoStream {
+	var streams = v.StreamsOf(StreamTypeAudio)
+	if len(streams) == 0 {
+		return nil
+	}
+	if idx := slices.IndexFunc(streams, func(s VideoStream) bool { return s.Default }); idx >= 0 {
+		return &streams[idx]
+	}
+	return &streams[0]
+}
+
+// AudioStream returns the audio stream with the given index inside the container
+func (v *Video) AudioStream(index int) *VideoStream {
+	var streams = v.StreamsOf(StreamTypeAudio)
+	if idx := slices.IndexFunc(streams, func(s VideoStream) bool { return s.Index == index }); idx >= 0 {
+		return &streams[idx]
+	}
+	return nil
+}
+
+// AudioStreamIn returns the audio stream in the given language, the default
+// one when more streams match
+func (v *Video) AudioStreamIn(language string) *VideoStream {
+	var streams = slices.DeleteFunc(v.StreamsOf(StreamTypeAudio), func(s VideoStream) bool { return !SameLanguage(s.Language, language) })
+	if len(streams) == 0 {
+		return nil
+	}
+	if idx := slices.IndexFunc(streams, func(s VideoStream) bool { return s.Default }); idx >= 0 {
+		return &streams[idx]
+	}
+	return &streams[0]
+}
+
+// Resolution returns a label like "1080p" for the main video stream
+func (v *Video) Resolution() string {
+	var s = v.MainVideoStream()
+	if s == nil || s.Height == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%dp", s.Height)
+}
+
+type StreamFilter struct {
+	VideoCodec       string
+	AudioCodec       string
+	MinHeight        int
+	AudioLanguage    string
+	SubtitleLanguage string
+}
+
+func (f StreamFilter) IsEmpty() bool {
+	return f == StreamFilter{}
+}
+
+// Match reports whether the streams of v satisfy every field set in the filter
+func (f StreamFilter) Match(v *Video) bool {
+	var hasStream = func(streamType string, check func(s VideoStream) bool) bool {
+		return slices.ContainsFunc(v.StreamsOf(streamType), check)
+	}
+
+	if len(f.VideoCodec) > 0 && !hasStream(StreamTypeVideo, func(s VideoStream) bool { return strings.EqualFold(s.Codec, f.VideoCodec) }) {
+		return false
+	}
+	if len(f.AudioCodec) > 0 && !hasStream(StreamTypeAudio, func(s VideoStream) bool { return strings.EqualFold(s.Codec, f.AudioCodec) }) {
+		return false
+	}
+	if f.MinHeight > 0 && !hasStream(StreamTypeVideo, func(s VideoStream) bool { return s.Height >= f.MinHeight }) {
+		return false
+	}
+	if len(f.AudioLanguage) > 0 && !hasStream(StreamTypeAudio, func(s VideoStream) bool { return strings.EqualFold(s.Language, f.AudioLanguage) }) {
+		return false
+	}
+	if len(f.SubtitleLanguage) > 0 && !hasStream(StreamTypeSubtitle, func(s VideoStream) bool { return strings.EqualFold(s.Language, f.SubtitleLanguage) }) {
+		return false
+	}
+	return true
+}
+
+func (*VideoStream) GetGQLType() *graphql.Output {
+	return &gql_VideoStreamType
+}
+
+var (
+	gql_VideoStreamType graphql.Output = graphql.NewObject(graphql.ObjectConfig{
+		Name: "GQLVideoStream",
+		Fields: graphql.Fields{
+			"id":              &graphql.Field{Type: graphql.String, Description: "Stream id (Generated) follows pattern: s-%d"},
+			"index":           &graphql.Field{Type: graphql.Int, Description: "Stream index inside the container"},
+			"type":            &graphql.Field{Type: graphql.String, Description: "One of video, audio, subtitle"},
+			"codec":           &graphql.Field{Type: graphql.String, Description: "Codec name"},
+			"profile":         &graphql.Field{Type: graphql.String, Description: "Codec profile"},
+			"width":           &graphql.Field{Type: graphql.Int, Description: "Width (Pixel)"},
+			"height":          &graphql.Field{Type: graphql.Int, Description: "Height (Pixel)"},
+			"frameRate":       &graphql.Field{Type: graphql.Float, Description: "Average frame rate"},
+			"bitRate":         &graphql.Field{Type: graphql.Float, Description: "Bit rate (bit/s)"},
+			"channels":        &graphql.Field{Type: graphql.Int, Description: "Audio channels"},
+			"channelLayout":   &graphql.Field{Type: graphql.String, Description: "Audio channel layout"},
+			"language":        &graphql.Field{Type: graphql.String, Description: "Stream language"},
+			"default":         &graphql.Field{Type: graphql.Boolean, Description: "Is it the default stream?"},
+			"forced":          &graphql.Field{Type: graphql.Boolean, Description: "Is it a forced stream?"},
+			"hearingImpaired": &graphql.Field{Type: graphql.Boolean, Description: "Does the subtitle stream describe the sounds too?"},
+		},
+	})
+)
@@ -0,0 +1,420 @@
+package models
+
+import (
+	"fmt"
+	"full/libs/media"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/graphql-go/graphql"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// SubtitleExtensions are the sidecar files attached to the videos
+var SubtitleExtensions = []string{".srt", ".vtt", ".ass", ".ssa"}
+
+// Subtitle codecs ffmpeg converts to WebVTT, the image based ones like PGS
+// and VobSub would need OCR
+var textSubtitleCodecs = []string{"subrip", "srt", "ass", "ssa", "webvtt", "mov_text", "text", "microdvd", "subviewer", "jacosub", "realtext", "sami"}
+
+const (
+	SubtitleSourceSidecar  string = "sidecar"
+	SubtitleSourceEmbedded string = "embedded"
+)
+
+// subtitleFolders are the folder names holding the subtitles of the videos next to them
+var subtitleFolders = []string{"subs", "subtitles", "sub"}
+
+// Subtitle is a sidecar subtitle file of a video
+type Subtitle struct {
+	Id       string `json:"id" gorm:"primaryKey"`
+	VideoId  string `json:"-" gorm:"index"`
+	FilePath string `json:"filePath"`
+	// Format is the extension of the file, like srt or ass
+	Format          string `json:"format"`
+	Language        string `json:"language,omitempty"`
+	Label           string `json:"label"`
+	Default         bool   `json:"default"`
+	Forced          bool   `json:"forced"`
+	HearingImpaired bool   `json:"hearingImpaired"`
+}
+
+func IsSubtitle(file string) bool {
+	return slices.Contains(SubtitleExtensions, strings.ToLower(filepath.Ext(file)))
+}
+
+// Url is the endpoint serving the subtitle as WebVTT
+func (s *Subtitle) Url() string {
+	return fmt.Sprintf("/video/subtitles/%s/%s", s.VideoId, s.Id)
+}
+
+func subtitleId(videoId string, file string) string {
+	return fmt.Sprintf("t-%d", hashFromString(videoId+"#"+file))
+}
+
+// newSubtitle builds the subtitle from its file name, tags are the dot
+// separated parts after the video name, like [en forced] for movie.en.forced.srt
+func newSubtitle(videoId string, file string, tags []string) Subtitle {
+	var s = Subtitle{
+		Id:       subtitleId(videoId, file),
+		VideoId:  videoId,
+		FilePath: file,
+		Format:   strings.TrimPrefix(strings.ToLower(filepath.Ext(file)), "."),
+	}
+
+	var extra []string
+	for _, tag := range tags {
+		// Release folders number the files, like Subs/Movie/2_English.srt
+		tag = strings.TrimLeftFunc(tag, func(r rune) bool { return unicode.IsDigit(r) || r == '_' || r == ' ' })
+		switch strings.ToLower(tag) {
+		case "":
+		case "forced", "foreign":
+			s.Forced = true
+		case "sdh", "cc":
+			s.HearingImpaired = true
+		case "default":
+			s.Default = true
+		default:
+			if code, ok := NormalizeLanguage(tag); ok && len(s.Language) == 0 {
+				s.Language = code
+				continue
+			}
+			extra = append(extra, tag)
+		}
+	}
+
+	var label = "Unknown"
+	if len(s.Language) > 0 {
+		label = LanguageName(s.Language)
+	}
+	if len(extra) > 0 {
+		label += " - " + strings.Join(extra, " ")
+	}
+	if s.Forced {
+		label += " (Forced)"
+	}
+	if s.HearingImpaired {
+		label += " (SDH)"
+	}
+	s.Label = label
+	return s
+}
+
+// subtitleTags returns the tags of a subtitle file named after the video, like
+// movie.en.srt for movie.mkv. It fails when the file belongs to another video
+func subtitleTags(base string, file string) ([]string, bool) {
+	var name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	if name == base {
+		return nil, true
+	}
+	if !strings.HasPrefix(name, base+".") {
+		return nil, false
+	}
+	return strings.Split(strings.TrimPrefix(name, base+"."), "."), true
+}
+
+// subtitleListing holds the files of a folder the subtitles of its videos are
+// chosen from, the folder and its Subs folders are read only once for all the videos
+type subtitleListing struct {
+	// videos counts the video files of the folder
+	videos int
+	// files are the subtitles next to the videos
+	files []string
+	// subFiles are the subtitles directly inside the Subs folders
+	subFiles []string
+	// named are the subtitles inside Subs/<video name>, by video name
+	named map[string][]string
+}
+
+func listSubtitles(dir string) *subtitleListing {
+	var l = &subtitleListing{named: map[string][]string{}}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Err(err).Str("path", dir).Send()
+		return l
+	}
+
+	var subDirs []string
+	for _, e := range entries {
+		var file = filepath.Join(dir, e.Name())
+		switch {
+		case e.IsDir() && slices.Contains(subtitleFolders, strings.ToLower(e.Name())):
+			subDirs = append(subDirs, file)
+		case e.IsDir():
+		case IsSubtitle(file):
+			l.files = append(l.files, file)
+		case isVideoExtension(file):
+			l.videos++
+		}
+	}
+
+	for _, subDir := range subDirs {
+		entries, err := os.ReadDir(subDir)
+		if err != nil {
+			log.Err(err).Str("path", subDir).Send()
+			continue
+		}
+		for _, e := range entries {
+			var file = filepath.Join(subDir, e.Name())
+			switch {
+			case e.IsDir():
+				l.named[e.Name()] = append(l.named[e.Name()], readSubtitleDir(file)...)
+			case IsSubtitle(file):
+				l.subFiles = append(l.subFiles, file)
+			}
+		}
+	}
+	return l
+}
+
+// FindSubtitles looks for the sidecar subtitles of the video: the files named
+// after it, both next to it and inside a Subs folder, the files inside Subs/<video name>
+// and, when the video is alone in its folder, every file inside Subs
+func (v *Video) FindSubtitles() []Subtitle {
+	return v.subtitlesIn(listSubtitles(filepath.Dir(v.FilePath)))
+}
+
+// subtitlesIn picks the subtitles of the video from the listing of its folder
+func (v *Video) subtitlesIn(l *subtitleListing) []Subtitle {
+	var base = strings.TrimSuffix(filepath.Base(v.FilePath), filepath.Ext(v.FilePath))
+
+	var out []Subtitle
+	var add = func(file string, tags []string) {
+		if !slices.ContainsFunc(out, func(s Subtitle) bool { return s.FilePath == file }) {
+			out = append(out, newSubtitle(v.Id, file, tags))
+		}
+	}
+
+	// The video itself is part of the count when its extension is known
+	var others = l.videos
+	if isVideoExtension(v.FilePath) {
+		others--
+	}
+	for _, file := range l.files {
+		if tags, ok := subtitleTags(base, file); ok {
+			add(file, tags)
+		}
+	}
+	for _, file := range l.subFiles {
+		if tags, ok := subtitleTags(base, file); ok {
+			add(file, tags)
+		} else if others <= 0 {
+			var name = filepath.Base(file)
+			add(file, strings.Split(strings.TrimSuffix(name, filepath.Ext(name)), "."))
+		}
+	}
+	for _, file := range l.named[base] {
+		add(file, []string{strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))})
+	}
+
+	slices.SortFunc(out, func(a, b Subtitle) int { return strings.Compare(a.FilePath, b.FilePath) })
+	return out
+}
+
+// LinkSubtitles points the subtitles to the current id of the video, the
+// subtitle ids are derived from it and change with it
+func (v *Video) LinkSubtitles() {
+	for i := range v.Subtitles {
+		v.Subtitles[i].VideoId = v.Id
+		v.Subtitles[i].Id = subtitleId(v.Id, v.Subtitles[i].FilePath)
+	}
+}
+
+// isVideoExtension checks only the extension, sniffing every file of the folder would be too slow
+func isVideoExtension(file string) bool {
+	t, ok := media.Lookup(file)
+	return ok && t.Kind == media.KindVideo
+}
+
+func readSubtitleDir(dir string) (files []string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Err(err).Str("path", dir).Send()
+		return nil
+	}
+	for _, e := range entries {
+		if !e.IsDir() && IsSubtitle(e.Name()) {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	return
+}
+
+// SyncSubtitles stores the sidecar subtitles found on disk, it reports whether they changed
+func (v *Video) SyncSubtitles(conn *gorm.DB) (bool, error) {
+	if tx := conn.Where("video_id = ?", v.Id).Find(&v.Subtitles); tx.Error != nil {
+		return false, tx.Error
+	}
+	return v.UpdateSubtitles(conn, v.FindSubtitles())
+}
+
+// UpdateSubtitles replaces the stored v.Subtitles with found when they differ,
+// it reports whether they changed
+func (v *Video) UpdateSubtitles(conn *gorm.DB, found []Subtitle) (bool, error) {
+	var stored = slices.Clone(v.Subtitles)
+	slices.SortFunc(stored, func(a, b Subtitle) int { return strings.Compare(a.FilePath, b.FilePath) })
+	if slices.Equal(found, stored) {
+		return false, nil
+	}
+	v.Subtitles = found
+	return true, v.ReplaceSubtitles(conn)
+}
+
+// ReplaceSubtitles stores v.Subtitles, removing the previous ones
+func (v *Video) ReplaceSubtitles(conn *gorm.DB) error {
+	return conn.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("video_id = ?", v.Id).Delete(&Subtitle{}).Error; err != nil {
+			return err
+		}
+		if len(v.Subtitles) == 0 {
+			return nil
+		}
+		for idx := range v.Subtitles {
+			v.Subtitles[idx].VideoId = v.Id
+		}
+		return tx.Create(&v.Subtitles).Error
+	})
+}
+
+// IsTextSubtitle reports whether the subtitle stream can be converted to WebVTT
+func (s *VideoStream) IsTextSubtitle() bool {
+	return s.Type == StreamTypeSubtitle && slices.Contains(textSubtitleCodecs, strings.ToLower(s.Codec))
+}
+
+// SubtitleTrack is a subtitle the player can choose, either a sidecar file or
+// a stream embedded in the container
+type SubtitleTrack struct {
+	Id string `json:"id"`
+	// Source is either sidecar or embedded
+	Source          string `json:"source"`
+	Format          string `json:"format"`
+	Language        string `json:"language,omitempty"`
+	Label           string `json:"label"`
+	Default         bool   `json:"default"`
+	Forced          bool   `json:"forced"`
+	HearingImpaired bool   `json:"hearingImpaired"`
+	// Supported is false for the image based streams, they have no url
+	Supported bool   `json:"supported"`
+	Url       string `json:"url,omitempty"`
+}
+
+// SubtitleTracks lists the sidecar subtitles followed by the subtitle streams of the container
+func (v *Video) SubtitleTracks() []SubtitleTrack {
+	var out []SubtitleTrack
+	for _, s := range v.Subtitles {
+		out = append(out, SubtitleTrack{
+			Id:              s.Id,
+			Source:          SubtitleSourceSidecar,
+			Format:          s.Format,
+			Language:        s.Language,
+			Label:           s.Label,
+			Default:         s.Default,
+			Forced:          s.Forced,
+			HearingImpaired: s.HearingImpaired,
+			Supported:       true,
+			Url:             s.Url(),
+		})
+	}
+
+	var streams = v.StreamsOf(StreamTypeSubtitle)
+	slices.SortFunc(streams, func(a, b VideoStream) int { return a.Index - b.Index })
+	for idx, s := range streams {
+		var t = SubtitleTrack{
+			Id:              s.Id,
+			Source:          SubtitleSourceEmbedded,
+			Format:          s.Codec,
+			Default:         s.Default,
+			Forced:          s.Forced,
+			HearingImpaired: s.HearingImpaired,
+			Supported:       s.IsTextSubtitle(),
+		}
+		var label = fmt.Sprintf("Track %d", idx+1)
+		if code, ok := NormalizeLanguage(s.Language); ok {
+			t.Language = code
+			label = LanguageName(code)
+		} else if len(s.Language) > 0 && s.Language != "und" {
+			label = s.Language
+		}
+		if t.Forced {
+			label += " (Forced)"
+		}
+		if t.HearingImpaired {
+			label += " (SDH)"
+		}
+		t.Label = label
+		if t.Supported {
+			t.Url = fmt.Sprintf("/video/subtitles/%s/%s", v.Id, s.Id)
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// FindSubtitle returns the subtitle of the video with the given id
+func FindSubtitle(conn *gorm.DB, videoId string, id string) (*Subtitle, error) {
+	var found []Subtitle
+	if tx := conn.Where("video_id = ? AND id = ?", videoId, id).Find(&found); tx.Error != nil {
+		return nil, tx.Error
+	}
+	if len(found) != 1 {
+		return nil, fmt.Errorf("cannot find subtitle with id=`%s` for video id=`%s`", id, videoId)
+	}
+	return &found[0], nil
+}
+
+func (*Subtitle) GetGQLType() *graphql.Output {
+	return &gql_SubtitleType
+}
+
+func (*SubtitleTrack) GetGQLType() *graphql.Output {
+	return &gql_SubtitleTrackType
+}
+
+var (
+	gql_SubtitleType graphql.Output = graphql.NewObject(graphql.ObjectConfig{
+		Name: "GQLSubtitle",
+		Fields: graphql.Fields{
+			"id":              &graphql.Field{Type: graphql.String, Description: "Subtitle id (Generated) follows pattern: t-%d"},
+			"filePath":        &graphql.Field{Type: graphql.String, Description: "File path in the file system"},
+			"format":          &graphql.Field{Type: graphql.String, Description: "Format of the file, like srt or ass"},
+			"language":        &graphql.Field{Type: graphql.String, Description: "ISO 639-1 language code, like en"},
+			"label":           &graphql.Field{Type: graphql.String, Description: "Name to show to the user"},
+			"default":         &graphql.Field{Type: graphql.Boolean, Description: "Is it the default track?"},
+			"forced":          &graphql.Field{Type: graphql.Boolean, Description: "Does it only translate the foreign parts?"},
+			"hearingImpaired": &graphql.Field{Type: graphql.Boolean, Description: "Does it describe the sounds too?"},
+			"url": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Url of the WebVTT track",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					switch s := p.Source.(type) {
+					case Subtitle:
+						return s.Url(), nil
+					case *Subtitle:
+						return s.Url(), nil
+					}
+					return nil, nil
+				},
+			},
+		},
+	})
+
+	gql_SubtitleTrackType graphql.Output = graphql.NewObject(graphql.ObjectConfig{
+		Name: "GQLSubtitleTrack",
+		Fields: graphql.Fields{
+			"id":              &graphql.Field{Type: graphql.String, Description: "Id of the subtitle file (t-%d) or of the stream (s-%d)"},
+			"source":          &graphql.Field{Type: graphql.String, Description: "One of sidecar, embedded"},
+			"format":          &graphql.Field{Type: graphql.String, Description: "Extension of the file or codec of the stream"},
+			"language":        &graphql.Field{Type: graphql.String, Description: "ISO 639-1 language code, like en"},
+			"label":           &graphql.Field{Type: graphql.String, Description: "Name to show to the user"},
+			"default":         &graphql.Field{Type: graphql.Boolean, Description: "Is it the default track?"},
+			"forced":          &graphql.Field{Type: graphql.Boolean, Description: "Does it only translate the foreign parts?"},
+			"hearingImpaired": &graphql.Field{Type: graphql.Boolean, Description: "Does it describe the sounds too?"},
+			"supported":       &graphql.Field{Type: graphql.Boolean, Description: "Can it be converted to WebVTT? Image based streams like PGS cannot"},
+			"url":             &graphql.Field{Type: graphql.String, Description: "Url of the WebVTT track, when it is supported"},
+		},
+	})
+)
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSubtitleTags(t *testing.T) {
+	var tests = []struct {
+		name     string
+		base     string
+		file     string
+		wantTags []string
+		wantOk   bool
+	}{
+		{name: "same name", base: "movie", file: "/v/movie.srt", wantTags: nil, wantOk: true},
+		{name: "language", base: "movie", file: "/v/movie.en.srt", wantTags: []string{"en"}, wantOk: true},
+		{name: "many tags", base: "movie", file: "/v/Subs/movie.en.forced.srt", wantTags: []string{"en", "forced"}, wantOk: true},
+		{name: "dots in the video name", base: "the.movie.2020", file: "/v/the.movie.2020.ita.srt", wantTags: []string{"ita"}, wantOk: true},
+		{name: "other video", base: "movie", file: "/v/other.en.srt", wantOk: false},
+		{name: "longer name", base: "movie", file: "/v/movie2.en.srt", wantOk: false},
+		{name: "shorter name", base: "movie.part2", file: "/v/movie.en.srt", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tags, ok := subtitleTags(tt.base, tt.file)
+			if ok != tt.wantOk || !slices.Equal(tags, tt.wantTags) {
+				t.Errorf("subtitleTags(%q, %q) = %q %v, want %q %v", tt.base, tt.file, tags, ok, tt.wantTags, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestNewSubtitle(t *testing.T) {
+	var tests = []struct {
+		name string
+		file string
+		tags []string
+		want Subtitle
+	}{
+		{
+			name: "no tags",
+			file: "/v/movie.srt",
+			want: Subtitle{Format: "srt", Label: "Unknown"},
+		},
+		{
+			name: "language code",
+			file: "/v/movie.en.srt",
+			tags: []string{"en"},
+			want: Subtitle{Format: "srt", Language: "en", Label: "English"},
+		},
+		{
+			name: "language name and flags",
+			file: "/v/movie.Italian.forced.sdh.ASS",
+			tags: []string{"Italian", "forced", "sdh"},
+			want: Subtitle{Format: "ass", Language: "it", Label: "Italian (Forced) (SDH)", Forced: true, HearingImpaired: true},
+		},
+		{
+			name: "numbered release file",
+			file: "/v/Subs/movie/2_English.srt",
+			tags: []string{"2_English"},
+			want: Subtitle{Format: "srt", Language: "en", Label: "English"},
+		},
+		{
+			name: "extra tags",
+			file: "/v/movie.eng.commentary.default.vtt",
+			tags: []string{"eng", "commentary", "default"},
+			want: Subtitle{Format: "vtt", Language: "en", Label: "English - commentary", Default: true},
+		},
+		{
+			name: "first language wins",
+			file: "/v/movie.fre.ger.srt",
+			tags: []string{"fre", "ger"},
+			want: Subtitle{Format: "srt", Language: "fr", Label: "French - ger"},
+		},
+		{
+			name: "foreign and cc",
+			file: "/v/movie.foreign.cc.srt",
+			tags: []string{"foreign", "cc"},
+			want: Subtitle{Format: "srt", Label: "Unknown (Forced) (SDH)", Forced: true, HearingImpaired: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got = newSubtitle("v-1", tt.file, tt.tags)
+			var want = tt.want
+			want.Id = subtitleId("v-1", tt.file)
+			want.VideoId = "v-1"
+			want.FilePath = tt.file
+			if got != want {
+				t.Errorf("newSubtitle(%q, %q) = %+v, want %+v", tt.file, tt.tags, got, want)
+			}
+		})
+	}
+}
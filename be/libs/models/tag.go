@@ -0,0 +1,345 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const MaxTagName int = 64
+
+// TagChange is the way ChangeTags applies the given tags
+type TagChange int
+
+const (
+	// TagsReplace drops the current tags, the given ones take their place
+	TagsReplace TagChange = iota
+	// TagsAdd keeps the current tags and adds the given ones
+	TagsAdd
+	// TagsRemove drops the given tags, the others are kept
+	TagsRemove
+)
+
+// Tag is a topic assigned by the users to videos and pictures, the same tag is
+// shared by every content with the same name
+type Tag struct {
+	Id   string `json:"id" gorm:"primaryKey"`
+	Name string `json:"name" gorm:"unique;not null"`
+}
+
+// TagCount is a tag with the number of contents using it
+type TagCount struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Videos   int64  `json:"videos"`
+	Pictures int64  `json:"pictures"`
+	Count    int64  `json:"count"`
+}
+
+// NormalizeTag returns the name stored for a tag: lower case, without repeated spaces
+func NormalizeTag(name string) (string, error) {
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+	if len(name) == 0 {
+		return "", fmt.Errorf("the tag name cannot be empty")
+	}
+	if len(name) > MaxTagName {
+		return "", fmt.Errorf("the tag name cannot be longer than %d characters", MaxTagName)
+	}
+	if strings.Contains(name, ",") {
+		return "", fmt.Errorf("the tag name `%s` cannot contain commas", name)
+	}
+	return name, nil
+}
+
+func NewTag(name string) (Tag, error) {
+	name, err := NormalizeTag(name)
+	if err != nil {
+		return Tag{}, err
+	}
+	return Tag{Id: fmt.Sprintf("g-%d", hashFromString(name)), Name: name}, nil
+}
+
+// NewTags returns the tags of the given names, without repetitions
+func NewTags(names []string) ([]Tag, error) {
+	var out = make([]Tag, 0, len(names))
+	for _, name := range names {
+		tag, err := NewTag(name)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(out, tag) {
+			out = append(out, tag)
+		}
+	}
+	return out, nil
+}
+
+func sortTags(tags []Tag) {
+	slices.SortFunc(tags, func(a, b Tag) int { return strings.Compare(a.Name, b.Name) })
+}
+
+// VideoTag assigns a tag to a video
+type VideoTag struct {
+	VideoId string `gorm:"primaryKey"`
+	TagId   string `gorm:"primaryKey;index"`
+}
+
+// PictureTag assigns a tag to a picture
+type PictureTag struct {
+	PictureId string `gorm:"primaryKey"`
+	TagId     string `gorm:"primaryKey;index"`
+}
+
+// tagsOf returns the tags assigned through the links of type T to the content
+// with the given id, owner is the column of the content id
+func tagsOf[T any](conn *gorm.DB, owner string, id string) ([]Tag, error) {
+	var found = []Tag{}
+	if tx := conn.Where("id IN (?)", conn.Model(new(T)).Select("tag_id").Where(owner+" = ?", id)).
+		Order("name").Find(&found); tx.Error != nil {
+		return nil, tx.Error
+	}
+	return found, nil
+}
+
+// tagsBy returns the tags assigned through the links of type T, by content id
+func tagsBy[T any](conn *gorm.DB, owner string) (map[string][]Tag, error) {
+	var links []struct {
+		OwnerId string
+		TagId   string
+	}
+	if tx := conn.Model(new(T)).Select(owner + " AS owner_id, tag_id").Scan(&links); tx.Error != nil {
+		return nil, tx.Error
+	}
+	var tags []Tag
+	if tx := conn.Order("name").Find(&tags); tx.Error != nil {
+		return nil, tx.Error
+	}
+	var byId = make(map[string]Tag, len(tags))
+	for _, t := range tags {
+		byId[t.Id] = t
+	}
+	var out = map[string][]Tag{}
+	for _, l := range links {
+		if t, ok := byId[l.TagId]; ok {
+			out[l.OwnerId] = append(out[l.OwnerId], t)
+		}
+	}
+	for _, list := range out {
+		sortTags(list)
+	}
+	return out, nil
+}
+
+// changeTags applies the change to the links of type T of the content with
+// the given id and returns its tags, link builds the link to a tag
+func changeTags[T any](conn *gorm.DB, owner string, id string, link func(tagId string) T, change TagChange, names []string) ([]Tag, error) {
+	changed, err := NewTags(names)
+	if err != nil {
+		return nil, err
+	}
+	var ids = make([]string, 0, len(changed))
+	var links = make([]T, 0, len(changed))
+	for _, t := range changed {
+		ids = append(ids, t.Id)
+		links = append(links, link(t.Id))
+	}
+
+	var out []Tag
+	err = conn.Transaction(func(tx *gorm.DB) error {
+		if change == TagsReplace {
+			if err := tx.Where(owner+" = ?", id).Delete(new(T)).Error; err != nil {
+				return err
+			}
+		}
+		switch {
+		case len(changed) == 0:
+		case change == TagsReplace, change == TagsAdd:
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&changed).Error; err != nil {
+				return err
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&links).Error; err != nil {
+				return err
+			}
+		case change == TagsRemove:
+			if err := tx.Where(owner+" = ? AND tag_id IN ?", id, ids).Delete(new(T)).Error; err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown tag change %d", change)
+		}
+
+		var err error
+		if out, err = tagsOf[T](tx, owner, id); err != nil {
+			return err
+		}
+		return PruneTags(tx)
+	})
+	return out, err
+}
+
+// LoadTags fills the tags of the video
+func (v *Video) LoadTags(conn *gorm.DB) (err error) {
+	v.Tags, err = tagsOf[VideoTag](conn, "video_id", v.Id)
+	return err
+}
+
+// LoadTags fills the tags of the picture
+func (p *Picture) LoadTags(conn *gorm.DB) (err error) {
+	p.Tags, err = tagsOf[PictureTag](conn, "picture_id", p.Id)
+	return err
+}
+
+// ChangeTags applies the change to the tags of the video
+func (v *Video) ChangeTags(conn *gorm.DB, change TagChange, names []string) error {
+	tags, err := changeTags(conn, "video_id", v.Id, func(tagId string) VideoTag {
+		return VideoTag{VideoId: v.Id, TagId: tagId}
+	}, change, names)
+	if err != nil {
+		return err
+	}
+	v.Tags = tags
+	return nil
+}
+
+// ChangeTags applies the change to the tags of the picture
+func (p *Picture) ChangeTags(conn *gorm.DB, change TagChange, names []string) error {
+	tags, err := changeTags(conn, "picture_id", p.Id, func(tagId string) PictureTag {
+		return PictureTag{PictureId: p.Id, TagId: tagId}
+	}, change, names)
+	if err != nil {
+		return err
+	}
+	p.Tags = tags
+	return nil
+}
+
+// PruneTags removes the tags no video and no picture uses anymore
+func PruneTags(conn *gorm.DB) error {
+	return conn.Where("id NOT IN (?) AND id NOT IN (?)",
+		conn.Model(&VideoTag{}).Select("tag_id"),
+		conn.Model(&PictureTag{}).Select("tag_id"),
+	).Delete(&Tag{}).Error
+}
+
+// VideoTags returns the tags of every video, by video id
+func VideoTags(conn *gorm.DB) (map[string][]Tag, error) {
+	return tagsBy[VideoTag](conn, "video_id")
+}
+
+// PictureTags returns the tags of every picture, by picture id
+func PictureTags(conn *gorm.DB) (map[string][]Tag, error) {
+	return tagsBy[PictureTag](conn, "picture_id")
+}
+
+// TagCloud counts the existing videos and the pictures of every tag, only the
+// ones inside the folders the user can access. The unused tags are left out
+func TagCloud(conn *gorm.DB, user *User) ([]TagCount, error) {
+	accessible, err := AccessibleFolders(conn, user)
+	if err != nil {
+		return nil, err
+	}
+	var folders = make([]string, 0, len(accessible))
+	for id := range accessible {
+		folders = append(folders, id)
+	}
+
+	var videos = conn.Table("video_tags").Select("COUNT(*)").
+		Joins("JOIN videos ON videos.id = video_tags.video_id").
+		Where("video_tags.tag_id = tags.id AND videos.attr_exists = ? AND videos.folder_id IN ?", true, folders)
+	var pictures = conn.Table("picture_tags").Select("COUNT(*)").
+		Joins("JOIN pictures ON pictures.id = picture_tags.picture_id").
+		Where("picture_tags.tag_id = tags.id AND pictures.folder_id IN ?", folders)
+
+	var found []TagCount
+	if tx := conn.Model(&Tag{}).Select("tags.id, tags.name, (?) AS videos, (?) AS pictures", videos, pictures).
+		Order("tags.name").Scan(&found); tx.Error != nil {
+		return nil, tx.Error
+	}
+	var out = make([]TagCount, 0, len(found))
+	for _, t := range found {
+		t.Count = t.Videos + t.Pictures
+		if t.Count > 0 {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// TagFilter selects the contents by their tags, every list left empty matches everything
+type TagFilter struct {
+	// Any requires at least one of the tags
+	Any []string
+	// All requires every tag
+	All []string
+	// None requires none of the tags
+	None []string
+}
+
+// NewTagFilter normalizes the names of the tags of the filter
+func NewTagFilter(anyOf []string, allOf []string, noneOf []string) (filter TagFilter, err error) {
+	for _, list := range []struct {
+		from []string
+		to   *[]string
+	}{{anyOf, &filter.Any}, {allOf, &filter.All}, {noneOf, &filter.None}} {
+		for _, name := range list.from {
+			if name, err = NormalizeTag(name); err != nil {
+				return filter, err
+			}
+			*list.to = append(*list.to, name)
+		}
+	}
+	return filter, nil
+}
+
+func (f TagFilter) IsEmpty() bool {
+	return len(f.Any) == 0 && len(f.All) == 0 && len(f.None) == 0
+}
+
+// Match reports whether the tags satisfy every list of the filter
+func (f TagFilter) Match(tags []Tag) bool {
+	var has = func(name string) bool {
+		return slices.ContainsFunc(tags, func(t Tag) bool { return t.Name == name })
+	}
+	if len(f.Any) > 0 && !slices.ContainsFunc(f.Any, has) {
+		return false
+	}
+	for _, name := range f.All {
+		if !has(name) {
+			return false
+		}
+	}
+	return !slices.ContainsFunc(f.None, has)
+}
+
+func (*Tag) GetGQLType() *graphql.Output {
+	return &gql_TagType
+}
+
+func (*TagCount) GetGQLType() *graphql.Output {
+	return &gql_TagCountType
+}
+
+var (
+	gql_TagType graphql.Output = graphql.NewObject(graphql.ObjectConfig{
+		Name: "GQLTag",
+		Fields: graphql.Fields{
+			"id":   &graphql.Field{Type: graphql.String, Description: "Tag id (Generated) follows pattern: g-%d"},
+			"name": &graphql.Field{Type: graphql.String, Description: "Tag name, lower case"},
+		},
+	})
+
+	gql_TagCountType graphql.Output = graphql.NewObject(graphql.ObjectConfig{
+		Name: "GQLTagCount",
+		Fields: graphql.Fields{
+			"id":       &graphql.Field{Type: graphql.String, Description: "Tag id"},
+			"name":     &graphql.Field{Type: graphql.String, Description: "Tag name"},
+			"videos":   &graphql.Field{Type: graphql.Int, Description: "Number of videos with the tag"},
+			"pictures": &graphql.Field{Type: graphql.Int, Description: "Number of pictures with the tag"},
+			"count":    &graphql.Field{Type: graphql.Int, Description: "Number of videos and pictures with the tag"},
+		},
+	})
+)
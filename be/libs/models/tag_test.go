@@ -0,0 +1,41 @@
+package models
+
+import "testing"
+
+func TestTagFilterMatch(t *testing.T) {
+	var tags = func(names ...string) []Tag {
+		var out []Tag
+		for _, name := range names {
+			out = append(out, Tag{Name: name})
+		}
+		return out
+	}
+
+	var tests = []struct {
+		name   string
+		filter TagFilter
+		tags   []Tag
+		want   bool
+	}{
+		{name: "empty filter", filter: TagFilter{}, tags: tags("a"), want: true},
+		{name: "empty filter without tags", filter: TagFilter{}, tags: nil, want: true},
+		{name: "any matches one", filter: TagFilter{Any: []string{"a", "b"}}, tags: tags("b", "c"), want: true},
+		{name: "any matches none", filter: TagFilter{Any: []string{"a", "b"}}, tags: tags("c"), want: false},
+		{name: "any without tags", filter: TagFilter{Any: []string{"a"}}, tags: nil, want: false},
+		{name: "all present", filter: TagFilter{All: []string{"a", "b"}}, tags: tags("a", "b", "c"), want: true},
+		{name: "all missing one", filter: TagFilter{All: []string{"a", "b"}}, tags: tags("a", "c"), want: false},
+		{name: "none absent", filter: TagFilter{None: []string{"x"}}, tags: tags("a"), want: true},
+		{name: "none present", filter: TagFilter{None: []string{"x"}}, tags: tags("a", "x"), want: false},
+		{name: "none without tags", filter: TagFilter{None: []string{"x"}}, tags: nil, want: true},
+		{name: "every list", filter: TagFilter{Any: []string{"a", "b"}, All: []string{"c"}, None: []string{"x"}}, tags: tags("b", "c"), want: true},
+		{name: "every list excluded", filter: TagFilter{Any: []string{"a", "b"}, All: []string{"c"}, None: []string{"x"}}, tags: tags("b", "c", "x"), want: false},
+		{name: "names are compared as stored", filter: TagFilter{Any: []string{"sci fi"}}, tags: tags("Sci Fi"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(tt.tags); got != tt.want {
+				t.Errorf("%+v.Match(%v) = %v, want %v", tt.filter, tt.tags, got, tt.want)
+			}
+		})
+	}
+}
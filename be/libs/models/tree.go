@@ -0,0 +1,301 @@
+package models
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultContentsLimit int = 50
+	MaxContentsLimit     int = 500
+)
+
+// FolderNode is a sub folder of a registered folder, the counters include
+// every folder below it. Only the folders holding a video or a picture are listed
+type FolderNode struct {
+	Name string `json:"name"`
+	// Path is relative to the registered folder, it is empty for the root
+	Path     string        `json:"path"`
+	Videos   int64         `json:"videos"`
+	Pictures int64         `json:"pictures"`
+	Size     int64         `json:"size"`
+	Duration time.Duration `json:"duration"`
+	Children []*FolderNode `json:"children,omitempty"`
+}
+
+// FolderContents is a page of the files directly inside a sub folder,
+// the videos come first and the pictures follow them
+type FolderContents struct {
+	Path     string        `json:"path"`
+	Folders  []*FolderNode `json:"folders"`
+	Videos   []Video       `json:"videos"`
+	Pictures []Picture     `json:"pictures"`
+	Offset   int           `json:"offset"`
+	Limit    int           `json:"limit"`
+	Total    int64         `json:"total"`
+}
+
+type dirStats struct {
+	FolderPath string
+	Count      int64
+	Size       int64
+	Duration   int64
+}
+
+// relPath converts an absolute folder path to the slash separated path relative to f
+func (f *Folder) relPath(dir string) (string, bool) {
+	if !f.Contains(dir) {
+		return "", false
+	}
+	rel, err := filepath.Rel(f.Path, dir)
+	if err != nil {
+		return "", false
+	}
+	if rel == "." {
+		return "", true
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// absPath converts a path relative to f to an absolute one, it fails when the
+// path points outside of the folder
+func (f *Folder) absPath(rel string) (string, error) {
+	var dir = filepath.Join(f.Path, filepath.FromSlash(rel))
+	if !f.Contains(dir) {
+		return "", fmt.Errorf("path `%s` is outside of the folder", rel)
+	}
+	return dir, nil
+}
+
+// storedPaths returns the folder paths stored for the files of f inside dir, dir
+// included. The paths are stored as the walk built them: the registered one is
+// kept as typed, so they are compared once cleaned
+func (f *Folder) storedPaths(conn *gorm.DB, dir string) (inside []string, direct []string, err error) {
+	var videoPaths, picturePaths []string
+	if tx := conn.Model(&Video{}).Distinct("folder_path").Where("folder_id = ?", f.Id).Pluck("folder_path", &videoPaths); tx.Error != nil {
+		return nil, nil, tx.Error
+	}
+	if tx := conn.Model(&Picture{}).Distinct("folder_path").Where("folder_id = ?", f.Id).Pluck("folder_path", &picturePaths); tx.Error != nil {
+		return nil, nil, tx.Error
+	}
+	var all = slices.Concat(videoPaths, picturePaths)
+	slices.Sort(all)
+	dir = filepath.Clean(dir)
+	var parent = &Folder{Path: dir}
+	inside = []string{}
+	for _, p := range slices.Compact(all) {
+		if !parent.Contains(filepath.Clean(p)) {
+			continue
+		}
+		inside = append(inside, p)
+		if filepath.Clean(p) == dir {
+			direct = append(direct, p)
+		}
+	}
+	return inside, direct, nil
+}
+
+// Tree returns the sub folders of f with the videos and the pictures stored for them
+func (f *Folder) Tree(conn *gorm.DB) (*FolderNode, error) {
+	return f.tree(conn, nil)
+}
+
+// tree builds the nodes of the files stored with the given folder paths, every
+// path when paths is nil. The parents are always added, their counters include
+// the given paths only
+func (f *Folder) tree(conn *gorm.DB, paths []string) (*FolderNode, error) {
+	var videoStats, pictureStats []dirStats
+	var videosQuery = conn.Model(&Video{}).Where("folder_id = ? AND attr_exists = ?", f.Id, true)
+	var picturesQuery = conn.Model(&Picture{}).Where("folder_id = ?", f.Id)
+	if paths != nil {
+		videosQuery = videosQuery.Where("folder_path IN ?", paths)
+		picturesQuery = picturesQuery.Where("folder_path IN ?", paths)
+	}
+	if tx := videosQuery.
+		Select("folder_path, count(*) AS count, coalesce(sum(size), 0) AS size, coalesce(sum(duration), 0) AS duration").
+		Group("folder_path").
+		Scan(&videoStats); tx.Error != nil {
+		return nil, tx.Error
+	}
+	if tx := picturesQuery.
+		Select("folder_path, count(*) AS count, coalesce(sum(size), 0) AS size").
+		Group("folder_path").
+		Scan(&pictureStats); tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	var root = &FolderNode{Name: filepath.Base(f.Path)}
+	var nodes = map[string]*FolderNode{"": root}
+	var node func(rel string) *FolderNode
+	node = func(rel string) *FolderNode {
+		if n, ok := nodes[rel]; ok {
+			return n
+		}
+		var parent = ""
+		if idx := strings.LastIndex(rel, "/"); idx >= 0 {
+			parent = rel[:idx]
+		}
+		var n = &FolderNode{Name: filepath.Base(rel), Path: rel}
+		nodes[rel] = n
+		p := node(parent)
+		p.Children = append(p.Children, n)
+		return n
+	}
+	// add updates the node of the folder and all its parents
+	var add = func(s dirStats, isVideo bool) {
+		rel, ok := f.relPath(s.FolderPath)
+		if !ok {
+			return
+		}
+		for {
+			var n = node(rel)
+			if isVideo {
+				n.Videos += s.Count
+				n.Duration += time.Duration(s.Duration)
+			} else {
+				n.Pictures += s.Count
+			}
+			n.Size += s.Size
+			if len(rel) == 0 {
+				return
+			}
+			rel = rel[:max(strings.LastIndex(rel, "/"), 0)]
+		}
+	}
+	for _, s := range videoStats {
+		add(s, true)
+	}
+	for _, s := range pictureStats {
+		add(s, false)
+	}
+
+	for _, n := range nodes {
+		slices.SortFunc(n.Children, func(a, b *FolderNode) int { return strings.Compare(a.Name, b.Name) })
+	}
+	return root, nil
+}
+
+// Find returns the node with the given relative path
+func (n *FolderNode) Find(rel string) *FolderNode {
+	rel = strings.Trim(filepath.ToSlash(filepath.Clean("/"+rel)), "/")
+	if len(rel) == 0 {
+		return n
+	}
+	var current = n
+	for _, name := range strings.Split(rel, "/") {
+		idx := slices.IndexFunc(current.Children, func(c *FolderNode) bool { return c.Name == name })
+		if idx < 0 {
+			return nil
+		}
+		current = current.Children[idx]
+	}
+	return current
+}
+
+// Contents lists a page of the files directly inside the sub folder rel
+func (f *Folder) Contents(conn *gorm.DB, rel string, offset int, limit int) (*FolderContents, error) {
+	dir, err := f.absPath(rel)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = DefaultContentsLimit
+	}
+	limit = min(limit, MaxContentsLimit)
+	offset = max(offset, 0)
+
+	// Only the sub folders of dir are counted, the rest of the tree is not needed
+	inside, direct, err := f.storedPaths(conn, dir)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := f.tree(conn, inside)
+	if err != nil {
+		return nil, err
+	}
+	var out = &FolderContents{Offset: offset, Limit: limit, Folders: []*FolderNode{}, Videos: []Video{}, Pictures: []Picture{}}
+	out.Path, _ = f.relPath(dir)
+	if n := tree.Find(out.Path); n != nil {
+		for _, c := range n.Children {
+			var child = *c
+			child.Children = nil
+			out.Folders = append(out.Folders, &child)
+		}
+	}
+
+	var videosQuery = conn.Model(&Video{}).Where("folder_id = ? AND folder_path IN ? AND attr_exists = ?", f.Id, direct, true).Session(&gorm.Session{})
+	var picturesQuery = conn.Model(&Picture{}).Where("folder_id = ? AND folder_path IN ?", f.Id, direct).Session(&gorm.Session{})
+
+	var videoCount, pictureCount int64
+	if tx := videosQuery.Count(&videoCount); tx.Error != nil {
+		return nil, tx.Error
+	}
+	if tx := picturesQuery.Count(&pictureCount); tx.Error != nil {
+		return nil, tx.Error
+	}
+	out.Total = videoCount + pictureCount
+
+	if int64(offset) < videoCount {
+		if tx := videosQuery.Preload("Streams").Preload("Subtitles").Order("title").Offset(offset).Limit(limit).Find(&out.Videos); tx.Error != nil {
+			return nil, tx.Error
+		}
+	}
+	if left := limit - len(out.Videos); left > 0 && int64(offset+limit) > videoCount {
+		var pictureOffset = max(int64(offset)-videoCount, 0)
+		if tx := picturesQuery.Order("title").Offset(int(pictureOffset)).Limit(left).Find(&out.Pictures); tx.Error != nil {
+			return nil, tx.Error
+		}
+	}
+	return out, nil
+}
+
+var (
+	gql_FolderNodeType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "GQLFolderNode",
+		Fields: graphql.Fields{
+			"name":     &graphql.Field{Type: graphql.String, Description: "Folder name"},
+			"path":     &graphql.Field{Type: graphql.String, Description: "Path relative to the registered folder, empty for the root"},
+			"videos":   &graphql.Field{Type: graphql.Int, Description: "Number of videos, sub folders included"},
+			"pictures": &graphql.Field{Type: graphql.Int, Description: "Number of pictures, sub folders included"},
+			"size":     &graphql.Field{Type: graphql.Float, Description: "Total size (Byte)"},
+			"duration": &graphql.Field{Type: graphql.String, Description: "Total duration of the videos"},
+		},
+	})
+
+	gql_FolderContentsType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "GQLFolderContents",
+		Fields: graphql.Fields{
+			"path":     &graphql.Field{Type: graphql.String, Description: "Path relative to the registered folder"},
+			"folders":  &graphql.Field{Type: graphql.NewList(gql_FolderNodeType), Description: "Direct sub folders"},
+			"videos":   &graphql.Field{Type: graphql.NewList(gql_VideoType), Description: "Videos of the page"},
+			"pictures": &graphql.Field{Type: graphql.NewList(gql_PictureType), Description: "Pictures of the page"},
+			"offset":   &graphql.Field{Type: graphql.Int, Description: "Position of the first file of the page"},
+			"limit":    &graphql.Field{Type: graphql.Int, Description: "Maximum number of files of the page"},
+			"total":    &graphql.Field{Type: graphql.Int, Description: "Number of files in the folder"},
+		},
+	})
+)
+
+func init() {
+	// The type refers to itself, the field cannot be declared together with it
+	gql_FolderNodeType.AddFieldConfig("children", &graphql.Field{
+		Type:        graphql.NewList(gql_FolderNodeType),
+		Description: "Sub folders",
+	})
+}
+
+func (*FolderNode) GetGQLType() *graphql.Output {
+	var out graphql.Output = gql_FolderNodeType
+	return &out
+}
+
+func (*FolderContents) GetGQLType() *graphql.Output {
+	var out graphql.Output = gql_FolderContentsType
+	return &out
+}
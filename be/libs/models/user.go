@@ -6,21 +6,75 @@ import (
 	"strings"
 
 	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
 )
 
 type User struct {
-	Id             string         `json:"id,omitempty" gorm:"primaryKey"`
-	Email          string         `json:"email,omitempty" gorm:"unique;index"`
-	Username       string         `json:"username,omitempty" gorm:"unique;index"`
-	Password       string         `json:"-" gorm:"-"`
-	PasswordHashed string         `json:"passwordHashed,omitempty"`
-	Perms          UserPermission `json:"-" gorm:"embedded;embeddedPrefix:perm_"`
+	Id             string          `json:"id,omitempty" gorm:"primaryKey"`
+	Email          string          `json:"email,omitempty" gorm:"unique;index"`
+	Username       string          `json:"username,omitempty" gorm:"unique;index"`
+	Password       string          `json:"-" gorm:"-"`
+	PasswordHashed string          `json:"passwordHashed,omitempty"`
+	Perms          UserPermission  `json:"-" gorm:"embedded;embeddedPrefix:perm_"`
+	Preferences    UserPreferences `json:"preferences" gorm:"embedded;embeddedPrefix:pref_"`
 }
 
 type UserPermission struct {
 	IsAdmin bool `json:"isAdmin,omitempty"`
 }
 
+// UserPreferences are applied to the streams when the request does not say otherwise
+type UserPreferences struct {
+	// MaxQuality is the height of the highest HLS variant offered, 0 means no limit
+	MaxQuality int `json:"maxQuality"`
+	// AudioLanguage is the ISO 639-1 code of the audio track played when a video has it
+	AudioLanguage string `json:"audioLanguage"`
+}
+
+// SavePreferences stores the preferences of the user
+func (u *User) SavePreferences(conn *gorm.DB) error {
+	if u.Preferences.MaxQuality < 0 {
+		return fmt.Errorf("max quality cannot be negative")
+	}
+	if len(u.Preferences.AudioLanguage) > 0 {
+		code, ok := NormalizeLanguage(u.Preferences.AudioLanguage)
+		if !ok {
+			return fmt.Errorf("unknown audio language `%s`", u.Preferences.AudioLanguage)
+		}
+		u.Preferences.AudioLanguage = code
+	}
+	return conn.Model(u).UpdateColumns(map[string]any{
+		"pref_max_quality":    u.Preferences.MaxQuality,
+		"pref_audio_language": u.Preferences.AudioLanguage,
+	}).Error
+}
+
+// AfterDelete removes the playlists, the progress, the history and the sessions together with the user
+func (u *User) AfterDelete(tx *gorm.DB) error {
+	if len(u.Id) == 0 {
+		return nil
+	}
+	var playlists []string
+	if err := tx.Model(&Playlist{}).Where("owner_id = ?", u.Id).Pluck("id", &playlists).Error; err != nil {
+		return err
+	}
+	if len(playlists) > 0 {
+		if err := tx.Where("playlist_id IN ?", playlists).Delete(&PlaylistEntry{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id IN ?", playlists).Delete(&Playlist{}).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Where("user_id = ?", u.Id).Delete(&WatchProgress{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", u.Id).Delete(&HistoryEntry{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ?", u.Id).Delete(&Session{}).Error
+}
+
 func (u *User) GenerateId() bool {
 	u.Id = GenerateString(32)
 	return u.Id != ""
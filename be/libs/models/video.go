@@ -1,9 +1,15 @@
 package models
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/graphql-go/graphql"
@@ -13,13 +19,23 @@ import (
 )
 
 type Video struct {
-	Id         string          `json:"id" gorm:"primaryKey"`
-	Title      string          `json:"title" gorm:"index"`
-	FilePath   string          `json:"filePath" gorm:"index"`
-	Duration   time.Duration   `json:"duration,omitempty"`
-	Size       int64           `json:"size,omitempty"`
-	Folder     *Folder         `json:"folder,omitempty" gorm:"embedded;embeddedPrefix:folder_"`
-	Attributes VideoAttributes `json:"attributes" gorm:"embedded;embeddedPrefix:attr_"`
+	Id       string        `json:"id" gorm:"primaryKey"`
+	Title    string        `json:"title" gorm:"index"`
+	FilePath string        `json:"filePath" gorm:"index"`
+	Duration time.Duration `json:"duration,omitempty"`
+	Size     int64         `json:"size,omitempty"`
+	// Fingerprint identifies the content of the file, it survives renames and moves
+	Fingerprint string `json:"fingerprint,omitempty" gorm:"index"`
+	// ProbeFailed marks the files ffprobe cannot read, the scans do not probe them again
+	ProbeFailed bool            `json:"probeFailed,omitempty"`
+	Folder      *Folder         `json:"folder,omitempty" gorm:"embedded;embeddedPrefix:folder_"`
+	Attributes  VideoAttributes `json:"attributes" gorm:"embedded;embeddedPrefix:attr_"`
+	Streams     []VideoStream   `json:"streams,omitempty" gorm:"foreignKey:VideoId"`
+	Subtitles   []Subtitle      `json:"subtitles,omitempty" gorm:"foreignKey:VideoId"`
+	// Tags are stored as VideoTag links, the embedded folder id confuses the gorm relations
+	Tags []Tag `json:"tags,omitempty" gorm:"-"`
+	// Progress is the one of the user asking for the video, it is never stored with it
+	Progress *WatchProgress `json:"progress,omitempty" gorm:"-"`
 }
 
 type VideoAttributes struct {
@@ -27,10 +43,138 @@ type VideoAttributes struct {
 	Watched bool `json:"watched"`
 }
 
+// newVideo builds the video of a file, its subtitles are picked from the listing of its folder
+func newVideo(filePath string, size int64, f *Folder, subtitles *subtitleListing) *Video {
+	var v = Video{
+		Title:    filepath.Base(filePath),
+		FilePath: filePath,
+		Size:     size,
+		Folder:   f,
+	}
+	v.GenerateId()
+	v.SetAttributes()
+	v.Subtitles = v.subtitlesIn(subtitles)
+	return &v
+}
+
+// NewVideo builds the video for a single file inside the folder f
+func NewVideo(filePath string, f *Folder) (*Video, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("`%s` is a folder", filePath)
+	}
+	return newVideo(filePath, info.Size(), f, listSubtitles(filepath.Dir(filePath))), nil
+}
+
+const FingerprintChunk int64 = 2 << 20
+
 func (v *Video) GenerateId() {
 	v.Id = fmt.Sprintf("v-%d", hashFromString(fmt.Sprintf("[%d {%d}] %s", v.Size, v.Duration, v.FilePath)))
 }
 
+// GenerateFingerprint hashes the size of the file together with its first and last
+// FingerprintChunk bytes, reading the whole file would be too slow on large libraries
+func (v *Video) GenerateFingerprint() error {
+	fd, err := os.Open(v.FilePath)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	info, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	binary.Write(h, binary.LittleEndian, info.Size())
+	if _, err := io.CopyN(h, fd, FingerprintChunk); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if info.Size() > FingerprintChunk*2 {
+		if _, err := fd.Seek(-FingerprintChunk, io.SeekEnd); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(h, fd, FingerprintChunk); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+	} else if _, err := io.Copy(h, fd); err != nil {
+		return err
+	}
+
+	v.Fingerprint = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+// Relink moves the missing video v onto the file described by found, the id,
+// the attributes and everything referencing the id are kept
+func (v *Video) Relink(conn *gorm.DB, found *Video) error {
+	var previous = v.FilePath
+	v.FilePath = found.FilePath
+	v.Title = found.Title
+	v.Size = found.Size
+	v.Folder = found.Folder
+	v.Attributes.Exists = true
+	if len(found.Fingerprint) > 0 {
+		v.Fingerprint = found.Fingerprint
+	}
+	if v.Duration == 0 {
+		v.Duration = found.Duration
+	}
+
+	var columns = map[string]any{
+		"file_path":   v.FilePath,
+		"title":       v.Title,
+		"size":        v.Size,
+		"fingerprint": v.Fingerprint,
+		"duration":    v.Duration,
+		"attr_exists": true,
+	}
+	if v.Folder != nil {
+		columns["folder_id"] = v.Folder.Id
+		columns["folder_path"] = v.Folder.Path
+		columns["folder_auth_required"] = v.Folder.AuthRequired
+	}
+	if tx := conn.Model(v).UpdateColumns(columns); tx.Error != nil {
+		return tx.Error
+	}
+	// The subtitles sit next to the file, the ones of the old path are gone
+	if _, err := v.SyncSubtitles(conn); err != nil {
+		log.Err(err).Str("id", v.Id).Msg("Cannot update subtitles")
+	}
+	log.Info().Str("id", v.Id).Str("from", previous).Str("to", v.FilePath).Msg("Relinked video")
+	return nil
+}
+
+// MatchesMissing reports whether v looks like the same content of the missing video m,
+// rows created before fingerprints existed are matched on size and duration
+func (v *Video) MatchesMissing(m *Video) bool {
+	if m.Attributes.Exists {
+		return false
+	}
+	if len(m.Fingerprint) > 0 {
+		return m.Fingerprint == v.Fingerprint
+	}
+	return m.Size == v.Size && m.Duration > 0 && m.Duration == v.Duration
+}
+
+// FindMissing returns the missing video whose content matches v, if any
+func (v *Video) FindMissing(conn *gorm.DB) (*Video, error) {
+	var candidates []Video
+	if tx := conn.Preload("Streams").Preload("Subtitles").Where("attr_exists = ? AND size = ? AND (fingerprint = ? OR fingerprint = '' OR fingerprint IS NULL)", false, v.Size, v.Fingerprint).Find(&candidates); tx.Error != nil {
+		return nil, tx.Error
+	}
+	for idx := range candidates {
+		if v.MatchesMissing(&candidates[idx]) {
+			return &candidates[idx], nil
+		}
+	}
+	return nil, nil
+}
+
 func (v *Video) SetAttributes() {
 	_, err := os.Lstat(v.FilePath)
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
@@ -57,15 +201,48 @@ func (v *Video) CheckFile(conn *gorm.DB) bool {
 	return v.Attributes.Exists
 }
 
+const ProbeTimeout time.Duration = 120000 * time.Millisecond
+
 func (v *Video) GetDuration() error {
-	data, err := ffprobe.GetProbeData(v.FilePath, 120000*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), ProbeTimeout)
+	defer cancel()
+	return v.Probe(ctx)
+}
+
+// Probe runs ffprobe on the video file, the process is killed as soon as ctx is done
+func (v *Video) Probe(ctx context.Context) error {
+	data, err := ffprobe.GetProbeDataContext(ctx, v.FilePath)
+	// A cancelled probe says nothing about the file
+	if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		return err
+	}
+	v.ProbeFailed = err != nil
 	if err != nil {
 		return err
 	}
 	v.Duration = data.Format.Duration()
+	v.Streams = nil
+	for _, stream := range data.Streams {
+		switch stream.CodecType {
+		case StreamTypeVideo, StreamTypeAudio, StreamTypeSubtitle:
+			v.Streams = append(v.Streams, NewVideoStream(v.Id, stream))
+		}
+	}
 	return nil
 }
 
+func gqlVideoResolver(fn func(v *Video) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		switch v := p.Source.(type) {
+		case Video:
+			return fn(&v), nil
+		case *Video:
+			return fn(v), nil
+		}
+		return nil, nil
+	}
+}
+
 func (*Video) GetGQLType() *graphql.Output {
 	return &gql_VideoType
 }
@@ -74,15 +251,63 @@ var (
 	gql_VideoType graphql.Output = graphql.NewObject(graphql.ObjectConfig{
 		Name: "GQLVideo",
 		Fields: graphql.Fields{
-			"id":       &graphql.Field{Type: graphql.String, Description: "Video id (Generated) follows pattern: v-%d"},
-			"title":    &graphql.Field{Type: graphql.String, Description: "Video title"},
-			"filePath": &graphql.Field{Type: graphql.String, Description: "File path in the file system"},
-			"duration": &graphql.Field{Type: graphql.String, Description: "Video duration (MS)"},
-			"size":     &graphql.Field{Type: graphql.Int, Description: "Video size (Byte)"},
+			"id":          &graphql.Field{Type: graphql.String, Description: "Video id (Generated) follows pattern: v-%d"},
+			"title":       &graphql.Field{Type: graphql.String, Description: "Video title"},
+			"filePath":    &graphql.Field{Type: graphql.String, Description: "File path in the file system"},
+			"duration":    &graphql.Field{Type: graphql.String, Description: "Video duration (MS)"},
+			"size":        &graphql.Field{Type: graphql.Int, Description: "Video size (Byte)"},
+			"fingerprint": &graphql.Field{Type: graphql.String, Description: "Content fingerprint, kept when the file is moved or renamed"},
 			"folder": &graphql.Field{
 				Type:        *(*Folder).GetGQLType(nil),
 				Description: "Folder",
 			},
+			"streams": &graphql.Field{
+				Type:        graphql.NewList(*(*VideoStream).GetGQLType(nil)),
+				Description: "Video, audio and subtitle streams",
+			},
+			"subtitles": &graphql.Field{
+				Type:        graphql.NewList(*(*Subtitle).GetGQLType(nil)),
+				Description: "Subtitle files next to the video",
+			},
+			"tags": &graphql.Field{
+				Type:        graphql.NewList(*(*Tag).GetGQLType(nil)),
+				Description: "Tags of the video",
+			},
+			"subtitleTracks": &graphql.Field{
+				Type:        graphql.NewList(*(*SubtitleTrack).GetGQLType(nil)),
+				Description: "Subtitle files and embedded subtitle streams the player can choose",
+				Resolve: gqlVideoResolver(func(v *Video) any {
+					return v.SubtitleTracks()
+				}),
+			},
+			"resolution": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Resolution of the main video stream, like 1080p",
+				Resolve: gqlVideoResolver(func(v *Video) any {
+					return v.Resolution()
+				}),
+			},
+			"videoCodec": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Codec of the main video stream",
+				Resolve: gqlVideoResolver(func(v *Video) any {
+					if s := v.MainVideoStream(); s != nil {
+						return s.Codec
+					}
+					return nil
+				}),
+			},
+			"audioTracks": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "Number of audio streams",
+				Resolve: gqlVideoResolver(func(v *Video) any {
+					return len(v.StreamsOf(StreamTypeAudio))
+				}),
+			},
+			"progress": &graphql.Field{
+				Type:        *(*WatchProgress).GetGQLType(nil),
+				Description: "Progress of the logged user, missing when it never watched the video",
+			},
 			"attributes": &graphql.Field{
 				Type: graphql.NewObject(graphql.ObjectConfig{
 					Name: "GQLVideoAttributes",
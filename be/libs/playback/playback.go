@@ -0,0 +1,206 @@
+package playback
+
+import (
+	"context"
+	"fmt"
+	"full/libs/media"
+	"full/libs/models"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	MethodDirect    string = "direct"
+	MethodRemux     string = "remux"
+	MethodTranscode string = "transcode"
+)
+
+// Capabilities are the containers and the codecs a client can decode,
+// the names follow ffprobe (h264, hevc, aac, ...) but the common aliases are accepted
+type Capabilities struct {
+	Containers  []string `json:"containers"`
+	VideoCodecs []string `json:"videoCodecs"`
+	AudioCodecs []string `json:"audioCodecs"`
+	// MaxHeight is the highest resolution the client can play, 0 means no limit
+	MaxHeight int `json:"maxHeight,omitempty"`
+}
+
+// DefaultCapabilities is what every recent browser can play, it is used when
+// the client did not tell its own
+var DefaultCapabilities = Capabilities{
+	Containers:  []string{"mp4", "webm"},
+	VideoCodecs: []string{"h264", "vp8", "vp9", "av1"},
+	AudioCodecs: []string{"aac", "mp3", "opus", "vorbis", "flac"},
+}
+
+// Urls are the endpoints serving the video with every method, an empty url
+// means the method is not available
+type Urls struct {
+	Direct    string
+	Remux     string
+	Transcode string
+}
+
+// Plan tells the client how to play a video
+type Plan struct {
+	Method     string `json:"method"`
+	Url        string `json:"url"`
+	Reason     string `json:"reason"`
+	Container  string `json:"container,omitempty"`
+	VideoCodec string `json:"videoCodec,omitempty"`
+	AudioCodec string `json:"audioCodec,omitempty"`
+}
+
+var (
+	containerAliases = map[string]string{
+		"video/mp4":        "mp4",
+		"video/x-m4v":      "mp4",
+		"m4v":              "mp4",
+		"video/webm":       "webm",
+		"video/x-matroska": "mkv",
+		"matroska":         "mkv",
+		"video/quicktime":  "mov",
+		"video/x-msvideo":  "avi",
+	}
+	codecAliases = map[string]string{
+		"avc":  "h264",
+		"avc1": "h264",
+		"h265": "hevc",
+		"hev1": "hevc",
+		"hvc1": "hevc",
+		"av01": "av1",
+		"vp09": "vp9",
+		"vp08": "vp8",
+		"mp4a": "aac",
+		"ac-3": "ac3",
+		"ec-3": "eac3",
+	}
+)
+
+func normalize(name string, aliases map[string]string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	// Codec strings like avc1.640028 carry the profile after the dot
+	if base, _, found := strings.Cut(name, "."); found && !strings.Contains(name, "/") {
+		name = base
+	}
+	if alias, ok := aliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+func normalizeAll(names []string, aliases map[string]string) []string {
+	var out = make([]string, 0, len(names))
+	for _, n := range names {
+		out = append(out, normalize(n, aliases))
+	}
+	return out
+}
+
+// Normalize converts every alias to the ffprobe name
+func (c Capabilities) Normalize() Capabilities {
+	c.Containers = normalizeAll(c.Containers, containerAliases)
+	c.VideoCodecs = normalizeAll(c.VideoCodecs, codecAliases)
+	c.AudioCodecs = normalizeAll(c.AudioCodecs, codecAliases)
+	return c
+}
+
+// Container returns the name of the container of the video, like mp4 or mkv
+func Container(v *models.Video) string {
+	if t, ok := media.Detect(v.FilePath); ok {
+		if name, ok := containerAliases[t.MimeType]; ok {
+			return name
+		}
+		return strings.TrimPrefix(t.Extension, ".")
+	}
+	return ""
+}
+
+// LoadStreams probes the video when its streams were never stored, the result
+// is saved so the file is probed only once
+func LoadStreams(ctx context.Context, conn *gorm.DB, v *models.Video) error {
+	if len(v.Streams) > 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, models.ProbeTimeout)
+	defer cancel()
+	var duration, failed = v.Duration, v.ProbeFailed
+	var err = v.Probe(ctx)
+	if duration != v.Duration || failed != v.ProbeFailed {
+		if tx := conn.Model(v).UpdateColumns(map[string]any{"duration": v.Duration, "probe_failed": v.ProbeFailed}); tx.Error != nil {
+			return tx.Error
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return v.ReplaceStreams(conn)
+}
+
+// Decide compares the streams of the video with the capabilities of the client:
+// the file is served as is when everything is supported, it is remuxed when only
+// the container is unknown to the client and it is transcoded otherwise.
+// audio is the track chosen instead of the main one, the file as is would play
+// the main one so it is remuxed at least
+func Decide(v *models.Video, caps Capabilities, urls Urls, audio *models.VideoStream) Plan {
+	caps = caps.Normalize()
+	var plan = Plan{Container: Container(v)}
+
+	var reasons []string
+	var transcode bool
+	if s := v.MainVideoStream(); s != nil {
+		plan.VideoCodec = s.Codec
+		if !slices.Contains(caps.VideoCodecs, strings.ToLower(s.Codec)) {
+			transcode = true
+			reasons = append(reasons, fmt.Sprintf("video codec %s is not supported", s.Codec))
+		}
+		if caps.MaxHeight > 0 && s.Height > caps.MaxHeight {
+			transcode = true
+			reasons = append(reasons, fmt.Sprintf("resolution %dp is above %dp", s.Height, caps.MaxHeight))
+		}
+	}
+	var s = audio
+	if s == nil {
+		s = v.MainAudioStream()
+	}
+	if s != nil {
+		plan.AudioCodec = s.Codec
+		if !slices.Contains(caps.AudioCodecs, strings.ToLower(s.Codec)) {
+			transcode = true
+			reasons = append(reasons, fmt.Sprintf("audio codec %s is not supported", s.Codec))
+		}
+	}
+	var remux = !slices.Contains(caps.Containers, plan.Container)
+	if remux {
+		reasons = append(reasons, fmt.Sprintf("container %s is not supported", plan.Container))
+	}
+	if audio != nil {
+		remux = true
+		reasons = append(reasons, fmt.Sprintf("audio track %d is selected", audio.Index))
+	}
+	if len(v.Streams) == 0 {
+		reasons = append(reasons, "the streams are unknown")
+	}
+
+	switch {
+	case transcode:
+		plan.Method, plan.Url = MethodTranscode, urls.Transcode
+	case remux && len(urls.Remux) > 0:
+		plan.Method, plan.Url = MethodRemux, urls.Remux
+	case remux:
+		plan.Method, plan.Url = MethodTranscode, urls.Transcode
+	default:
+		plan.Method, plan.Url = MethodDirect, urls.Direct
+		if len(v.Streams) > 0 {
+			reasons = append(reasons, "every stream is supported")
+		}
+	}
+	if len(plan.Url) == 0 {
+		plan.Method, plan.Url = MethodDirect, urls.Direct
+		reasons = append(reasons, "transcoding is disabled")
+	}
+	plan.Reason = strings.Join(reasons, ", ")
+	return plan
+}
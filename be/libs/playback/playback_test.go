@@ -0,0 +1,145 @@
+package playback
+
+import (
+	"full/libs/models"
+	"strings"
+	"testing"
+)
+
+func TestDecide(t *testing.T) {
+	var (
+		h264    = models.VideoStream{Index: 0, Type: models.StreamTypeVideo, Codec: "h264", Height: 1080}
+		hevc    = models.VideoStream{Index: 0, Type: models.StreamTypeVideo, Codec: "hevc", Height: 1080}
+		aac     = models.VideoStream{Index: 1, Type: models.StreamTypeAudio, Codec: "aac", Default: true}
+		ac3     = models.VideoStream{Index: 1, Type: models.StreamTypeAudio, Codec: "ac3", Default: true}
+		aacDub  = models.VideoStream{Index: 2, Type: models.StreamTypeAudio, Codec: "aac", Language: "ita"}
+		allUrls = Urls{Direct: "direct", Remux: "remux", Transcode: "transcode"}
+	)
+	var video = func(file string, streams ...models.VideoStream) *models.Video {
+		return &models.Video{FilePath: file, Streams: streams}
+	}
+
+	var tests = []struct {
+		name       string
+		video      *models.Video
+		caps       Capabilities
+		urls       Urls
+		audio      *models.VideoStream
+		wantMethod string
+		wantUrl    string
+		wantReason string
+	}{
+		{
+			name:       "supported file",
+			video:      video("/v/a.mp4", h264, aac),
+			caps:       DefaultCapabilities,
+			urls:       allUrls,
+			wantMethod: MethodDirect,
+			wantUrl:    "direct",
+			wantReason: "every stream is supported",
+		},
+		{
+			name:       "unknown container",
+			video:      video("/v/a.mkv", h264, aac),
+			caps:       DefaultCapabilities,
+			urls:       allUrls,
+			wantMethod: MethodRemux,
+			wantUrl:    "remux",
+			wantReason: "container mkv is not supported",
+		},
+		{
+			name:       "unknown container without remux",
+			video:      video("/v/a.mkv", h264, aac),
+			caps:       DefaultCapabilities,
+			urls:       Urls{Direct: "direct", Transcode: "transcode"},
+			wantMethod: MethodTranscode,
+			wantUrl:    "transcode",
+			wantReason: "container mkv is not supported",
+		},
+		{
+			name:       "unknown video codec",
+			video:      video("/v/a.mp4", hevc, aac),
+			caps:       DefaultCapabilities,
+			urls:       allUrls,
+			wantMethod: MethodTranscode,
+			wantUrl:    "transcode",
+			wantReason: "video codec hevc is not supported",
+		},
+		{
+			name:       "resolution above the limit",
+			video:      video("/v/a.mp4", h264, aac),
+			caps:       Capabilities{Containers: []string{"mp4"}, VideoCodecs: []string{"h264"}, AudioCodecs: []string{"aac"}, MaxHeight: 720},
+			urls:       allUrls,
+			wantMethod: MethodTranscode,
+			wantUrl:    "transcode",
+			wantReason: "resolution 1080p is above 720p",
+		},
+		{
+			name:       "unknown audio codec",
+			video:      video("/v/a.mp4", h264, ac3),
+			caps:       DefaultCapabilities,
+			urls:       allUrls,
+			wantMethod: MethodTranscode,
+			wantUrl:    "transcode",
+			wantReason: "audio codec ac3 is not supported",
+		},
+		{
+			name:       "selected audio track",
+			video:      video("/v/a.mp4", h264, aac, aacDub),
+			caps:       DefaultCapabilities,
+			urls:       allUrls,
+			audio:      &aacDub,
+			wantMethod: MethodRemux,
+			wantUrl:    "remux",
+			wantReason: "audio track 2 is selected",
+		},
+		{
+			name:       "selected audio track not supported",
+			video:      video("/v/a.mp4", h264, aac, ac3),
+			caps:       DefaultCapabilities,
+			urls:       allUrls,
+			audio:      &ac3,
+			wantMethod: MethodTranscode,
+			wantUrl:    "transcode",
+			wantReason: "audio codec ac3 is not supported",
+		},
+		{
+			name:       "transcoding disabled",
+			video:      video("/v/a.mp4", hevc, aac),
+			caps:       DefaultCapabilities,
+			urls:       Urls{Direct: "direct"},
+			wantMethod: MethodDirect,
+			wantUrl:    "direct",
+			wantReason: "transcoding is disabled",
+		},
+		{
+			name:       "unknown streams",
+			video:      video("/v/a.mp4"),
+			caps:       DefaultCapabilities,
+			urls:       allUrls,
+			wantMethod: MethodDirect,
+			wantUrl:    "direct",
+			wantReason: "the streams are unknown",
+		},
+		{
+			name:       "aliases of the capabilities",
+			video:      video("/v/a.m4v", h264, aac),
+			caps:       Capabilities{Containers: []string{"video/mp4"}, VideoCodecs: []string{"avc1.640028"}, AudioCodecs: []string{"mp4a.40.2"}},
+			urls:       allUrls,
+			wantMethod: MethodDirect,
+			wantUrl:    "direct",
+			wantReason: "every stream is supported",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var plan = Decide(tt.video, tt.caps, tt.urls, tt.audio)
+			if plan.Method != tt.wantMethod || plan.Url != tt.wantUrl {
+				t.Errorf("Decide() = %s %s, want %s %s (reason: %s)", plan.Method, plan.Url, tt.wantMethod, tt.wantUrl, plan.Reason)
+			}
+			if !strings.Contains(plan.Reason, tt.wantReason) {
+				t.Errorf("Decide() reason = %q, want it to contain %q", plan.Reason, tt.wantReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package remux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"full/libs/ffmpeg"
+	"full/libs/models"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+const MimeType string = "video/mp4"
+
+// Codecs that fit inside an MP4 container as they are
+var (
+	copyVideoCodecs = []string{"h264", "hevc", "av1", "vp9", "mpeg4"}
+	copyAudioCodecs = []string{"aac", "mp3", "opus", "flac", "ac3", "eac3"}
+)
+
+var ErrUnsupported = errors.New("the video stream cannot be stored in an MP4 container")
+
+// Options tune a single remux
+type Options struct {
+	// Start is the position of the first frame, the output starts from the key frame before it
+	Start time.Duration
+	// Audio is the only audio track delivered, nil keeps the main one
+	Audio *models.VideoStream
+}
+
+// Supported reports whether the main video stream can be copied into an MP4 container
+func Supported(v *models.Video) bool {
+	var s = v.MainVideoStream()
+	return s != nil && slices.Contains(copyVideoCodecs, strings.ToLower(s.Codec))
+}
+
+func args(v *models.Video, opts Options) []string {
+	var out []string
+	if opts.Start > 0 {
+		out = append(out, "-ss", ffmpeg.Timestamp(opts.Start))
+	}
+	var audio = opts.Audio
+	if audio == nil {
+		audio = v.MainAudioStream()
+	}
+	out = append(out, "-i", v.FilePath, "-map", "0:v:0")
+	if audio != nil {
+		out = append(out, "-map", fmt.Sprintf("0:%d", audio.Index))
+	} else {
+		out = append(out, "-map", "0:a:0?")
+	}
+	out = append(out, "-sn", "-dn", "-c:v", "copy")
+	if s := v.MainVideoStream(); s != nil && strings.EqualFold(s.Codec, "hevc") {
+		// Safari plays HEVC only with the hvc1 tag
+		out = append(out, "-tag:v", "hvc1")
+	}
+
+	if audio == nil || slices.Contains(copyAudioCodecs, strings.ToLower(audio.Codec)) {
+		out = append(out, "-c:a", "copy")
+	} else {
+		// DTS, TrueHD and PCM are not playable by browsers, encoding the audio is cheap
+		out = append(out, "-c:a", "aac", "-ac", "2", "-b:a", "192k")
+	}
+
+	return append(out,
+		"-movflags", "frag_keyframe+empty_moov+default_base_moof",
+		"-f", "mp4", "pipe:1",
+	)
+}
+
+// Stream writes the video as fragmented MP4 into w, without encoding the video
+// again. It returns when the file is over, when ctx is done or when w fails
+func Stream(ctx context.Context, w io.Writer, v *models.Video, opts Options) error {
+	if !Supported(v) {
+		return ErrUnsupported
+	}
+	if opts.Start < 0 || (v.Duration > 0 && opts.Start >= v.Duration) {
+		return fmt.Errorf("start %s is outside of the video", opts.Start)
+	}
+
+	var stderr strings.Builder
+	cmd := ffmpeg.Command(ctx, args(v, opts)...)
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			// The client went away
+			return nil
+		}
+		if msg := strings.TrimSpace(stderr.String()); len(msg) > 0 {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
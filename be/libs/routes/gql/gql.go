@@ -1,9 +1,12 @@
 package gql
 
 import (
+	"context"
 	"embed"
 	"encoding/json"
 	"fmt"
+	"full/libs/models"
+	"full/libs/scanner"
 	"io"
 	"net/http"
 	"reflect"
@@ -14,6 +17,65 @@ import (
 	"gorm.io/gorm"
 )
 
+type contextKey string
+
+const (
+	userKey        contextKey = "user"
+	clientKey      contextKey = "client"
+	videoUpdateKey contextKey = "videoUpdate"
+	scannerKey     contextKey = "scanner"
+)
+
+// WithUser stores the logged user in the context of the request, nil is the anonymous user
+func WithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, userKey, user)
+}
+
+func userFrom(ctx context.Context) *models.User {
+	user, _ := ctx.Value(userKey).(*models.User)
+	return user
+}
+
+// adminFrom returns the logged user, the mutations changing the library require an administrator
+func adminFrom(ctx context.Context) (*models.User, error) {
+	var user = userFrom(ctx)
+	switch {
+	case user == nil:
+		return nil, models.ErrLoginRequired
+	case !user.Perms.IsAdmin:
+		return nil, models.ErrAdminRequired
+	}
+	return user, nil
+}
+
+// WithScanner stores the scanner of the library used by the ScanFolders mutation
+func WithScanner(ctx context.Context, s *scanner.Scanner) context.Context {
+	return context.WithValue(ctx, scannerKey, s)
+}
+
+func scannerFrom(ctx context.Context) *scanner.Scanner {
+	s, _ := ctx.Value(scannerKey).(*scanner.Scanner)
+	return s
+}
+
+// WithVideoUpdate stores the function called with the videos changed by the
+// mutations, it keeps the caches of the server up to date
+func WithVideoUpdate(ctx context.Context, update func(v models.Video)) context.Context {
+	return context.WithValue(ctx, videoUpdateKey, update)
+}
+
+func videoUpdated(ctx context.Context, v *models.Video) {
+	if update, ok := ctx.Value(videoUpdateKey).(func(v models.Video)); ok && update != nil {
+		update(*v)
+	}
+}
+
+// clientFrom returns the user agent of the request
+func clientFrom(ctx context.Context) string {
+	client, _ := ctx.Value(clientKey).(string)
+	return client
+}
+
 type postData struct {
 	Query     string                 `json:"query"`
 	Operation string                 `json:"operationName"`
@@ -29,7 +91,7 @@ func Handler(conn *gorm.DB) func(w http.ResponseWriter, req *http.Request) {
 			return
 		}
 		result := graphql.Do(graphql.Params{
-			Context:        req.Context(),
+			Context:        context.WithValue(req.Context(), clientKey, req.UserAgent()),
 			Schema:         *GetSchema(conn.WithContext(req.Context())),
 			RequestString:  p.Query,
 			VariableValues: p.Variables,
@@ -73,6 +135,23 @@ func getArg[T any](args map[string]any, name string) (val *T, err error) {
 	return &valN, nil
 }
 
+// toStrings converts a list argument to a slice of strings
+func toStrings(value any) ([]string, error) {
+	list, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("cannot convert %v to a list", value)
+	}
+	var out = make([]string, 0, len(list))
+	for _, item := range list {
+		str, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot convert %v to string", item)
+		}
+		out = append(out, str)
+	}
+	return out, nil
+}
+
 //go:embed playground.tmpl
 var playground embed.FS
 
@@ -1,8 +1,10 @@
 package gql
 
 import (
+	"errors"
 	"fmt"
 	"full/libs/models"
+	"time"
 
 	"github.com/graphql-go/graphql"
 	"github.com/rs/zerolog/log"
@@ -18,17 +20,54 @@ func getMutation(conn *gorm.DB) *graphql.Object {
 				Type: *(*models.Folder).GetGQLType(nil),
 				Args: graphql.FieldConfigArgument{
 					"path": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+
+					"include":       &graphql.ArgumentConfig{Type: graphql.NewList(graphql.String), Description: "Glob patterns of the files to scan"},
+					"exclude":       &graphql.ArgumentConfig{Type: graphql.NewList(graphql.String), Description: "Glob patterns of the files and folders to skip, the default ones when missing"},
+					"maxDepth":      &graphql.ArgumentConfig{Type: graphql.Int, Description: "Number of folder levels to scan, 0 means no limit", DefaultValue: 0},
+					"includeHidden": &graphql.ArgumentConfig{Type: graphql.Boolean, Description: "Scan hidden files and folders", DefaultValue: false},
+					"skipSymlinks":  &graphql.ArgumentConfig{Type: graphql.Boolean, Description: "Ignore symbolic links", DefaultValue: false},
 				},
 				Resolve: func(p graphql.ResolveParams) (any, error) {
+					if _, err := adminFrom(p.Context); err != nil {
+						return nil, err
+					}
 					path, err := getArg[string](p.Args, "path")
 					if err != nil {
 						return nil, err
 					}
 
 					folder := models.NewFolder(*path)
-					if tx := conn.WithContext(p.Context).Create(&folder); tx.Error != nil {
-						log.Err(tx.Error).Send()
-						return nil, tx.Error
+					if folder == nil || !folder.IsValidPath() {
+						return nil, fmt.Errorf("`%s` is not a valid folder", *path)
+					}
+
+					folder.Rules = models.DefaultScanRules()
+					folder.Rules.FolderId = folder.Id
+					if include, ok := p.Args["include"]; ok {
+						if folder.Rules.Include, err = toStrings(include); err != nil {
+							return nil, err
+						}
+					}
+					if exclude, ok := p.Args["exclude"]; ok {
+						if folder.Rules.Exclude, err = toStrings(exclude); err != nil {
+							return nil, err
+						}
+					}
+					folder.Rules.MaxDepth, _ = p.Args["maxDepth"].(int)
+					folder.Rules.IncludeHidden, _ = p.Args["includeHidden"].(bool)
+					folder.Rules.SkipSymlinks, _ = p.Args["skipSymlinks"].(bool)
+					if err := folder.Rules.Validate(); err != nil {
+						return nil, err
+					}
+
+					if err := conn.WithContext(p.Context).Transaction(func(tx *gorm.DB) error {
+						if err := tx.Create(folder).Error; err != nil {
+							return err
+						}
+						return folder.Rules.Save(tx)
+					}); err != nil {
+						log.Err(err).Send()
+						return nil, err
 					}
 					return folder, nil
 				},
@@ -40,6 +79,9 @@ func getMutation(conn *gorm.DB) *graphql.Object {
 					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
 				},
 				Resolve: func(p graphql.ResolveParams) (any, error) {
+					if _, err := adminFrom(p.Context); err != nil {
+						return nil, err
+					}
 					id, err := getArg[string](p.Args, "id")
 					if err != nil {
 						return nil, err
@@ -73,6 +115,14 @@ func getMutation(conn *gorm.DB) *graphql.Object {
 					"id": &graphql.ArgumentConfig{Type: graphql.String, Description: "Folder id", DefaultValue: ""},
 				},
 				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					user, err := adminFrom(p.Context)
+					if err != nil {
+						return nil, err
+					}
+					var libScanner = scannerFrom(p.Context)
+					if libScanner == nil {
+						return nil, errors.New("the scanner is not available")
+					}
 					id, err := getArg[string](p.Args, "id")
 					if err != nil {
 						return nil, err
@@ -83,28 +133,346 @@ func getMutation(conn *gorm.DB) *graphql.Object {
 						filter = append(filter, models.Folder{Id: *id})
 					}
 
-					var folders []models.Folder
-					if tx := conn.WithContext(p.Context).Find(&folders, filter...); tx.Error != nil {
-						log.Err(tx.Error).Send()
-						return nil, tx.Error
+					folders, err := models.LoadFolders(conn.WithContext(p.Context), filter...)
+					if err != nil {
+						log.Err(err).Send()
+						return nil, err
+					}
+					if len(*id) > 0 && len(folders) == 0 {
+						return nil, fmt.Errorf("cannot find folder with id=`%s`", *id)
 					}
 
-					var out []*models.Video
+					if err := libScanner.Scan(p.Context, folders...); err != nil {
+						log.Err(err).Send()
+						return nil, err
+					}
+
+					var out = []models.Video{}
 					for _, f := range folders {
-						f.AddOrigin()
-						vids := f.GetVideos()
-						for _, v := range vids {
-							if tx := conn.WithContext(p.Context).FirstOrCreate(&v); tx.Error != nil {
-								log.Err(tx.Error).Send()
-								continue
-							}
-							out = append(out, v)
+						if !f.CanAccess(user) {
+							continue
+						}
+						var vids []models.Video
+						if tx := conn.WithContext(p.Context).Where("folder_id = ? AND attr_exists = ?", f.Id, true).Find(&vids); tx.Error != nil {
+							log.Err(tx.Error).Send()
+							return nil, tx.Error
 						}
+						out = append(out, vids...)
 					}
 
 					return out, nil
 				},
 			},
+			"SaveProgress": &graphql.Field{
+				Name:        "SaveProgress",
+				Description: "Store where the logged user is in a video",
+				Type:        *(*models.WatchProgress).GetGQLType(nil),
+				Args: graphql.FieldConfigArgument{
+					"id":       &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String), Description: "Video ID"},
+					"position": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Float), Description: "Position in the video (seconds)"},
+					"elapsed":  &graphql.ArgumentConfig{Type: graphql.Float, Description: "Playback time since the previous update (seconds)", DefaultValue: 0.0},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					var user = userFrom(p.Context)
+					if user == nil {
+						return nil, models.ErrLoginRequired
+					}
+					vid, err := findVideo(conn, p)
+					if err != nil {
+						return nil, err
+					}
+					position, _ := p.Args["position"].(float64)
+					elapsed, _ := p.Args["elapsed"].(float64)
+
+					progress, err := models.LoadProgress(conn.WithContext(p.Context), user.Id, vid.Id)
+					if err != nil {
+						log.Err(err).Send()
+						return nil, err
+					}
+					if err := progress.Update(vid, time.Duration(position*float64(time.Second)), time.Duration(elapsed*float64(time.Second))); err != nil {
+						return nil, err
+					}
+					if err := progress.Save(conn.WithContext(p.Context)); err != nil {
+						log.Err(err).Send()
+						return nil, err
+					}
+					if err := models.RecordHistory(conn.WithContext(p.Context), user.Id, vid.Id, progress.Position, clientFrom(p.Context)); err != nil {
+						log.Err(err).Send()
+					}
+					if progress.Completed && !vid.Attributes.Watched {
+						if err := vid.SetWatched(conn.WithContext(p.Context), true); err != nil {
+							log.Err(err).Send()
+							return nil, err
+						}
+						videoUpdated(p.Context, vid)
+					}
+					return progress, nil
+				},
+			},
+			"MarkWatched": &graphql.Field{
+				Name:        "MarkWatched",
+				Description: "Mark a video as watched or not for the logged user, for everyone when the user is an administrator",
+				Type:        *(*models.Video).GetGQLType(nil),
+				Args: graphql.FieldConfigArgument{
+					"id":      &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String), Description: "Video ID"},
+					"watched": &graphql.ArgumentConfig{Type: graphql.Boolean, Description: "False rewinds the progress of the user to the start", DefaultValue: true},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					var user = userFrom(p.Context)
+					if user == nil {
+						return nil, models.ErrLoginRequired
+					}
+					vid, err := findVideo(conn, p)
+					if err != nil {
+						return nil, err
+					}
+					watched, _ := p.Args["watched"].(bool)
+					if vid.Progress, err = models.MarkWatched(conn.WithContext(p.Context), vid, user, watched); err != nil {
+						log.Err(err).Send()
+						return nil, err
+					}
+					if user.Perms.IsAdmin {
+						if err := vid.SetWatched(conn.WithContext(p.Context), watched); err != nil {
+							log.Err(err).Send()
+							return nil, err
+						}
+						videoUpdated(p.Context, vid)
+					}
+					return vid, nil
+				},
+			},
+			"TagVideo": &graphql.Field{
+				Name:        "TagVideo",
+				Description: "Change the tags of a video, the logged user must access it",
+				Type:        *(*models.Video).GetGQLType(nil),
+				Args: graphql.FieldConfigArgument{
+					"id":     &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String), Description: "Video ID"},
+					"tags":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.NewList(graphql.String))},
+					"change": &graphql.ArgumentConfig{Type: tagChangeEnum, DefaultValue: models.TagsAdd},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					if userFrom(p.Context) == nil {
+						return nil, models.ErrLoginRequired
+					}
+					vid, err := findVideo(conn, p)
+					if err != nil {
+						return nil, err
+					}
+					tags, err := toStrings(p.Args["tags"])
+					if err != nil {
+						return nil, err
+					}
+					change, _ := p.Args["change"].(models.TagChange)
+					if err := vid.ChangeTags(conn.WithContext(p.Context), change, tags); err != nil {
+						return nil, err
+					}
+					return vid, nil
+				},
+			},
+			"TagPicture": &graphql.Field{
+				Name:        "TagPicture",
+				Description: "Change the tags of a picture, the logged user must access it",
+				Type:        *(*models.Picture).GetGQLType(nil),
+				Args: graphql.FieldConfigArgument{
+					"id":     &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String), Description: "Picture ID"},
+					"tags":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.NewList(graphql.String))},
+					"change": &graphql.ArgumentConfig{Type: tagChangeEnum, DefaultValue: models.TagsAdd},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					if userFrom(p.Context) == nil {
+						return nil, models.ErrLoginRequired
+					}
+					pic, err := findPicture(conn, p)
+					if err != nil {
+						return nil, err
+					}
+					tags, err := toStrings(p.Args["tags"])
+					if err != nil {
+						return nil, err
+					}
+					change, _ := p.Args["change"].(models.TagChange)
+					if err := pic.ChangeTags(conn.WithContext(p.Context), change, tags); err != nil {
+						return nil, err
+					}
+					return pic, nil
+				},
+			},
+			"CreatePlaylist": &graphql.Field{
+				Name:        "CreatePlaylist",
+				Description: "Create a playlist of the logged user, the videos are added in order",
+				Type:        *(*models.Playlist).GetGQLType(nil),
+				Args: graphql.FieldConfigArgument{
+					"name":        &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"description": &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: ""},
+					"visibility":  &graphql.ArgumentConfig{Type: graphql.String, Description: "One of private, shared", DefaultValue: models.PlaylistPrivate},
+					"videoIds":    &graphql.ArgumentConfig{Type: graphql.NewList(graphql.String), Description: "Videos of the playlist"},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					var user = userFrom(p.Context)
+					if user == nil {
+						return nil, models.ErrLoginRequired
+					}
+					name, _ := p.Args["name"].(string)
+					description, _ := p.Args["description"].(string)
+					visibility, _ := p.Args["visibility"].(string)
+					var videoIds []string
+					if value, ok := p.Args["videoIds"]; ok {
+						var err error
+						if videoIds, err = toStrings(value); err != nil {
+							return nil, err
+						}
+					}
+
+					playlist, err := models.NewPlaylist(user, name, description, visibility)
+					if err != nil {
+						return nil, err
+					}
+					if err := conn.WithContext(p.Context).Transaction(func(tx *gorm.DB) error {
+						if err := playlist.Create(tx); err != nil {
+							return err
+						}
+						if len(videoIds) == 0 {
+							return nil
+						}
+						return playlist.AddVideos(tx, user, videoIds)
+					}); err != nil {
+						return nil, err
+					}
+					return withVideos(conn, p, playlist)
+				},
+			},
+			"UpdatePlaylist": &graphql.Field{
+				Name:        "UpdatePlaylist",
+				Description: "Update a playlist of the logged user, the missing fields are kept",
+				Type:        *(*models.Playlist).GetGQLType(nil),
+				Args: graphql.FieldConfigArgument{
+					"id":          &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"name":        &graphql.ArgumentConfig{Type: graphql.String},
+					"description": &graphql.ArgumentConfig{Type: graphql.String},
+					"visibility":  &graphql.ArgumentConfig{Type: graphql.String, Description: "One of private, shared"},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					playlist, err := findPlaylist(conn, p, true)
+					if err != nil {
+						return nil, err
+					}
+					if name, ok := p.Args["name"].(string); ok {
+						playlist.Name = name
+					}
+					if description, ok := p.Args["description"].(string); ok {
+						playlist.Description = description
+					}
+					if visibility, ok := p.Args["visibility"].(string); ok {
+						playlist.Visibility = visibility
+					}
+					if err := playlist.Update(conn.WithContext(p.Context)); err != nil {
+						return nil, err
+					}
+					return withVideos(conn, p, playlist)
+				},
+			},
+			"DeletePlaylist": &graphql.Field{
+				Name:        "DeletePlaylist",
+				Description: "Delete a playlist of the logged user",
+				Type:        *(*models.Playlist).GetGQLType(nil),
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					playlist, err := findPlaylist(conn, p, true)
+					if err != nil {
+						return nil, err
+					}
+					if err := playlist.Delete(conn.WithContext(p.Context)); err != nil {
+						log.Err(err).Send()
+						return nil, err
+					}
+					return playlist, nil
+				},
+			},
+			"AddToPlaylist": &graphql.Field{
+				Name:        "AddToPlaylist",
+				Description: "Append videos at the end of a playlist of the logged user, in order",
+				Type:        *(*models.Playlist).GetGQLType(nil),
+				Args: graphql.FieldConfigArgument{
+					"id":       &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"videoIds": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.NewList(graphql.String))},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					playlist, err := findPlaylist(conn, p, true)
+					if err != nil {
+						return nil, err
+					}
+					videoIds, err := toStrings(p.Args["videoIds"])
+					if err != nil {
+						return nil, err
+					}
+					if err := playlist.AddVideos(conn.WithContext(p.Context), userFrom(p.Context), videoIds); err != nil {
+						return nil, err
+					}
+					return withVideos(conn, p, playlist)
+				},
+			},
+			"RemoveFromPlaylist": &graphql.Field{
+				Name:        "RemoveFromPlaylist",
+				Description: "Remove an entry from a playlist of the logged user",
+				Type:        *(*models.Playlist).GetGQLType(nil),
+				Args: graphql.FieldConfigArgument{
+					"id":      &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"entryId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					playlist, err := findPlaylist(conn, p, true)
+					if err != nil {
+						return nil, err
+					}
+					entryId, _ := p.Args["entryId"].(int)
+					if err := playlist.RemoveEntry(conn.WithContext(p.Context), uint(entryId)); err != nil {
+						return nil, err
+					}
+					return withVideos(conn, p, playlist)
+				},
+			},
+			"ReorderPlaylist": &graphql.Field{
+				Name:        "ReorderPlaylist",
+				Description: "Reorder a playlist of the logged user, entryIds lists the entries in the new order, the ones left out keep their place",
+				Type:        *(*models.Playlist).GetGQLType(nil),
+				Args: graphql.FieldConfigArgument{
+					"id":       &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"entryIds": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.NewList(graphql.Int))},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					playlist, err := findPlaylist(conn, p, true)
+					if err != nil {
+						return nil, err
+					}
+					list, ok := p.Args["entryIds"].([]any)
+					if !ok {
+						return nil, fmt.Errorf("cannot convert %v to a list", p.Args["entryIds"])
+					}
+					var entryIds = make([]uint, 0, len(list))
+					for _, item := range list {
+						id, ok := item.(int)
+						if !ok || id < 0 {
+							return nil, fmt.Errorf("invalid entry id %v", item)
+						}
+						entryIds = append(entryIds, uint(id))
+					}
+					if err := playlist.Reorder(conn.WithContext(p.Context), entryIds); err != nil {
+						return nil, err
+					}
+					return withVideos(conn, p, playlist)
+				},
+			},
 		},
 	})
 }
+
+var tagChangeEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "TagChange",
+	Values: graphql.EnumValueConfigMap{
+		"REPLACE": &graphql.EnumValueConfig{Value: models.TagsReplace, Description: "The given tags take the place of the current ones"},
+		"ADD":     &graphql.EnumValueConfig{Value: models.TagsAdd, Description: "The given tags are added to the current ones"},
+		"REMOVE":  &graphql.EnumValueConfig{Value: models.TagsRemove, Description: "The given tags are removed"},
+	},
+})
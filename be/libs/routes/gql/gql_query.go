@@ -3,6 +3,7 @@ package gql
 import (
 	"fmt"
 	"full/libs/models"
+	"slices"
 
 	"github.com/graphql-go/graphql"
 	"github.com/rs/zerolog/log"
@@ -31,12 +32,49 @@ func getQuery(conn *gorm.DB) *graphql.Object {
 						filters = append(filters, models.Folder{Id: idStr})
 					}
 
-					var folders []models.Folder
-					if tx := conn.WithContext(p.Context).Find(&folders, filters...); tx.Error != nil {
-						log.Err(tx.Error).Send()
-						return nil, tx.Error
+					folders, err := models.LoadFolders(conn.WithContext(p.Context), filters...)
+					if err != nil {
+						log.Err(err).Send()
+						return nil, err
+					}
+					var user = userFrom(p.Context)
+					return slices.DeleteFunc(folders, func(f models.Folder) bool { return !f.CanAccess(user) }), nil
+				},
+			},
+			"FolderTree": &graphql.Field{
+				Name:        "Get folder tree",
+				Description: "Sub folders of a folder with the number of videos and pictures, their size and duration",
+				Type:        *(*models.FolderNode).GetGQLType(nil),
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String), Description: "Folder ID"},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					folder, err := findFolder(conn, p)
+					if err != nil {
+						return nil, err
 					}
-					return folders, nil
+					return folder.Tree(conn.WithContext(p.Context))
+				},
+			},
+			"FolderContents": &graphql.Field{
+				Name:        "Get folder contents",
+				Description: "Page of the files directly inside a sub folder, videos first",
+				Type:        *(*models.FolderContents).GetGQLType(nil),
+				Args: graphql.FieldConfigArgument{
+					"id":     &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String), Description: "Folder ID"},
+					"path":   &graphql.ArgumentConfig{Type: graphql.String, Description: "Sub folder relative to the folder", DefaultValue: ""},
+					"offset": &graphql.ArgumentConfig{Type: graphql.Int, Description: "Number of files to skip", DefaultValue: 0},
+					"limit":  &graphql.ArgumentConfig{Type: graphql.Int, Description: "Number of files of the page", DefaultValue: models.DefaultContentsLimit},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					folder, err := findFolder(conn, p)
+					if err != nil {
+						return nil, err
+					}
+					path, _ := p.Args["path"].(string)
+					offset, _ := p.Args["offset"].(int)
+					limit, _ := p.Args["limit"].(int)
+					return folder.Contents(conn.WithContext(p.Context), path, offset, limit)
 				},
 			},
 			"Videos": &graphql.Field{
@@ -46,6 +84,16 @@ func getQuery(conn *gorm.DB) *graphql.Object {
 				Args: graphql.FieldConfigArgument{
 					"id":      &graphql.ArgumentConfig{Type: graphql.String, Description: "Video ID"},
 					"watched": &graphql.ArgumentConfig{Type: graphql.Boolean, Description: "Filter for watched Y/N"},
+
+					"videoCodec":       &graphql.ArgumentConfig{Type: graphql.String, Description: "Codec of a video stream, like hevc"},
+					"audioCodec":       &graphql.ArgumentConfig{Type: graphql.String, Description: "Codec of an audio stream, like aac"},
+					"minHeight":        &graphql.ArgumentConfig{Type: graphql.Int, Description: "Minimum height of a video stream, like 1080"},
+					"audioLanguage":    &graphql.ArgumentConfig{Type: graphql.String, Description: "Language of an audio stream, like ita"},
+					"subtitleLanguage": &graphql.ArgumentConfig{Type: graphql.String, Description: "Language of a subtitle stream, like eng"},
+
+					"tagsAny":  &graphql.ArgumentConfig{Type: graphql.NewList(graphql.String), Description: "Tags, at least one is required"},
+					"tagsAll":  &graphql.ArgumentConfig{Type: graphql.NewList(graphql.String), Description: "Tags, all of them are required"},
+					"tagsNone": &graphql.ArgumentConfig{Type: graphql.NewList(graphql.String), Description: "Tags, none of them is allowed"},
 				},
 				Resolve: func(p graphql.ResolveParams) (any, error) {
 					var filters []any
@@ -70,14 +118,215 @@ func getQuery(conn *gorm.DB) *graphql.Object {
 						filters = append(filters, data)
 					}
 
+					var streamFilter models.StreamFilter
+					for name, field := range map[string]*string{
+						"videoCodec":       &streamFilter.VideoCodec,
+						"audioCodec":       &streamFilter.AudioCodec,
+						"audioLanguage":    &streamFilter.AudioLanguage,
+						"subtitleLanguage": &streamFilter.SubtitleLanguage,
+					} {
+						if value, ok := p.Args[name].(string); ok {
+							*field = value
+						}
+					}
+					if minHeight, ok := p.Args["minHeight"].(int); ok {
+						streamFilter.MinHeight = minHeight
+					}
+
+					var tagLists = map[string][]string{}
+					for _, name := range []string{"tagsAny", "tagsAll", "tagsNone"} {
+						if value, ok := p.Args[name]; ok {
+							list, err := toStrings(value)
+							if err != nil {
+								return nil, err
+							}
+							tagLists[name] = list
+						}
+					}
+					tagFilter, err := models.NewTagFilter(tagLists["tagsAny"], tagLists["tagsAll"], tagLists["tagsNone"])
+					if err != nil {
+						return nil, err
+					}
+
 					var videos []models.Video
-					if tx := conn.WithContext(p.Context).Find(&videos, filters...); tx.Error != nil {
+					if tx := conn.WithContext(p.Context).Preload("Streams").Preload("Subtitles").Find(&videos, filters...); tx.Error != nil {
 						log.Err(tx.Error).Send()
 						return nil, tx.Error
 					}
-					return videos, nil
+					var user = userFrom(p.Context)
+					accessible, err := models.AccessibleFolders(conn.WithContext(p.Context), user)
+					if err != nil {
+						return nil, err
+					}
+					var progress map[string]models.WatchProgress
+					if user != nil {
+						if progress, err = models.ProgressOf(conn.WithContext(p.Context), user.Id); err != nil {
+							log.Err(err).Send()
+							return nil, err
+						}
+					}
+					tags, err := models.VideoTags(conn.WithContext(p.Context))
+					if err != nil {
+						log.Err(err).Send()
+						return nil, err
+					}
+
+					var out []models.Video
+					for _, v := range videos {
+						v.Tags = tags[v.Id]
+						if v.Folder != nil && accessible[v.Folder.Id] && streamFilter.Match(&v) && tagFilter.Match(v.Tags) {
+							if wp, ok := progress[v.Id]; ok {
+								v.Progress = &wp
+							}
+							out = append(out, v)
+						}
+					}
+					return out, nil
+				},
+			},
+			"Tags": &graphql.Field{
+				Name:        "Get tags",
+				Description: "Tag cloud: the tags in use with the number of videos and pictures the user can access",
+				Type:        graphql.NewList(*(*models.TagCount).GetGQLType(nil)),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return models.TagCloud(conn.WithContext(p.Context), userFrom(p.Context))
+				},
+			},
+			"Playlists": &graphql.Field{
+				Name:        "Get playlists",
+				Description: "Playlists of the logged user and the ones shared by the others, without their videos",
+				Type:        graphql.NewList(*(*models.Playlist).GetGQLType(nil)),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return models.Playlists(conn.WithContext(p.Context), userFrom(p.Context))
+				},
+			},
+			"Playlist": &graphql.Field{
+				Name:        "Get playlist",
+				Description: "Playlist with its videos, the ones the user cannot access are left out",
+				Type:        *(*models.Playlist).GetGQLType(nil),
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String), Description: "Playlist ID"},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					playlist, err := findPlaylist(conn, p, false)
+					if err != nil {
+						return nil, err
+					}
+					return withVideos(conn, p, playlist)
+				},
+			},
+			"Progress": &graphql.Field{
+				Name:        "Get progress",
+				Description: "Progress of the logged user on a video",
+				Type:        *(*models.WatchProgress).GetGQLType(nil),
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String), Description: "Video ID"},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					var user = userFrom(p.Context)
+					if user == nil {
+						return nil, models.ErrLoginRequired
+					}
+					vid, err := findVideo(conn, p)
+					if err != nil {
+						return nil, err
+					}
+					return models.LoadProgress(conn.WithContext(p.Context), user.Id, vid.Id)
 				},
 			},
 		},
 	})
 }
+
+// findPlaylist returns the playlist of the id argument when the user can see it, edit requires the user to own it
+func findPlaylist(conn *gorm.DB, p graphql.ResolveParams, edit bool) (*models.Playlist, error) {
+	id, err := getArg[string](p.Args, "id")
+	if err != nil {
+		return nil, err
+	}
+	var user = userFrom(p.Context)
+	if edit && user == nil {
+		return nil, models.ErrLoginRequired
+	}
+	playlist, err := models.LoadPlaylist(conn.WithContext(p.Context), *id)
+	if err != nil {
+		return nil, err
+	}
+	if !playlist.CanView(user) {
+		return nil, fmt.Errorf("%w with id=`%s`", models.ErrPlaylistNotFound, *id)
+	}
+	if edit && !playlist.CanEdit(user) {
+		return nil, models.ErrPlaylistForbidden
+	}
+	return playlist, nil
+}
+
+// withVideos fills the videos of the playlist the user can access
+func withVideos(conn *gorm.DB, p graphql.ResolveParams, playlist *models.Playlist) (*models.Playlist, error) {
+	if err := playlist.AttachVideos(conn.WithContext(p.Context), userFrom(p.Context)); err != nil {
+		log.Err(err).Send()
+		return nil, err
+	}
+	return playlist, nil
+}
+
+func findVideo(conn *gorm.DB, p graphql.ResolveParams) (*models.Video, error) {
+	id, err := getArg[string](p.Args, "id")
+	if err != nil {
+		return nil, err
+	}
+	var found []models.Video
+	if tx := conn.WithContext(p.Context).Limit(1).Find(&found, models.Video{Id: *id}); tx.Error != nil {
+		log.Err(tx.Error).Send()
+		return nil, tx.Error
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("cannot find video with id=`%s`", *id)
+	}
+	if err := found[0].Folder.Authorize(conn.WithContext(p.Context), userFrom(p.Context)); err != nil {
+		return nil, err
+	}
+	return &found[0], nil
+}
+
+func findPicture(conn *gorm.DB, p graphql.ResolveParams) (*models.Picture, error) {
+	id, err := getArg[string](p.Args, "id")
+	if err != nil {
+		return nil, err
+	}
+	var found []models.Picture
+	if tx := conn.WithContext(p.Context).Limit(1).Find(&found, models.Picture{Id: *id}); tx.Error != nil {
+		log.Err(tx.Error).Send()
+		return nil, tx.Error
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("cannot find picture with id=`%s`", *id)
+	}
+	if err := found[0].Folder.Authorize(conn.WithContext(p.Context), userFrom(p.Context)); err != nil {
+		return nil, err
+	}
+	return &found[0], nil
+}
+
+func findFolder(conn *gorm.DB, p graphql.ResolveParams) (*models.Folder, error) {
+	id, err := getArg[string](p.Args, "id")
+	if err != nil {
+		return nil, err
+	}
+	folders, err := models.LoadFolders(conn.WithContext(p.Context), models.Folder{Id: *id})
+	if err != nil {
+		log.Err(err).Send()
+		return nil, err
+	}
+	switch len(folders) {
+	case 0:
+		return nil, fmt.Errorf("cannot find folder with id=`%s`", *id)
+	case 1:
+		if !folders[0].CanAccess(userFrom(p.Context)) {
+			return nil, fmt.Errorf("folder with id=`%s` requires authentication", *id)
+		}
+		return &folders[0], nil
+	default:
+		return nil, fmt.Errorf("found multiple folders with id=`%s`", *id)
+	}
+}
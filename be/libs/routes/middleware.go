@@ -1,8 +1,11 @@
 package routes
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"full/libs/models"
+	"full/libs/signedurl"
 	"net/http"
 
 	"gorm.io/gorm"
@@ -54,3 +57,45 @@ func CheckAuth(conn *gorm.DB, next func(w http.ResponseWriter, r *http.Request,
 		next(w, r, user, nil)
 	}
 }
+
+type signedVideoKey struct{}
+
+// CheckStreamAuth accepts a signed url in place of the session cookie, for the
+// players which cannot send it. The signature grants the video of the {id} path value
+func CheckStreamAuth(conn *gorm.DB, signer *signedurl.Signer, next func(w http.ResponseWriter, r *http.Request, user *models.User, err error)) func(w http.ResponseWriter, r *http.Request) {
+	var withCookie = CheckAuth(conn, next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		var query = r.URL.Query()
+		if signer == nil || !signedurl.IsSigned(query) {
+			withCookie(w, r)
+			return
+		}
+
+		claims, err := signer.Verify(r.PathValue("id"), query)
+		if err != nil {
+			apiError(w, err, http.StatusUnauthorized)
+			return
+		}
+		var user *models.User = nil
+		if len(claims.UserId) > 0 {
+			var users []models.User
+			if tx := conn.Find(&users, models.User{Id: claims.UserId}); tx.Error != nil {
+				apiError(w, tx.Error, http.StatusInternalServerError)
+				return
+			}
+			// Deleting the user revokes the urls signed for them
+			if len(users) != 1 {
+				apiError(w, fmt.Errorf("%w: cannot find user", signedurl.ErrInvalid), http.StatusUnauthorized)
+				return
+			}
+			user = &users[0]
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), signedVideoKey{}, claims.VideoId)), user, nil)
+	}
+}
+
+// signedVideo returns the id of the video granted by the signed url of the request, if any
+func signedVideo(r *http.Request) string {
+	id, _ := r.Context().Value(signedVideoKey{}).(string)
+	return id
+}
@@ -28,9 +28,11 @@ func (c *Collection[T, K]) New(key K, value T) *Collection[T, K] {
 		return c
 	}
 
-	if err := mergo.Merge((*c)[key], value, mergo.WithOverride, mergo.WithoutDereference); err != nil {
+	var current = (*c)[key]
+	if err := mergo.Merge(&current, value, mergo.WithOverride, mergo.WithoutDereference); err != nil {
 		log.Err(err).Send()
 	}
+	(*c)[key] = current
 
 	return c
 }
@@ -7,12 +7,16 @@ import (
 	"fmt"
 	"full/libs/models"
 	"full/libs/routes/oapi"
+	"full/libs/scanner"
+	"full/libs/signedurl"
 	"full/libs/utils"
+	"full/libs/watcher"
 	"full/libs/webserver"
 	"net/http"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -74,10 +78,16 @@ func apiError(w http.ResponseWriter, err error, statusCode int) {
 	w.Write(b)
 }
 
-func reload(conn *gorm.DB, videos *utils.GS[[]models.Video]) error {
-	Startup(conn)
+func reload(ctx context.Context, conn *gorm.DB, libScanner *scanner.Scanner, videos *utils.GS[[]models.Video]) error {
+	if err := Startup(ctx, conn, libScanner); err != nil {
+		return err
+	}
+	return loadVideoCache(conn.WithContext(ctx), videos)
+}
+
+func loadVideoCache(conn *gorm.DB, videos *utils.GS[[]models.Video]) error {
 	var currentvideos []models.Video
-	if tx := conn.Find(&currentvideos, models.Video{Attributes: models.VideoAttributes{Exists: true}}); tx.Error != nil {
+	if tx := conn.Preload("Streams").Preload("Subtitles").Find(&currentvideos, models.Video{Attributes: models.VideoAttributes{Exists: true}}); tx.Error != nil {
 		return tx.Error
 	}
 	var correctVideos []models.Video = []models.Video{}
@@ -101,93 +111,182 @@ func reload(conn *gorm.DB, videos *utils.GS[[]models.Video]) error {
 				}
 			}
 		}
+		if err := models.PruneTags(conn); err != nil {
+			log.Err(err).Send()
+		}
 	}()
 
-	var before = len(videos.Getter)
+	var before = len(videos.Get())
 	videos.Setter <- correctVideos
-	var after = len(videos.Getter)
+	var after = len(videos.Get())
 	log.Debug().Int("before", before).Int("after", after).Msg("Video reloaded")
 	return nil
 }
 
-func Startup(conn *gorm.DB) error {
-	var folders []models.Folder
-
-	if tx := conn.Delete(models.Video{}, map[string]any{"folder_id": ""}); tx.Error != nil {
+func Startup(ctx context.Context, conn *gorm.DB, libScanner *scanner.Scanner) error {
+	// One by one, the hooks need the id to remove the streams, the subtitles and the tags
+	var orphans []models.Video
+	if tx := conn.WithContext(ctx).Where("folder_id = ?", "").Find(&orphans); tx.Error != nil {
 		log.Err(tx.Error).Send()
 		return tx.Error
 	}
-
-	if tx := conn.Find(&folders); tx.Error != nil {
-		log.Err(tx.Error).Send()
-		return tx.Error
+	for _, v := range orphans {
+		if tx := conn.WithContext(ctx).Delete(&v); tx.Error != nil {
+			log.Err(tx.Error).Send()
+			return tx.Error
+		}
 	}
 
-	for _, f := range folders {
-		for _, v := range f.GetVideos() {
-			var res []models.Video
-			if tx := conn.Find(&res, models.Video{Id: v.Id}); tx.Error != nil {
-				log.Err(tx.Error).Send()
-			}
-			if len(res) == 0 {
-				if err := v.GetDuration(); err != nil {
-					log.Err(err).Str("file", v.FilePath).Str("id", v.Id).Send()
-				}
-				if tx := conn.Create(&v); tx.Error != nil {
-					log.Err(tx.Error).Send()
-					continue
-				}
+	if err := libScanner.Scan(ctx); err != nil {
+		log.Err(err).Send()
+		return err
+	}
+	return nil
+}
 
-				log.Info().Str("id", v.Id).Str("title", v.Title).Msg("Created")
-			} else if !res[0].Attributes.Exists {
-				res[0].Attributes.Exists = true
-				if tx := conn.Model(&res[0]).UpdateColumns(map[string]any{"attr_exists": true}); tx.Error != nil {
-					log.Err(tx.Error).Send()
-					continue
-				}
-				log.Info().Bool("exists", res[0].Attributes.Exists).Str("id", res[0].Id).Msg("Updated video exist flag")
-			}
+// updateVideoCache replaces, adds or removes a single video from the cache
+// depending on whether it still exists on disk
+func updateVideoCache(videos *utils.GS[[]models.Video], v models.Video) {
+	// The progress belongs to the user who asked for the video
+	v.Progress = nil
+	videos.Update(func(current []models.Video) []models.Video {
+		current = slices.Clone(current)
+		var idx = slices.IndexFunc(current, func(c models.Video) bool { return c.Id == v.Id })
+		switch {
+		case idx >= 0 && v.Attributes.Exists:
+			current[idx] = v
+		case idx >= 0:
+			current = slices.Delete(current, idx, idx+1)
+		case v.Attributes.Exists:
+			current = append(current, v)
 		}
+		return current
+	})
+	log.Info().Str("id", v.Id).Bool("exists", v.Attributes.Exists).Msg("Updated video")
+}
 
-		for _, p := range f.GetPictures() {
-			var res []models.Picture
-			if tx := conn.Find(&res, models.Picture{Id: p.Id}); tx.Error != nil {
-				log.Err(tx.Error).Send()
-			}
-			if len(res) == 0 {
-				if tx := conn.Create(&p); tx.Error != nil {
-					log.Err(tx.Error).Send()
-					continue
-				}
-			}
+// markWatched answers the requests marking a video as watched or not for the
+// logged user, the administrators change the flag shared by every user too
+func markWatched(w http.ResponseWriter, r *http.Request, conn *gorm.DB, videos *utils.GS[[]models.Video], user *models.User, watched bool) {
+	if user == nil {
+		apiError(w, errors.New("login required"), http.StatusUnauthorized)
+		return
+	}
+	vid, status, err := findVideo(conn, r, r.PathValue("id"), user)
+	if err != nil {
+		apiError(w, err, status)
+		return
+	}
+	progress, err := models.MarkWatched(conn.WithContext(r.Context()), vid, user, watched)
+	if err != nil {
+		log.Err(err).Send()
+		apiError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if user.Perms.IsAdmin {
+		if err := vid.SetWatched(conn.WithContext(r.Context()), watched); err != nil {
+			log.Err(err).Send()
+			apiError(w, err, http.StatusInternalServerError)
+			return
 		}
+		updateVideoCache(videos, *vid)
+	}
+
+	vid.Progress = progress
+	if err := ApiResponseS(w, vid); err != nil {
+		apiError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// tagsBody is the request body changing the tags of a video or a picture
+type tagsBody struct {
+	Tags []string `json:"tags"`
+}
+
+// tagVideo answers the requests changing the tags of a video
+func tagVideo(w http.ResponseWriter, r *http.Request, conn *gorm.DB, videos *utils.GS[[]models.Video], user *models.User, change models.TagChange) {
+	if user == nil {
+		apiError(w, errors.New("login required"), http.StatusUnauthorized)
+		return
+	}
+	vid, status, err := findVideo(conn, r, r.PathValue("id"), user)
+	if err != nil {
+		apiError(w, err, status)
+		return
+	}
+	body, err := decodeBody[tagsBody](r)
+	if err != nil {
+		apiError(w, err, http.StatusBadRequest)
+		return
+	}
+	if err := vid.ChangeTags(conn.WithContext(r.Context()), change, body.Tags); err != nil {
+		apiError(w, err, http.StatusBadRequest)
+		return
+	}
+	updateVideoCache(videos, *vid)
+
+	if err := ApiResponseS(w, vid); err != nil {
+		apiError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// tagPicture answers the requests changing the tags of a picture
+func tagPicture(w http.ResponseWriter, r *http.Request, conn *gorm.DB, user *models.User, change models.TagChange) {
+	if user == nil {
+		apiError(w, errors.New("login required"), http.StatusUnauthorized)
+		return
+	}
+	pic, status, err := findPicture(conn, r, r.PathValue("id"), user)
+	if err != nil {
+		apiError(w, err, status)
+		return
+	}
+	body, err := decodeBody[tagsBody](r)
+	if err != nil {
+		apiError(w, err, http.StatusBadRequest)
+		return
+	}
+	if err := pic.ChangeTags(conn.WithContext(r.Context()), change, body.Tags); err != nil {
+		apiError(w, err, http.StatusBadRequest)
+		return
+	}
+	if err := ApiResponseS(w, pic); err != nil {
+		apiError(w, err, http.StatusInternalServerError)
 	}
-	return nil
 }
 
-func handleApiV1(apiv1 *webserver.Mux, conn *gorm.DB, videoUpdated <-chan models.Video) *webserver.Mux {
-	var videos = utils.NewGetterSetter[[]models.Video](nil)
-	if err := reload(conn, videos); err != nil {
+// playlistResponse answers with the playlist and the videos the user can access
+func playlistResponse(w http.ResponseWriter, r *http.Request, conn *gorm.DB, playlist *models.Playlist, user *models.User) {
+	if err := playlist.AttachVideos(conn.WithContext(r.Context()), user); err != nil {
+		log.Err(err).Send()
+		apiError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if err := ApiResponseS(w, playlist); err != nil {
+		apiError(w, err, http.StatusInternalServerError)
+	}
+}
+
+func handleApiV1(apiv1 *webserver.Mux, conn *gorm.DB, videos *utils.GS[[]models.Video], fsWatcher *watcher.Watcher, libScanner *scanner.Scanner, signer *signedurl.Signer) *webserver.Mux {
+	if err := loadVideoCache(conn, videos); err != nil {
 		log.Err(err).Send()
 	}
 
+	go func() {
+		if err := reload(context.Background(), conn, libScanner, videos); err != nil {
+			log.Err(err).Send()
+		}
+	}()
+
 	go func() {
 		ticker := time.NewTicker(time.Minute)
-		for {
-			select {
-			case v1 := <-videoUpdated:
-				var mut sync.Mutex
-				mut.Lock()
-				for idx, v2 := range videos.Getter {
-					if v1.Id == v2.Id {
-						videos.Getter[idx] = v1
-						log.Info().Str("id", v1.Id).Msg("Updated video")
-					}
-				}
-				mut.Unlock()
-			case <-ticker.C:
+		for range ticker.C {
+			if fsWatcher == nil {
 				continue
 			}
+			if err := fsWatcher.Sync(); err != nil {
+				log.Err(err).Send()
+			}
 		}
 	}()
 
@@ -202,15 +301,2448 @@ func handleApiV1(apiv1 *webserver.Mux, conn *gorm.DB, videoUpdated <-chan models
 						Content: oapi.MediaTypeCollection{
 							"application/json": oapi.OpenApiMediaType{
 								Schema: oapi.OpenApiSchema{
-									Type: "array",
-									Items: &oapi.OpenApiSchema{
-										Ref: o.GetRef("schemas", "folder"),
-									},
+									Type: "array",
+									Items: &oapi.OpenApiSchema{
+										Ref: o.GetRef("schemas", "folder"),
+									},
+								},
+							},
+						},
+					},
+					http.StatusInternalServerError: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			folders, err := models.LoadFolders(conn.WithContext(r.Context()))
+			if err != nil {
+				apiError(w, err, http.StatusInternalServerError)
+				return
+			}
+			folders = slices.DeleteFunc(folders, func(f models.Folder) bool { return !f.CanAccess(user) })
+
+			if err := ApiResponseM(w, folders); err != nil {
+				apiError(w, err, http.StatusInternalServerError)
+			}
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("GET /folders/{id}/tree", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/folders/{id}/tree", oapi.OpenApiPathItem{
+			Get: &oapi.OpenApiOperation{
+				Tags:    []string{"Folders"},
+				Summary: "Sub folders tree with the number of videos and pictures, their size and duration",
+				Parameters: []oapi.OpenApiParameter{
+					{Name: "id", In: "path", Required: true, Schema: oapi.GetSchema("string")},
+				},
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"result": oapi.OpenApiSchema{
+											Ref: o.GetRef("schemas", "folder-node"),
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusNotFound: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			folder, status, err := findFolder(conn, r, r.PathValue("id"), user)
+			if err != nil {
+				apiError(w, err, status)
+				return
+			}
+
+			tree, err := folder.Tree(conn.WithContext(r.Context()))
+			if err != nil {
+				apiError(w, err, http.StatusInternalServerError)
+				return
+			}
+			if err := ApiResponseS(w, tree); err != nil {
+				apiError(w, err, http.StatusInternalServerError)
+			}
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("GET /folders/{id}/contents", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/folders/{id}/contents", oapi.OpenApiPathItem{
+			Get: &oapi.OpenApiOperation{
+				Tags:    []string{"Folders"},
+				Summary: "Page of the files directly inside a sub folder, videos first",
+				Parameters: []oapi.OpenApiParameter{
+					{Name: "id", In: "path", Required: true, Schema: oapi.GetSchema("string")},
+					{Name: "path", In: "query", Description: "Sub folder relative to the folder, the folder itself when empty", Schema: oapi.GetSchema("string")},
+					{Name: "offset", In: "query", Description: "Number of files to skip", Schema: oapi.GetSchema(0)},
+					{Name: "limit", In: "query", Description: fmt.Sprintf("Number of files of the page, at most %d", models.MaxContentsLimit), Schema: oapi.GetSchema(models.DefaultContentsLimit)},
+				},
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"result": oapi.OpenApiSchema{
+											Ref: o.GetRef("schemas", "folder-contents"),
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusBadRequest: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			folder, status, err := findFolder(conn, r, r.PathValue("id"), user)
+			if err != nil {
+				apiError(w, err, status)
+				return
+			}
+
+			offset, limit, err := pageFromQuery(r)
+			if err != nil {
+				apiError(w, err, http.StatusBadRequest)
+				return
+			}
+			contents, err := folder.Contents(conn.WithContext(r.Context()), r.URL.Query().Get("path"), offset, limit)
+			if err != nil {
+				apiError(w, err, http.StatusBadRequest)
+				return
+			}
+			if err := ApiResponseS(w, contents); err != nil {
+				apiError(w, err, http.StatusInternalServerError)
+			}
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("GET /videos", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/videos", oapi.OpenApiPathItem{
+			Get: &oapi.OpenApiOperation{
+				Tags:       []string{"Videos"},
+				Summary:    "Get videos",
+				Parameters: append(streamFilterParameters(), tagFilterParameters()...),
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"results": oapi.OpenApiSchema{
+											Type: "array",
+											Items: &oapi.OpenApiSchema{
+												Ref: o.GetRef("schemas", "video"),
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusInternalServerError: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			streamFilter, err := streamFilterFromQuery(r)
+			if err != nil {
+				apiError(w, err, http.StatusBadRequest)
+				return
+			}
+			tagFilter, err := tagFilterFromQuery(r)
+			if err != nil {
+				apiError(w, err, http.StatusBadRequest)
+				return
+			}
+			accessible, err := models.AccessibleFolders(conn.WithContext(r.Context()), user)
+			if err != nil {
+				log.Err(err).Send()
+				apiError(w, err, http.StatusInternalServerError)
+				return
+			}
+			// The tags change without touching the videos, the cache does not keep them up to date
+			tags, err := models.VideoTags(conn.WithContext(r.Context()))
+			if err != nil {
+				log.Err(err).Send()
+				apiError(w, err, http.StatusInternalServerError)
+				return
+			}
+
+			var progress map[string]models.WatchProgress
+			if user != nil {
+				if progress, err = models.ProgressOf(conn.WithContext(r.Context()), user.Id); err != nil {
+					log.Err(err).Send()
+					apiError(w, err, http.StatusInternalServerError)
+					return
+				}
+			}
+
+			var vids []*models.Video
+			for _, v := range videos.Get() {
+				v.Tags = tags[v.Id]
+				if v.Folder != nil && accessible[v.Folder.Id] && streamFilter.Match(&v) && tagFilter.Match(v.Tags) {
+					if p, ok := progress[v.Id]; ok {
+						v.Progress = &p
+					}
+					vids = append(vids, &v)
+				}
+			}
+
+			if err := ApiResponseM(w, vids); err != nil {
+				apiError(w, err, http.StatusInternalServerError)
+			}
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("GET /reload-data", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/reload-data", oapi.OpenApiPathItem{
+			Get: &oapi.OpenApiOperation{
+				Tags:    []string{"Reload data"},
+				Summary: "Reload data",
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"text/plain": oapi.OpenApiMediaType{
+								Schema: oapi.GetSchema("string"),
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusForbidden: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusInternalServerError: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, req *http.Request, user *models.User, err error) {
+			if status, err := requireAdmin(user); err != nil {
+				apiError(w, err, status)
+				return
+			}
+			if err := reload(req.Context(), conn, libScanner, videos); err != nil {
+				if errors.Is(err, scanner.ErrAlreadyRunning) {
+					apiError(w, err, http.StatusConflict)
+					return
+				}
+				apiError(w, err, http.StatusInternalServerError)
+				return
+			}
+			w.Write([]byte("ok"))
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("GET /scan", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/scan", oapi.OpenApiPathItem{
+			Get: &oapi.OpenApiOperation{
+				Tags:    []string{"Reload data"},
+				Summary: "Scan progress",
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"result": oapi.OpenApiSchema{
+											Ref: o.GetRef("schemas", "scan-progress"),
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return func(w http.ResponseWriter, req *http.Request) {
+			var progress = libScanner.Progress()
+			if err := ApiResponseS(w, &progress); err != nil {
+				apiError(w, err, http.StatusInternalServerError)
+			}
+		}
+	})
+
+	apiv1.HandleFuncWithOApi("DELETE /scan", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/scan", oapi.OpenApiPathItem{
+			Delete: &oapi.OpenApiOperation{
+				Tags:    []string{"Reload data"},
+				Summary: "Cancel the running scan",
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"text/plain": oapi.OpenApiMediaType{
+								Schema: oapi.GetSchema("string"),
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusForbidden: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusNotFound: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, req *http.Request, user *models.User, err error) {
+			if status, err := requireAdmin(user); err != nil {
+				apiError(w, err, status)
+				return
+			}
+			if !libScanner.Cancel() {
+				apiError(w, errors.New("no scan is running"), http.StatusNotFound)
+				return
+			}
+			w.Write([]byte("ok"))
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("GET /videos/duplicates", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/videos/duplicates", oapi.OpenApiPathItem{
+			Get: &oapi.OpenApiOperation{
+				Tags:    []string{"Videos"},
+				Summary: "Groups of videos with the same size, duration and content, the ones wasting more space first",
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"results": oapi.OpenApiSchema{
+											Type: "array",
+											Items: &oapi.OpenApiSchema{
+												Ref: o.GetRef("schemas", "duplicate-group"),
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			if status, err := requireAdmin(user); err != nil {
+				apiError(w, err, status)
+				return
+			}
+
+			groups, err := models.FindDuplicates(conn.WithContext(r.Context()))
+			if err != nil {
+				apiError(w, err, http.StatusInternalServerError)
+				return
+			}
+			if err := ApiResponseM(w, groups); err != nil {
+				apiError(w, err, http.StatusInternalServerError)
+			}
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("POST /videos/duplicates/keep", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/videos/duplicates/keep", oapi.OpenApiPathItem{
+			Post: &oapi.OpenApiOperation{
+				Tags:    []string{"Videos"},
+				Summary: "Keep a video and delete the other copies of its duplicate group",
+				RequestBody: &oapi.OpenApiRequestBody{
+					Required: true,
+					Content: oapi.MediaTypeCollection{
+						"application/json": oapi.OpenApiMediaType{
+							Schema: oapi.OpenApiSchema{
+								Type: "object",
+								Properties: oapi.SchemaCollection{
+									"id":          oapi.GetSchema("string"),
+									"removeFiles": oapi.GetSchema(true),
+								},
+							},
+						},
+					},
+				},
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"results": oapi.OpenApiSchema{
+											Type: "array",
+											Items: &oapi.OpenApiSchema{
+												Ref: o.GetRef("schemas", "video"),
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusBadRequest: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusForbidden: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			if status, err := requireAdmin(user); err != nil {
+				apiError(w, err, status)
+				return
+			}
+
+			body, err := decodeBody[struct {
+				Id          string `json:"id"`
+				RemoveFiles bool   `json:"removeFiles"`
+			}](r)
+			if err != nil {
+				apiError(w, err, http.StatusBadRequest)
+				return
+			}
+			// Without their files the copies would come back with the next scan
+			if !body.RemoveFiles {
+				apiError(w, errors.New("removeFiles is required, the scan adds back the copies left on the disk"), http.StatusBadRequest)
+				return
+			}
+
+			group, err := models.FindDuplicateGroup(conn.WithContext(r.Context()), body.Id)
+			if err != nil {
+				apiError(w, err, http.StatusBadRequest)
+				return
+			}
+			others, err := group.Others(body.Id)
+			if err != nil {
+				apiError(w, err, http.StatusBadRequest)
+				return
+			}
+
+			var deleted []models.Video
+			for _, v := range others {
+				if err := v.Delete(conn, true); err != nil {
+					log.Err(err).Str("id", v.Id).Send()
+					continue
+				}
+				v.Attributes.Exists = false
+				updateVideoCache(videos, v)
+				deleted = append(deleted, v)
+			}
+			if len(deleted) < len(others) {
+				apiError(w, fmt.Errorf("deleted %d of %d videos", len(deleted), len(others)), http.StatusInternalServerError)
+				return
+			}
+			if err := ApiResponseM(w, deleted); err != nil {
+				apiError(w, err, http.StatusInternalServerError)
+			}
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("GET /pictures", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/pictures", oapi.OpenApiPathItem{
+			Get: &oapi.OpenApiOperation{
+				Tags:       []string{"Pictures"},
+				Summary:    "Picture list",
+				Parameters: tagFilterParameters(),
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"results": oapi.OpenApiSchema{
+											Type: "array",
+											Items: &oapi.OpenApiSchema{
+												Ref: o.GetRef("schemas", "picture"),
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusInternalServerError: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			tagFilter, err := tagFilterFromQuery(r)
+			if err != nil {
+				apiError(w, err, http.StatusBadRequest)
+				return
+			}
+			accessible, err := models.AccessibleFolders(conn.WithContext(r.Context()), user)
+			if err != nil {
+				apiError(w, err, http.StatusInternalServerError)
+				return
+			}
+			var pics []models.Picture
+			if tx := conn.WithContext(r.Context()).Find(&pics); tx.Error != nil {
+				apiError(w, tx.Error, http.StatusInternalServerError)
+				return
+			}
+			tags, err := models.PictureTags(conn.WithContext(r.Context()))
+			if err != nil {
+				apiError(w, err, http.StatusInternalServerError)
+				return
+			}
+			for i := range pics {
+				pics[i].Tags = tags[pics[i].Id]
+			}
+			pics = slices.DeleteFunc(pics, func(p models.Picture) bool {
+				return p.Folder == nil || !accessible[p.Folder.Id] || !tagFilter.Match(p.Tags)
+			})
+			if err := ApiResponseM(w, pics); err != nil {
+				apiError(w, err, http.StatusInternalServerError)
+			}
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("GET /pictures/info/{id}", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/pictures/info/{id}", oapi.OpenApiPathItem{
+			Get: &oapi.OpenApiOperation{
+				Tags:    []string{"Pictures"},
+				Summary: "Picture info",
+				Parameters: []oapi.OpenApiParameter{
+					{
+						Name:            "id",
+						In:              "path",
+						Required:        true,
+						AllowEmptyValue: false,
+						Deprecated:      false,
+						Schema:          oapi.GetSchema("string"),
+					},
+				},
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"result": oapi.OpenApiSchema{
+											Ref: o.GetRef("schemas", "picture"),
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusForbidden: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusInternalServerError: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			pic, status, err := findPicture(conn, r, r.PathValue("id"), user)
+			if err != nil {
+				apiError(w, err, status)
+				return
+			}
+			if err := pic.LoadTags(conn.WithContext(r.Context())); err != nil {
+				apiError(w, err, http.StatusInternalServerError)
+				return
+			}
+			if err := ApiResponseS(w, pic); err != nil {
+				apiError(w, err, http.StatusInternalServerError)
+			}
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("GET /whoami", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/whoami", oapi.OpenApiPathItem{
+			Get: &oapi.OpenApiOperation{
+				Tags:    []string{"User"},
+				Summary: "User info",
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"result": oapi.OpenApiSchema{
+											Type: "object",
+											Properties: oapi.SchemaCollection{
+												"user": oapi.OpenApiSchema{
+													Ref: o.GetRef("schemas", "user"),
+												},
+												"session": oapi.OpenApiSchema{
+													Ref: o.GetRef("schemas", "session"),
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusInternalServerError: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			if err != nil {
+				apiError(w, err, http.StatusUnauthorized)
+				return
+			}
+			if user == nil {
+				apiError(w, errors.New("error while trying to get the logged user"), http.StatusInternalServerError)
+				return
+			}
+
+			var sessions []models.Session
+			if tx := conn.WithContext(r.Context()).Find(&sessions, models.Session{UserId: user.Id}); tx.Error != nil {
+				apiError(w, errors.New("error while trying to get the user session"), http.StatusInternalServerError)
+				return
+			}
+
+			var session *models.Session
+			if len(sessions) == 1 {
+				session = &sessions[0]
+			}
+
+			user.PasswordHashed = ""
+			if err := ApiResponseS(w, &map[string]any{
+				"user":    user,
+				"session": session,
+			}); err != nil {
+				apiError(w, err, http.StatusInternalServerError)
+			}
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("PUT /preferences", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/preferences", oapi.OpenApiPathItem{
+			Put: &oapi.OpenApiOperation{
+				Tags:    []string{"User"},
+				Summary: "Update the preferences of the logged user, the missing fields are kept",
+				RequestBody: &oapi.OpenApiRequestBody{
+					Required: true,
+					Content: oapi.MediaTypeCollection{
+						"application/json": oapi.OpenApiMediaType{
+							Schema: oapi.OpenApiSchema{
+								Ref: o.GetRef("schemas", "preferences"),
+							},
+						},
+					},
+				},
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"result": oapi.OpenApiSchema{
+											Ref: o.GetRef("schemas", "preferences"),
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusBadRequest: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			if err != nil || user == nil {
+				apiError(w, errors.New("login required"), http.StatusUnauthorized)
+				return
+			}
+
+			body, err := decodeBody[struct {
+				MaxQuality    *int    `json:"maxQuality"`
+				AudioLanguage *string `json:"audioLanguage"`
+			}](r)
+			if err != nil {
+				apiError(w, err, http.StatusBadRequest)
+				return
+			}
+			if body.MaxQuality != nil {
+				user.Preferences.MaxQuality = *body.MaxQuality
+			}
+			if body.AudioLanguage != nil {
+				user.Preferences.AudioLanguage = *body.AudioLanguage
+			}
+			if err := user.SavePreferences(conn.WithContext(r.Context())); err != nil {
+				apiError(w, err, http.StatusBadRequest)
+				return
+			}
+			if err := ApiResponseS(w, &user.Preferences); err != nil {
+				apiError(w, err, http.StatusInternalServerError)
+			}
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("POST /videos/{id}/signed-url", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/videos/{id}/signed-url", oapi.OpenApiPathItem{
+			Post: &oapi.OpenApiOperation{
+				Tags:    []string{"Videos"},
+				Summary: "Sign expiring stream urls of the video for the players which cannot send the session cookie",
+				Parameters: []oapi.OpenApiParameter{
+					{Name: "id", In: "path", Required: true, Schema: oapi.GetSchema("string")},
+				},
+				RequestBody: &oapi.OpenApiRequestBody{
+					Required: true,
+					Content: oapi.MediaTypeCollection{
+						"application/json": oapi.OpenApiMediaType{
+							Schema: oapi.OpenApiSchema{
+								Type: "object",
+								Properties: oapi.SchemaCollection{
+									"expiresIn": oapi.GetSchema(0),
+									"bindUser":  oapi.GetSchema(true),
+								},
+							},
+						},
+					},
+				},
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"result": oapi.OpenApiSchema{
+											Ref: o.GetRef("schemas", "signed-urls"),
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusBadRequest: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusNotFound: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			if signer == nil {
+				apiError(w, errors.New("signed urls are disabled"), http.StatusNotFound)
+				return
+			}
+			if err != nil || user == nil {
+				apiError(w, errors.New("login required"), http.StatusUnauthorized)
+				return
+			}
+
+			body, err := decodeBody[struct {
+				// ExpiresIn is the lifetime of the urls in seconds
+				ExpiresIn int64 `json:"expiresIn"`
+				// BindUser signs the urls on behalf of the user, they stop working when the user is deleted
+				BindUser bool `json:"bindUser"`
+			}](r)
+			if err != nil {
+				apiError(w, err, http.StatusBadRequest)
+				return
+			}
+			var lifetime = time.Duration(body.ExpiresIn) * time.Second
+			if lifetime == 0 {
+				lifetime = signedurl.DefaultLifetime
+			}
+			if lifetime < 0 || lifetime > signedurl.MaxLifetime {
+				apiError(w, fmt.Errorf("expiresIn must be between 1 and %d seconds", int64(signedurl.MaxLifetime/time.Second)), http.StatusBadRequest)
+				return
+			}
+
+			vid, status, err := findVideo(conn, r, r.PathValue("id"), user)
+			if err != nil {
+				apiError(w, err, status)
+				return
+			}
+
+			var claims = signedurl.Claims{VideoId: vid.Id, Expires: time.Now().Add(lifetime).Truncate(time.Second)}
+			if body.BindUser {
+				claims.UserId = user.Id
+			}
+			var out = newSignedUrls(vid, claims.Expires, signer.Sign(claims).Encode())
+			if err := ApiResponseS(w, &out); err != nil {
+				apiError(w, err, http.StatusInternalServerError)
+			}
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("GET /videos/{id}/progress", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/videos/{id}/progress", oapi.OpenApiPathItem{
+			Get: &oapi.OpenApiOperation{
+				Tags:    []string{"Videos"},
+				Summary: "Progress of the logged user on the video",
+				Parameters: []oapi.OpenApiParameter{
+					{Name: "id", In: "path", Required: true, Schema: oapi.GetSchema("string")},
+				},
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"result": oapi.OpenApiSchema{
+											Ref: o.GetRef("schemas", "watch-progress"),
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusForbidden: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusNotFound: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			if err != nil || user == nil {
+				apiError(w, errors.New("login required"), http.StatusUnauthorized)
+				return
+			}
+			vid, status, err := findVideo(conn, r, r.PathValue("id"), user)
+			if err != nil {
+				apiError(w, err, status)
+				return
+			}
+			progress, err := models.LoadProgress(conn.WithContext(r.Context()), user.Id, vid.Id)
+			if err != nil {
+				log.Err(err).Send()
+				apiError(w, err, http.StatusInternalServerError)
+				return
+			}
+			if err := ApiResponseS(w, progress); err != nil {
+				apiError(w, err, http.StatusInternalServerError)
+			}
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("PUT /videos/{id}/progress", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/videos/{id}/progress", oapi.OpenApiPathItem{
+			Put: &oapi.OpenApiOperation{
+				Tags:    []string{"Videos"},
+				Summary: "Store where the logged user is in the video, position and elapsed are seconds",
+				Parameters: []oapi.OpenApiParameter{
+					{Name: "id", In: "path", Required: true, Schema: oapi.GetSchema("string")},
+				},
+				RequestBody: &oapi.OpenApiRequestBody{
+					Required: true,
+					Content: oapi.MediaTypeCollection{
+						"application/json": oapi.OpenApiMediaType{
+							Schema: oapi.OpenApiSchema{
+								Type: "object",
+								Properties: oapi.SchemaCollection{
+									"position": oapi.GetSchema(float64(0)),
+									"elapsed":  oapi.GetSchema(float64(0)),
+								},
+							},
+						},
+					},
+				},
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"result": oapi.OpenApiSchema{
+											Ref: o.GetRef("schemas", "watch-progress"),
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusBadRequest: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusForbidden: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusNotFound: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			if err != nil || user == nil {
+				apiError(w, errors.New("login required"), http.StatusUnauthorized)
+				return
+			}
+			body, err := decodeBody[struct {
+				// Position is in seconds like the GraphQL API
+				Position *float64 `json:"position"`
+				// Elapsed is the playback time since the previous update, in seconds
+				Elapsed float64 `json:"elapsed"`
+			}](r)
+			if err != nil {
+				apiError(w, err, http.StatusBadRequest)
+				return
+			}
+			if body.Position == nil {
+				apiError(w, errors.New("position is required"), http.StatusBadRequest)
+				return
+			}
+			vid, status, err := findVideo(conn, r, r.PathValue("id"), user)
+			if err != nil {
+				apiError(w, err, status)
+				return
+			}
+
+			progress, err := models.LoadProgress(conn.WithContext(r.Context()), user.Id, vid.Id)
+			if err != nil {
+				log.Err(err).Send()
+				apiError(w, err, http.StatusInternalServerError)
+				return
+			}
+			if err := progress.Update(vid, time.Duration(*body.Position*float64(time.Second)), time.Duration(body.Elapsed*float64(time.Second))); err != nil {
+				apiError(w, err, http.StatusBadRequest)
+				return
+			}
+			if err := progress.Save(conn.WithContext(r.Context())); err != nil {
+				log.Err(err).Send()
+				apiError(w, err, http.StatusInternalServerError)
+				return
+			}
+			if err := models.RecordHistory(conn.WithContext(r.Context()), user.Id, vid.Id, progress.Position, r.UserAgent()); err != nil {
+				log.Err(err).Send()
+			}
+			if progress.Completed && !vid.Attributes.Watched {
+				if err := vid.SetWatched(conn.WithContext(r.Context()), true); err != nil {
+					log.Err(err).Send()
+					apiError(w, err, http.StatusInternalServerError)
+					return
+				}
+				updateVideoCache(videos, *vid)
+			}
+			if err := ApiResponseS(w, progress); err != nil {
+				apiError(w, err, http.StatusInternalServerError)
+			}
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("POST /videos/{id}/watched", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/videos/{id}/watched", oapi.OpenApiPathItem{
+			Post: &oapi.OpenApiOperation{
+				Tags:    []string{"Videos"},
+				Summary: "Mark the video as watched for the logged user, for everyone when the user is an administrator",
+				Parameters: []oapi.OpenApiParameter{
+					{Name: "id", In: "path", Required: true, Schema: oapi.GetSchema("string")},
+				},
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"result": oapi.OpenApiSchema{
+											Ref: o.GetRef("schemas", "video"),
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusForbidden: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusNotFound: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			markWatched(w, r, conn, videos, user, true)
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("DELETE /videos/{id}/watched", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/videos/{id}/watched", oapi.OpenApiPathItem{
+			Delete: &oapi.OpenApiOperation{
+				Tags:    []string{"Videos"},
+				Summary: "Mark the video as not watched for the logged user, their progress goes back to the start. Administrators clear the flag for everyone",
+				Parameters: []oapi.OpenApiParameter{
+					{Name: "id", In: "path", Required: true, Schema: oapi.GetSchema("string")},
+				},
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"result": oapi.OpenApiSchema{
+											Ref: o.GetRef("schemas", "video"),
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusForbidden: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusNotFound: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			markWatched(w, r, conn, videos, user, false)
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("GET /history", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/history", oapi.OpenApiPathItem{
+			Get: &oapi.OpenApiOperation{
+				Tags:    []string{"History"},
+				Summary: "Page of the playback sessions of the logged user, the latest first",
+				Parameters: []oapi.OpenApiParameter{
+					{Name: "offset", In: "query", Description: "Number of sessions to skip", Schema: oapi.GetSchema(0)},
+					{Name: "limit", In: "query", Description: fmt.Sprintf("Number of sessions of the page, at most %d", models.MaxHistoryLimit), Schema: oapi.GetSchema(models.DefaultHistoryLimit)},
+				},
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"result": oapi.OpenApiSchema{
+											Ref: o.GetRef("schemas", "history-page"),
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusBadRequest: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			if err != nil || user == nil {
+				apiError(w, errors.New("login required"), http.StatusUnauthorized)
+				return
+			}
+			offset, limit, err := pageFromQuery(r)
+			if err != nil {
+				apiError(w, err, http.StatusBadRequest)
+				return
+			}
+			page, err := models.History(conn.WithContext(r.Context()), user, offset, limit)
+			if err != nil {
+				log.Err(err).Send()
+				apiError(w, err, http.StatusInternalServerError)
+				return
+			}
+			if err := ApiResponseS(w, page); err != nil {
+				apiError(w, err, http.StatusInternalServerError)
+			}
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("DELETE /history", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/history", oapi.OpenApiPathItem{
+			Delete: &oapi.OpenApiOperation{
+				Tags:    []string{"History"},
+				Summary: "Clear the playback sessions of the logged user, the progress is kept",
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"text/plain": oapi.OpenApiMediaType{
+								Schema: oapi.GetSchema("string"),
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			if err != nil || user == nil {
+				apiError(w, errors.New("login required"), http.StatusUnauthorized)
+				return
+			}
+			deleted, err := models.ClearHistory(conn.WithContext(r.Context()), user)
+			if err != nil {
+				log.Err(err).Send()
+				apiError(w, err, http.StatusInternalServerError)
+				return
+			}
+			log.Info().Str("user", user.Id).Int64("deleted", deleted).Msg("History cleared")
+			w.Write([]byte("ok"))
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("GET /continue-watching", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/continue-watching", oapi.OpenApiPathItem{
+			Get: &oapi.OpenApiOperation{
+				Tags:    []string{"History"},
+				Summary: "Videos the logged user started and did not finish, the last watched first",
+				Parameters: []oapi.OpenApiParameter{
+					{Name: "limit", In: "query", Description: fmt.Sprintf("Number of videos, at most %d", models.MaxHistoryLimit), Schema: oapi.GetSchema(models.DefaultContinueWatchingLimit)},
+				},
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"results": oapi.OpenApiSchema{
+											Type: "array",
+											Items: &oapi.OpenApiSchema{
+												Ref: o.GetRef("schemas", "video"),
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusBadRequest: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			if err != nil || user == nil {
+				apiError(w, errors.New("login required"), http.StatusUnauthorized)
+				return
+			}
+			_, limit, err := pageFromQuery(r)
+			if err != nil {
+				apiError(w, err, http.StatusBadRequest)
+				return
+			}
+			vids, err := models.ContinueWatching(conn.WithContext(r.Context()), user, limit)
+			if err != nil {
+				log.Err(err).Send()
+				apiError(w, err, http.StatusInternalServerError)
+				return
+			}
+			if err := ApiResponseM(w, vids); err != nil {
+				apiError(w, err, http.StatusInternalServerError)
+			}
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("GET /playlists", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/playlists", oapi.OpenApiPathItem{
+			Get: &oapi.OpenApiOperation{
+				Tags:    []string{"Playlists"},
+				Summary: "Playlists of the logged user and the ones shared by the others, without their videos",
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"results": oapi.OpenApiSchema{
+											Type: "array",
+											Items: &oapi.OpenApiSchema{
+												Ref: o.GetRef("schemas", "playlist"),
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusInternalServerError: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			playlists, err := models.Playlists(conn.WithContext(r.Context()), user)
+			if err != nil {
+				log.Err(err).Send()
+				apiError(w, err, http.StatusInternalServerError)
+				return
+			}
+			if err := ApiResponseM(w, playlists); err != nil {
+				apiError(w, err, http.StatusInternalServerError)
+			}
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("POST /playlists", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/playlists", oapi.OpenApiPathItem{
+			Post: &oapi.OpenApiOperation{
+				Tags:    []string{"Playlists"},
+				Summary: "Create a playlist of the logged user, the videos are added in order",
+				RequestBody: &oapi.OpenApiRequestBody{
+					Required: true,
+					Content: oapi.MediaTypeCollection{
+						"application/json": oapi.OpenApiMediaType{
+							Schema: oapi.OpenApiSchema{
+								Type: "object",
+								Properties: oapi.SchemaCollection{
+									"name":        oapi.GetSchema("string"),
+									"description": oapi.GetSchema("string"),
+									"visibility":  oapi.GetSchema("string"),
+									"videoIds": oapi.OpenApiSchema{
+										Type:  "array",
+										Items: &oapi.OpenApiSchema{Type: "string"},
+									},
+								},
+							},
+						},
+					},
+				},
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"result": oapi.OpenApiSchema{
+											Ref: o.GetRef("schemas", "playlist"),
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusBadRequest: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			if err != nil || user == nil {
+				apiError(w, errors.New("login required"), http.StatusUnauthorized)
+				return
+			}
+			body, err := decodeBody[struct {
+				Name        string   `json:"name"`
+				Description string   `json:"description"`
+				Visibility  string   `json:"visibility"`
+				VideoIds    []string `json:"videoIds"`
+			}](r)
+			if err != nil {
+				apiError(w, err, http.StatusBadRequest)
+				return
+			}
+			playlist, err := models.NewPlaylist(user, body.Name, body.Description, body.Visibility)
+			if err != nil {
+				apiError(w, err, http.StatusBadRequest)
+				return
+			}
+			if err := conn.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+				if err := playlist.Create(tx); err != nil {
+					return err
+				}
+				if len(body.VideoIds) == 0 {
+					return nil
+				}
+				return playlist.AddVideos(tx, user, body.VideoIds)
+			}); err != nil {
+				apiError(w, err, http.StatusBadRequest)
+				return
+			}
+			playlistResponse(w, r, conn, playlist, user)
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("GET /playlists/{id}", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/playlists/{id}", oapi.OpenApiPathItem{
+			Get: &oapi.OpenApiOperation{
+				Tags:    []string{"Playlists"},
+				Summary: "Playlist with its videos, the ones the user cannot access are left out",
+				Parameters: []oapi.OpenApiParameter{
+					{Name: "id", In: "path", Required: true, Schema: oapi.GetSchema("string")},
+				},
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"result": oapi.OpenApiSchema{
+											Ref: o.GetRef("schemas", "playlist"),
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusNotFound: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			playlist, status, err := findPlaylist(conn, r, r.PathValue("id"), user, false)
+			if err != nil {
+				apiError(w, err, status)
+				return
+			}
+			playlistResponse(w, r, conn, playlist, user)
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("PUT /playlists/{id}", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/playlists/{id}", oapi.OpenApiPathItem{
+			Put: &oapi.OpenApiOperation{
+				Tags:    []string{"Playlists"},
+				Summary: "Update a playlist of the logged user, the missing fields are kept",
+				Parameters: []oapi.OpenApiParameter{
+					{Name: "id", In: "path", Required: true, Schema: oapi.GetSchema("string")},
+				},
+				RequestBody: &oapi.OpenApiRequestBody{
+					Required: true,
+					Content: oapi.MediaTypeCollection{
+						"application/json": oapi.OpenApiMediaType{
+							Schema: oapi.OpenApiSchema{
+								Type: "object",
+								Properties: oapi.SchemaCollection{
+									"name":        oapi.GetSchema("string"),
+									"description": oapi.GetSchema("string"),
+									"visibility":  oapi.GetSchema("string"),
+								},
+							},
+						},
+					},
+				},
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"result": oapi.OpenApiSchema{
+											Ref: o.GetRef("schemas", "playlist"),
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusBadRequest: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusForbidden: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusNotFound: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			playlist, status, err := findPlaylist(conn, r, r.PathValue("id"), user, true)
+			if err != nil {
+				apiError(w, err, status)
+				return
+			}
+			body, err := decodeBody[struct {
+				Name        *string `json:"name"`
+				Description *string `json:"description"`
+				Visibility  *string `json:"visibility"`
+			}](r)
+			if err != nil {
+				apiError(w, err, http.StatusBadRequest)
+				return
+			}
+			if body.Name != nil {
+				playlist.Name = *body.Name
+			}
+			if body.Description != nil {
+				playlist.Description = *body.Description
+			}
+			if body.Visibility != nil {
+				playlist.Visibility = *body.Visibility
+			}
+			if err := playlist.Update(conn.WithContext(r.Context())); err != nil {
+				apiError(w, err, http.StatusBadRequest)
+				return
+			}
+			playlistResponse(w, r, conn, playlist, user)
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("DELETE /playlists/{id}", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/playlists/{id}", oapi.OpenApiPathItem{
+			Delete: &oapi.OpenApiOperation{
+				Tags:    []string{"Playlists"},
+				Summary: "Delete a playlist of the logged user",
+				Parameters: []oapi.OpenApiParameter{
+					{Name: "id", In: "path", Required: true, Schema: oapi.GetSchema("string")},
+				},
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"text/plain": oapi.OpenApiMediaType{
+								Schema: oapi.GetSchema("string"),
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusForbidden: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusNotFound: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			playlist, status, err := findPlaylist(conn, r, r.PathValue("id"), user, true)
+			if err != nil {
+				apiError(w, err, status)
+				return
+			}
+			if err := playlist.Delete(conn.WithContext(r.Context())); err != nil {
+				log.Err(err).Send()
+				apiError(w, err, http.StatusInternalServerError)
+				return
+			}
+			w.Write([]byte("ok"))
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("POST /playlists/{id}/entries", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/playlists/{id}/entries", oapi.OpenApiPathItem{
+			Post: &oapi.OpenApiOperation{
+				Tags:    []string{"Playlists"},
+				Summary: "Append videos at the end of a playlist of the logged user, in order",
+				Parameters: []oapi.OpenApiParameter{
+					{Name: "id", In: "path", Required: true, Schema: oapi.GetSchema("string")},
+				},
+				RequestBody: &oapi.OpenApiRequestBody{
+					Required: true,
+					Content: oapi.MediaTypeCollection{
+						"application/json": oapi.OpenApiMediaType{
+							Schema: oapi.OpenApiSchema{
+								Type: "object",
+								Properties: oapi.SchemaCollection{
+									"videoIds": oapi.OpenApiSchema{
+										Type:  "array",
+										Items: &oapi.OpenApiSchema{Type: "string"},
+									},
+								},
+							},
+						},
+					},
+				},
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"result": oapi.OpenApiSchema{
+											Ref: o.GetRef("schemas", "playlist"),
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusBadRequest: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusForbidden: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusNotFound: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			playlist, status, err := findPlaylist(conn, r, r.PathValue("id"), user, true)
+			if err != nil {
+				apiError(w, err, status)
+				return
+			}
+			body, err := decodeBody[struct {
+				VideoIds []string `json:"videoIds"`
+			}](r)
+			if err != nil {
+				apiError(w, err, http.StatusBadRequest)
+				return
+			}
+			if err := playlist.AddVideos(conn.WithContext(r.Context()), user, body.VideoIds); err != nil {
+				apiError(w, err, http.StatusBadRequest)
+				return
+			}
+			playlistResponse(w, r, conn, playlist, user)
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("DELETE /playlists/{id}/entries/{entry}", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/playlists/{id}/entries/{entry}", oapi.OpenApiPathItem{
+			Delete: &oapi.OpenApiOperation{
+				Tags:    []string{"Playlists"},
+				Summary: "Remove an entry from a playlist of the logged user",
+				Parameters: []oapi.OpenApiParameter{
+					{Name: "id", In: "path", Required: true, Schema: oapi.GetSchema("string")},
+					{Name: "entry", In: "path", Required: true, Schema: oapi.GetSchema(0)},
+				},
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"result": oapi.OpenApiSchema{
+											Ref: o.GetRef("schemas", "playlist"),
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusBadRequest: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusForbidden: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusNotFound: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			playlist, status, err := findPlaylist(conn, r, r.PathValue("id"), user, true)
+			if err != nil {
+				apiError(w, err, status)
+				return
+			}
+			entry, err := strconv.ParseUint(r.PathValue("entry"), 10, 0)
+			if err != nil {
+				apiError(w, fmt.Errorf("invalid entry `%s`", r.PathValue("entry")), http.StatusBadRequest)
+				return
+			}
+			if err := playlist.RemoveEntry(conn.WithContext(r.Context()), uint(entry)); err != nil {
+				apiError(w, err, http.StatusNotFound)
+				return
+			}
+			playlistResponse(w, r, conn, playlist, user)
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("PUT /playlists/{id}/order", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/playlists/{id}/order", oapi.OpenApiPathItem{
+			Put: &oapi.OpenApiOperation{
+				Tags:    []string{"Playlists"},
+				Summary: "Reorder a playlist of the logged user, the body lists the entry ids in the new order, the ones left out keep their place",
+				Parameters: []oapi.OpenApiParameter{
+					{Name: "id", In: "path", Required: true, Schema: oapi.GetSchema("string")},
+				},
+				RequestBody: &oapi.OpenApiRequestBody{
+					Required: true,
+					Content: oapi.MediaTypeCollection{
+						"application/json": oapi.OpenApiMediaType{
+							Schema: oapi.OpenApiSchema{
+								Type: "object",
+								Properties: oapi.SchemaCollection{
+									"entryIds": oapi.OpenApiSchema{
+										Type:  "array",
+										Items: &oapi.OpenApiSchema{Type: "integer"},
+									},
+								},
+							},
+						},
+					},
+				},
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"result": oapi.OpenApiSchema{
+											Ref: o.GetRef("schemas", "playlist"),
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusBadRequest: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusForbidden: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusNotFound: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			playlist, status, err := findPlaylist(conn, r, r.PathValue("id"), user, true)
+			if err != nil {
+				apiError(w, err, status)
+				return
+			}
+			body, err := decodeBody[struct {
+				EntryIds []uint `json:"entryIds"`
+			}](r)
+			if err != nil {
+				apiError(w, err, http.StatusBadRequest)
+				return
+			}
+			if err := playlist.Reorder(conn.WithContext(r.Context()), body.EntryIds); err != nil {
+				apiError(w, err, http.StatusBadRequest)
+				return
+			}
+			playlistResponse(w, r, conn, playlist, user)
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("PUT /videos/{id}/tags", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/videos/{id}/tags", oapi.OpenApiPathItem{
+			Put: &oapi.OpenApiOperation{
+				Tags:    []string{"Tags"},
+				Summary: "Replace the tags of the video",
+				Parameters: []oapi.OpenApiParameter{
+					{Name: "id", In: "path", Required: true, Schema: oapi.GetSchema("string")},
+				},
+				RequestBody: &oapi.OpenApiRequestBody{
+					Required: true,
+					Content: oapi.MediaTypeCollection{
+						"application/json": oapi.OpenApiMediaType{
+							Schema: oapi.OpenApiSchema{
+								Type: "object",
+								Properties: oapi.SchemaCollection{
+									"tags": oapi.OpenApiSchema{
+										Type:  "array",
+										Items: &oapi.OpenApiSchema{Type: "string"},
+									},
+								},
+							},
+						},
+					},
+				},
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"result": oapi.OpenApiSchema{
+											Ref: o.GetRef("schemas", "video"),
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusBadRequest: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusForbidden: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusNotFound: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			tagVideo(w, r, conn, videos, user, models.TagsReplace)
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("POST /videos/{id}/tags", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/videos/{id}/tags", oapi.OpenApiPathItem{
+			Post: &oapi.OpenApiOperation{
+				Tags:    []string{"Tags"},
+				Summary: "Add tags to the video",
+				Parameters: []oapi.OpenApiParameter{
+					{Name: "id", In: "path", Required: true, Schema: oapi.GetSchema("string")},
+				},
+				RequestBody: &oapi.OpenApiRequestBody{
+					Required: true,
+					Content: oapi.MediaTypeCollection{
+						"application/json": oapi.OpenApiMediaType{
+							Schema: oapi.OpenApiSchema{
+								Type: "object",
+								Properties: oapi.SchemaCollection{
+									"tags": oapi.OpenApiSchema{
+										Type:  "array",
+										Items: &oapi.OpenApiSchema{Type: "string"},
+									},
+								},
+							},
+						},
+					},
+				},
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"result": oapi.OpenApiSchema{
+											Ref: o.GetRef("schemas", "video"),
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusBadRequest: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusForbidden: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusNotFound: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			tagVideo(w, r, conn, videos, user, models.TagsAdd)
+		})
+	})
+
+	apiv1.HandleFuncWithOApi("DELETE /videos/{id}/tags", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+
+		o.Paths.New("/api/v1/videos/{id}/tags", oapi.OpenApiPathItem{
+			Delete: &oapi.OpenApiOperation{
+				Tags:    []string{"Tags"},
+				Summary: "Remove tags from the video",
+				Parameters: []oapi.OpenApiParameter{
+					{Name: "id", In: "path", Required: true, Schema: oapi.GetSchema("string")},
+				},
+				RequestBody: &oapi.OpenApiRequestBody{
+					Required: true,
+					Content: oapi.MediaTypeCollection{
+						"application/json": oapi.OpenApiMediaType{
+							Schema: oapi.OpenApiSchema{
+								Type: "object",
+								Properties: oapi.SchemaCollection{
+									"tags": oapi.OpenApiSchema{
+										Type:  "array",
+										Items: &oapi.OpenApiSchema{Type: "string"},
+									},
+								},
+							},
+						},
+					},
+				},
+				Responses: oapi.ResponsesCollection{
+					http.StatusOK: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Type: "object",
+									Properties: oapi.SchemaCollection{
+										"when": oapi.GetSchema("string"),
+										"result": oapi.OpenApiSchema{
+											Ref: o.GetRef("schemas", "video"),
+										},
+									},
+								},
+							},
+						},
+					},
+					http.StatusBadRequest: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusForbidden: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
 								},
 							},
 						},
 					},
-					http.StatusInternalServerError: oapi.OpenApiResponse{
+					http.StatusNotFound: oapi.OpenApiResponse{
 						Content: oapi.MediaTypeCollection{
 							"application/json": oapi.OpenApiMediaType{
 								Schema: oapi.OpenApiSchema{
@@ -223,26 +2755,36 @@ func handleApiV1(apiv1 *webserver.Mux, conn *gorm.DB, videoUpdated <-chan models
 			},
 		})
 
-		return func(w http.ResponseWriter, req *http.Request) {
-			var folders []models.Folder
-
-			if tx := conn.WithContext(req.Context()).Find(&folders); tx.Error != nil {
-				apiError(w, tx.Error, http.StatusInternalServerError)
-				return
-			}
-
-			if err := ApiResponseM(w, folders); err != nil {
-				apiError(w, err, http.StatusInternalServerError)
-			}
-		}
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			tagVideo(w, r, conn, videos, user, models.TagsRemove)
+		})
 	})
 
-	apiv1.HandleFuncWithOApi("GET /videos", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+	apiv1.HandleFuncWithOApi("PUT /pictures/{id}/tags", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
 
-		o.Paths.New("/api/v1/videos", oapi.OpenApiPathItem{
-			Get: &oapi.OpenApiOperation{
-				Tags:    []string{"Videos"},
-				Summary: "Get videos",
+		o.Paths.New("/api/v1/pictures/{id}/tags", oapi.OpenApiPathItem{
+			Put: &oapi.OpenApiOperation{
+				Tags:    []string{"Tags"},
+				Summary: "Replace the tags of the picture",
+				Parameters: []oapi.OpenApiParameter{
+					{Name: "id", In: "path", Required: true, Schema: oapi.GetSchema("string")},
+				},
+				RequestBody: &oapi.OpenApiRequestBody{
+					Required: true,
+					Content: oapi.MediaTypeCollection{
+						"application/json": oapi.OpenApiMediaType{
+							Schema: oapi.OpenApiSchema{
+								Type: "object",
+								Properties: oapi.SchemaCollection{
+									"tags": oapi.OpenApiSchema{
+										Type:  "array",
+										Items: &oapi.OpenApiSchema{Type: "string"},
+									},
+								},
+							},
+						},
+					},
+				},
 				Responses: oapi.ResponsesCollection{
 					http.StatusOK: oapi.OpenApiResponse{
 						Content: oapi.MediaTypeCollection{
@@ -251,18 +2793,15 @@ func handleApiV1(apiv1 *webserver.Mux, conn *gorm.DB, videoUpdated <-chan models
 									Type: "object",
 									Properties: oapi.SchemaCollection{
 										"when": oapi.GetSchema("string"),
-										"results": oapi.OpenApiSchema{
-											Type: "array",
-											Items: &oapi.OpenApiSchema{
-												Ref: o.GetRef("schemas", "video"),
-											},
+										"result": oapi.OpenApiSchema{
+											Ref: o.GetRef("schemas", "picture"),
 										},
 									},
 								},
 							},
 						},
 					},
-					http.StatusInternalServerError: oapi.OpenApiResponse{
+					http.StatusBadRequest: oapi.OpenApiResponse{
 						Content: oapi.MediaTypeCollection{
 							"application/json": oapi.OpenApiMediaType{
 								Schema: oapi.OpenApiSchema{
@@ -271,56 +2810,25 @@ func handleApiV1(apiv1 *webserver.Mux, conn *gorm.DB, videoUpdated <-chan models
 							},
 						},
 					},
-				},
-			},
-		})
-
-		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
-			var logged bool = user != nil
-			var folders []models.Folder
-			if tx := conn.WithContext(r.Context()).Find(&folders); tx.Error != nil {
-				log.Err(tx.Error).Send()
-				apiError(w, tx.Error, http.StatusInternalServerError)
-			}
-
-			var vids []*models.Video
-			for _, v := range videos.Getter {
-				var correctFolder *models.Folder = nil
-				for _, f := range folders {
-					if v.Folder.Id == f.Id {
-						correctFolder = &f
-						break
-					}
-				}
-
-				if correctFolder != nil {
-					if !correctFolder.AuthRequired || (correctFolder.AuthRequired && logged) {
-						vids = append(vids, &v)
-					}
-				}
-			}
-
-			if err := ApiResponseM(w, vids); err != nil {
-				apiError(w, err, http.StatusInternalServerError)
-			}
-		})
-	})
-
-	apiv1.HandleFuncWithOApi("GET /reload-data", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
-
-		o.Paths.New("/api/v1/reload-data", oapi.OpenApiPathItem{
-			Get: &oapi.OpenApiOperation{
-				Tags:    []string{"Reload data"},
-				Summary: "Reload data",
-				Responses: oapi.ResponsesCollection{
-					http.StatusOK: oapi.OpenApiResponse{
+					http.StatusUnauthorized: oapi.OpenApiResponse{
 						Content: oapi.MediaTypeCollection{
-							"text/plain": oapi.OpenApiMediaType{
-								Schema: oapi.GetSchema("string"),
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
 							},
 						},
 					},
-					http.StatusInternalServerError: oapi.OpenApiResponse{
+					http.StatusForbidden: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusNotFound: oapi.OpenApiResponse{
 						Content: oapi.MediaTypeCollection{
 							"application/json": oapi.OpenApiMediaType{
 								Schema: oapi.OpenApiSchema{
@@ -333,21 +2841,36 @@ func handleApiV1(apiv1 *webserver.Mux, conn *gorm.DB, videoUpdated <-chan models
 			},
 		})
 
-		return func(w http.ResponseWriter, req *http.Request) {
-			if err := reload(conn.WithContext(req.Context()), videos); err != nil {
-				apiError(w, err, http.StatusInternalServerError)
-				return
-			}
-			w.Write([]byte("ok"))
-		}
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			tagPicture(w, r, conn, user, models.TagsReplace)
+		})
 	})
 
-	apiv1.HandleFuncWithOApi("GET /pictures", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+	apiv1.HandleFuncWithOApi("POST /pictures/{id}/tags", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
 
-		o.Paths.New("/api/v1/pictures", oapi.OpenApiPathItem{
-			Get: &oapi.OpenApiOperation{
-				Tags:    []string{"Pictures"},
-				Summary: "Picture list",
+		o.Paths.New("/api/v1/pictures/{id}/tags", oapi.OpenApiPathItem{
+			Post: &oapi.OpenApiOperation{
+				Tags:    []string{"Tags"},
+				Summary: "Add tags to the picture",
+				Parameters: []oapi.OpenApiParameter{
+					{Name: "id", In: "path", Required: true, Schema: oapi.GetSchema("string")},
+				},
+				RequestBody: &oapi.OpenApiRequestBody{
+					Required: true,
+					Content: oapi.MediaTypeCollection{
+						"application/json": oapi.OpenApiMediaType{
+							Schema: oapi.OpenApiSchema{
+								Type: "object",
+								Properties: oapi.SchemaCollection{
+									"tags": oapi.OpenApiSchema{
+										Type:  "array",
+										Items: &oapi.OpenApiSchema{Type: "string"},
+									},
+								},
+							},
+						},
+					},
+				},
 				Responses: oapi.ResponsesCollection{
 					http.StatusOK: oapi.OpenApiResponse{
 						Content: oapi.MediaTypeCollection{
@@ -356,18 +2879,42 @@ func handleApiV1(apiv1 *webserver.Mux, conn *gorm.DB, videoUpdated <-chan models
 									Type: "object",
 									Properties: oapi.SchemaCollection{
 										"when": oapi.GetSchema("string"),
-										"results": oapi.OpenApiSchema{
-											Type: "array",
-											Items: &oapi.OpenApiSchema{
-												Ref: o.GetRef("schemas", "picture"),
-											},
+										"result": oapi.OpenApiSchema{
+											Ref: o.GetRef("schemas", "picture"),
 										},
 									},
 								},
 							},
 						},
 					},
-					http.StatusInternalServerError: oapi.OpenApiResponse{
+					http.StatusBadRequest: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusForbidden: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusNotFound: oapi.OpenApiResponse{
 						Content: oapi.MediaTypeCollection{
 							"application/json": oapi.OpenApiMediaType{
 								Schema: oapi.OpenApiSchema{
@@ -380,31 +2927,34 @@ func handleApiV1(apiv1 *webserver.Mux, conn *gorm.DB, videoUpdated <-chan models
 			},
 		})
 
-		return func(w http.ResponseWriter, r *http.Request) {
-			var pics []models.Picture
-			if tx := conn.Find(&pics); tx.Error != nil {
-				return
-			}
-			if err := ApiResponseM(w, pics); err != nil {
-				apiError(w, err, http.StatusInternalServerError)
-			}
-		}
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			tagPicture(w, r, conn, user, models.TagsAdd)
+		})
 	})
 
-	apiv1.HandleFuncWithOApi("GET /pictures/info/{id}", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+	apiv1.HandleFuncWithOApi("DELETE /pictures/{id}/tags", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
 
-		o.Paths.New("/api/v1/pictures/info/{id}", oapi.OpenApiPathItem{
-			Get: &oapi.OpenApiOperation{
-				Tags:    []string{"Pictures"},
-				Summary: "Picture info",
+		o.Paths.New("/api/v1/pictures/{id}/tags", oapi.OpenApiPathItem{
+			Delete: &oapi.OpenApiOperation{
+				Tags:    []string{"Tags"},
+				Summary: "Remove tags from the picture",
 				Parameters: []oapi.OpenApiParameter{
-					{
-						Name:            "id",
-						In:              "path",
-						Required:        true,
-						AllowEmptyValue: false,
-						Deprecated:      false,
-						Schema:          oapi.GetSchema("string"),
+					{Name: "id", In: "path", Required: true, Schema: oapi.GetSchema("string")},
+				},
+				RequestBody: &oapi.OpenApiRequestBody{
+					Required: true,
+					Content: oapi.MediaTypeCollection{
+						"application/json": oapi.OpenApiMediaType{
+							Schema: oapi.OpenApiSchema{
+								Type: "object",
+								Properties: oapi.SchemaCollection{
+									"tags": oapi.OpenApiSchema{
+										Type:  "array",
+										Items: &oapi.OpenApiSchema{Type: "string"},
+									},
+								},
+							},
+						},
 					},
 				},
 				Responses: oapi.ResponsesCollection{
@@ -423,7 +2973,34 @@ func handleApiV1(apiv1 *webserver.Mux, conn *gorm.DB, videoUpdated <-chan models
 							},
 						},
 					},
-					http.StatusInternalServerError: oapi.OpenApiResponse{
+					http.StatusBadRequest: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusUnauthorized: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusForbidden: oapi.OpenApiResponse{
+						Content: oapi.MediaTypeCollection{
+							"application/json": oapi.OpenApiMediaType{
+								Schema: oapi.OpenApiSchema{
+									Ref: o.GetRef("schemas", "api-error"),
+								},
+							},
+						},
+					},
+					http.StatusNotFound: oapi.OpenApiResponse{
 						Content: oapi.MediaTypeCollection{
 							"application/json": oapi.OpenApiMediaType{
 								Schema: oapi.OpenApiSchema{
@@ -436,34 +3013,17 @@ func handleApiV1(apiv1 *webserver.Mux, conn *gorm.DB, videoUpdated <-chan models
 			},
 		})
 
-		return func(w http.ResponseWriter, r *http.Request) {
-			var pics []models.Picture
-			var id = r.PathValue("id")
-			if tx := conn.Find(&pics, models.Picture{Id: id}); tx.Error != nil {
-				apiError(w, tx.Error, http.StatusInternalServerError)
-				return
-			}
-			switch len(pics) {
-			case 0:
-				apiError(w, fmt.Errorf("cannot find picture with id=`%s`", id), http.StatusNotFound)
-				return
-			case 1:
-				if err := ApiResponseS(w, &pics[0]); err != nil {
-					apiError(w, err, http.StatusInternalServerError)
-				}
-			default:
-				apiError(w, fmt.Errorf("found %d pictures with id=`%s`", len(pics), id), http.StatusInternalServerError)
-				return
-			}
-		}
+		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			tagPicture(w, r, conn, user, models.TagsRemove)
+		})
 	})
 
-	apiv1.HandleFuncWithOApi("GET /whoami", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
+	apiv1.HandleFuncWithOApi("GET /tags", func(o *oapi.OpenApi, responses oapi.ResponsesCollection) func(w http.ResponseWriter, req *http.Request) {
 
-		o.Paths.New("/api/v1/whoami", oapi.OpenApiPathItem{
+		o.Paths.New("/api/v1/tags", oapi.OpenApiPathItem{
 			Get: &oapi.OpenApiOperation{
-				Tags:    []string{"User"},
-				Summary: "User info",
+				Tags:    []string{"Tags"},
+				Summary: "Tag cloud: the tags in use with the number of videos and pictures the user can access",
 				Responses: oapi.ResponsesCollection{
 					http.StatusOK: oapi.OpenApiResponse{
 						Content: oapi.MediaTypeCollection{
@@ -472,15 +3032,10 @@ func handleApiV1(apiv1 *webserver.Mux, conn *gorm.DB, videoUpdated <-chan models
 									Type: "object",
 									Properties: oapi.SchemaCollection{
 										"when": oapi.GetSchema("string"),
-										"result": oapi.OpenApiSchema{
-											Type: "object",
-											Properties: oapi.SchemaCollection{
-												"user": oapi.OpenApiSchema{
-													Ref: o.GetRef("schemas", "user"),
-												},
-												"session": oapi.OpenApiSchema{
-													Ref: o.GetRef("schemas", "session"),
-												},
+										"results": oapi.OpenApiSchema{
+											Type: "array",
+											Items: &oapi.OpenApiSchema{
+												Ref: o.GetRef("schemas", "tag-count"),
 											},
 										},
 									},
@@ -488,15 +3043,6 @@ func handleApiV1(apiv1 *webserver.Mux, conn *gorm.DB, videoUpdated <-chan models
 							},
 						},
 					},
-					http.StatusUnauthorized: oapi.OpenApiResponse{
-						Content: oapi.MediaTypeCollection{
-							"application/json": oapi.OpenApiMediaType{
-								Schema: oapi.OpenApiSchema{
-									Ref: o.GetRef("schemas", "api-error"),
-								},
-							},
-						},
-					},
 					http.StatusInternalServerError: oapi.OpenApiResponse{
 						Content: oapi.MediaTypeCollection{
 							"application/json": oapi.OpenApiMediaType{
@@ -511,31 +3057,13 @@ func handleApiV1(apiv1 *webserver.Mux, conn *gorm.DB, videoUpdated <-chan models
 		})
 
 		return CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			tags, err := models.TagCloud(conn.WithContext(r.Context()), user)
 			if err != nil {
-				apiError(w, err, http.StatusUnauthorized)
-				return
-			}
-			if user == nil {
-				apiError(w, errors.New("error while trying to get the logged user"), http.StatusInternalServerError)
-				return
-			}
-
-			var sessions []models.Session
-			if tx := conn.WithContext(r.Context()).Find(&sessions, models.Session{UserId: user.Id}); tx.Error != nil {
-				apiError(w, errors.New("error while trying to get the user session"), http.StatusInternalServerError)
+				log.Err(err).Send()
+				apiError(w, err, http.StatusInternalServerError)
 				return
 			}
-
-			var session *models.Session
-			if len(sessions) == 1 {
-				session = &sessions[0]
-			}
-
-			user.PasswordHashed = ""
-			if err := ApiResponseS(w, &map[string]any{
-				"user":    user,
-				"session": session,
-			}); err != nil {
+			if err := ApiResponseM(w, tags); err != nil {
 				apiError(w, err, http.StatusInternalServerError)
 			}
 		})
@@ -595,11 +3123,13 @@ func handleApiV1(apiv1 *webserver.Mux, conn *gorm.DB, videoUpdated <-chan models
 		})
 	})
 
-	go func() {
-		for {
-			time.Sleep(time.Minute * 30)
-			reload(conn.WithContext(context.Background()), videos)
-		}
-	}()
+	if fsWatcher == nil {
+		go func() {
+			for {
+				time.Sleep(time.Minute * 30)
+				reload(context.Background(), conn, libScanner, videos)
+			}
+		}()
+	}
 	return apiv1
 }
@@ -1,17 +1,33 @@
 package routes
 
 import (
+	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"full/libs/db"
+	"full/libs/hls"
+	"full/libs/media"
 	"full/libs/models"
+	"full/libs/playback"
+	"full/libs/remux"
 	"full/libs/routes/gql"
 	"full/libs/routes/oapi"
+	"full/libs/scanner"
+	"full/libs/signedurl"
+	"full/libs/subtitles"
+	"full/libs/throttle"
+	"full/libs/thumbnail"
+	"full/libs/trickplay"
+	"full/libs/utils"
+	"full/libs/watcher"
 	"full/libs/webserver"
 	"io/fs"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -44,6 +60,30 @@ type AdditionalConfigs struct {
 	OpenApiSpecEndpoint   string
 	OpenApiSpecFullUrl    string
 	OpenApiScalarEndpoint string
+
+	EnableWatcher   bool
+	WatcherDebounce time.Duration
+
+	ScanWorkers int
+
+	CacheDir          string
+	ThumbnailWidth    int
+	ThumbnailPosition string
+
+	TrickplayInterval time.Duration
+	TrickplayWidth    int
+
+	HlsSegmentDuration time.Duration
+	HlsIdleTimeout     time.Duration
+	// HlsCacheSize is the maximum number of bytes of segments kept on disk
+	HlsCacheSize int64
+	HlsLadder    []hls.Variant
+
+	// Streams are the limits of the concurrent streams and of their bandwidth
+	Streams throttle.Config
+
+	// UrlSecret signs the stream urls of the players without the session cookie, empty disables them
+	UrlSecret []byte
 }
 
 func AddWebsite(fsys embed.FS, startDir string, fileCounter prometheus.Gauge, configs *AdditionalConfigs) {
@@ -67,7 +107,76 @@ func AddWebsite(fsys embed.FS, startDir string, fileCounter prometheus.Gauge, co
 		log.Panic().Err(err).Send()
 	}
 
-	var videoUpdated chan models.Video = make(chan models.Video)
+	var videos = utils.NewGetterSetter[[]models.Video](nil)
+
+	var thumbnails *thumbnail.Generator
+	if configs != nil && len(configs.CacheDir) > 0 {
+		position, err := thumbnail.ParsePosition(configs.ThumbnailPosition)
+		if err != nil {
+			log.Err(err).Send()
+		} else if thumbnails, err = thumbnail.New(filepath.Join(configs.CacheDir, "thumbnails"), configs.ThumbnailWidth, position); err != nil {
+			log.Err(err).Msg("Cannot start the thumbnail generator")
+		}
+	}
+	var previews *trickplay.Generator
+	if configs != nil && len(configs.CacheDir) > 0 && configs.TrickplayInterval > 0 {
+		if previews, err = trickplay.New(filepath.Join(configs.CacheDir, "trickplay"), configs.TrickplayInterval, configs.TrickplayWidth); err != nil {
+			log.Err(err).Msg("Cannot start the preview generator")
+		}
+	}
+	var streams *hls.Manager
+	if configs != nil && len(configs.CacheDir) > 0 {
+		if streams, err = hls.New(hls.Config{
+			Dir:             filepath.Join(configs.CacheDir, "hls"),
+			SegmentDuration: configs.HlsSegmentDuration,
+			IdleTimeout:     configs.HlsIdleTimeout,
+			CacheSize:       configs.HlsCacheSize,
+			Ladder:          configs.HlsLadder,
+		}); err != nil {
+			log.Err(err).Msg("Cannot start the HLS transcoder")
+		}
+	}
+	var embeddedSubtitles *subtitles.Extractor
+	if configs != nil && len(configs.CacheDir) > 0 {
+		if embeddedSubtitles, err = subtitles.NewExtractor(filepath.Join(configs.CacheDir, "subtitles")); err != nil {
+			log.Err(err).Msg("Cannot start the subtitle extractor")
+		}
+	}
+	var signer *signedurl.Signer
+	if configs != nil && len(configs.UrlSecret) > 0 {
+		if signer, err = signedurl.New(configs.UrlSecret); err != nil {
+			log.Err(err).Msg("Signed urls are disabled")
+		}
+	}
+	var limiter *throttle.Limiter
+	if configs != nil {
+		limiter = throttle.New(configs.Streams)
+	}
+	// planPlayback probes the video when needed and chooses how the client is going
+	// to play it, with the audio track chosen by the request or by the user
+	var planPlayback = func(r *http.Request, vid *models.Video, caps playback.Capabilities, user *models.User) (playback.Plan, error) {
+		if err := playback.LoadStreams(r.Context(), conn.WithContext(r.Context()), vid); err != nil {
+			log.Err(err).Str("id", vid.Id).Msg("Cannot probe video")
+		}
+		audio, err := audioFromQuery(r, vid, user)
+		if err != nil {
+			return playback.Plan{}, err
+		}
+		var urls = playback.Urls{Direct: fmt.Sprintf("/video/stream/%s", vid.Id)}
+		if remux.Supported(vid) {
+			urls.Remux = fmt.Sprintf("/video/remux/%s%s", vid.Id, streamQuery(r, audio))
+		}
+		if streams != nil && vid.Duration > 0 {
+			urls.Transcode = fmt.Sprintf("/video/hls/%s/master.m3u8%s", vid.Id, streamQuery(r, audio))
+		}
+		return playback.Decide(vid, caps, urls, audio), nil
+	}
+	var onVideo = func(v models.Video) {
+		updateVideoCache(videos, v)
+		if thumbnails != nil {
+			thumbnails.Queue(v)
+		}
+	}
 
 	WebServer.Handle("/", webserver.DefaultLoggerMiddleware(http.FileServerFS(newFsys)))
 	for _, f := range readEmbedFiles(fsys, startDir) {
@@ -90,107 +199,393 @@ func AddWebsite(fsys embed.FS, startDir string, fileCounter prometheus.Gauge, co
 	}
 
 	videoHandler := webserver.NewMux()
-	videoHandler.HandleFunc("GET /info/{id}", func(w http.ResponseWriter, r *http.Request) {
-		var id = r.PathValue("id")
+	videoHandler.HandleFunc("GET /info/{id}", CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+		vid, status, err := findVideo(conn, r, r.PathValue("id"), user)
+		if err != nil {
+			apiError(w, err, status)
+			return
+		}
+		if err := vid.LoadTags(conn.WithContext(r.Context())); err != nil {
+			apiError(w, err, http.StatusInternalServerError)
+			return
+		}
 
-		var data []models.Video
-		if tx := conn.WithContext(r.Context()).Find(&data, models.Video{Id: id}); tx.Error != nil {
-			apiError(w, tx.Error, http.StatusInternalServerError)
+		// The plan probes the streams, the embedded subtitles are among them
+		plan, err := planPlayback(r, vid, playback.DefaultCapabilities, user)
+		if err != nil {
+			apiError(w, err, http.StatusBadRequest)
 			return
 		}
+		var info = newVideoInfo(vid)
+		info.Playback = &plan
+		if previews != nil {
+			// Opening the info of a video is the hint that the preview is going to be needed
+			previews.Queue(*vid)
+			var preview = previews.Info(vid, fmt.Sprintf("/video/trickplay/%s/%s", vid.Id, trickplay.VttName))
+			info.Preview = &preview
+		}
+		if streams != nil && vid.Duration > 0 {
+			info.Hls = fmt.Sprintf("/video/hls/%s/master.m3u8", vid.Id)
+		}
+		ApiResponseS(w, &info)
+	}))
 
-		if len(data) == 0 {
-			apiError(w, fmt.Errorf("cannot find video with id=\"%s\"", id), http.StatusNotFound)
+	videoHandler.HandleFunc("POST /playback/{id}", CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+		caps, err := decodeBody[playback.Capabilities](r)
+		if err != nil {
+			apiError(w, err, http.StatusBadRequest)
 			return
 		}
-		if len(data) > 1 {
-			apiError(w, fmt.Errorf("found multiple videos with id=\"%s\"", id), http.StatusNotFound)
+		vid, status, err := findVideo(conn, r, r.PathValue("id"), user)
+		if err != nil {
+			apiError(w, err, status)
 			return
 		}
 
-		ApiResponseS(w, &data[0])
-		// w.Write([]byte(id))
-	})
-
-	videoHandler.HandleFunc("GET /stream/{id}", func(w http.ResponseWriter, r *http.Request) {
-		var id = r.PathValue("id")
-
-		var data []models.Video
-		if tx := conn.WithContext(r.Context()).Find(&data, models.Video{Id: id}); tx.Error != nil {
-			apiError(w, tx.Error, http.StatusInternalServerError)
+		plan, err := planPlayback(r, vid, caps, user)
+		if err != nil {
+			apiError(w, err, http.StatusBadRequest)
 			return
 		}
+		ApiResponseS(w, &plan)
+	}))
 
-		if len(data) == 0 {
-			apiError(w, fmt.Errorf("cannot find video with id=\"%s\"", id), http.StatusNotFound)
+	videoHandler.HandleFunc("GET /stream/{id}", CheckStreamAuth(conn, signer, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+		var id = r.PathValue("id")
+		vid, status, err := findVideo(conn, r, id, user)
+		if err != nil {
+			apiError(w, err, status)
 			return
 		}
-		if len(data) > 1 {
-			apiError(w, fmt.Errorf("found multiple videos with id=\"%s\"", id), http.StatusNotFound)
+
+		// The file as is plays the main audio track, another one needs a new container.
+		// Only an explicit track switches, the preference of the user is left to the playback plan
+		audio, err := audioFromQuery(r, vid, nil)
+		if err != nil {
+			apiError(w, err, http.StatusBadRequest)
 			return
 		}
-
-		var vid = data[0]
-		if !vid.Attributes.Watched {
-			vid.Attributes.Watched = true
-			if tx := conn.UpdateColumns(&vid); tx.Error != nil {
-				log.Err(tx.Error).Send()
-				apiError(w, tx.Error, http.StatusInternalServerError)
+		if audio != nil {
+			if remux.Supported(vid) {
+				http.Redirect(w, r, fmt.Sprintf("/video/remux/%s%s", vid.Id, streamQuery(r, audio)), http.StatusTemporaryRedirect)
+				return
+			}
+			if streams != nil && vid.Duration > 0 {
+				http.Redirect(w, r, fmt.Sprintf("/video/hls/%s/master.m3u8%s", vid.Id, streamQuery(r, audio)), http.StatusTemporaryRedirect)
 				return
 			}
-			videoUpdated <- vid
 		}
 
 		if vid.CheckFile(conn.WithContext(r.Context())) {
+			w, release, ok := limitStream(limiter, w, r, user, vid)
+			if !ok {
+				return
+			}
+			defer release()
 			http.ServeFile(w, r, vid.FilePath)
 		} else {
 			apiError(w, fmt.Errorf("cannot find video with id=\"%s\"", id), http.StatusNotFound)
 		}
-	})
+	}))
 
-	pictureHandler := webserver.NewMux()
+	videoHandler.HandleFunc("GET /remux/{id}", CheckStreamAuth(conn, signer, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+		start, err := startFromQuery(r)
+		if err != nil {
+			apiError(w, err, http.StatusBadRequest)
+			return
+		}
+		vid, status, err := findVideo(conn, r, r.PathValue("id"), user)
+		if err != nil {
+			apiError(w, err, status)
+			return
+		}
+		if !vid.CheckFile(conn.WithContext(r.Context())) {
+			apiError(w, fmt.Errorf("cannot find video with id=\"%s\"", vid.Id), http.StatusNotFound)
+			return
+		}
+		if !remux.Supported(vid) {
+			apiError(w, remux.ErrUnsupported, http.StatusUnprocessableEntity)
+			return
+		}
+		if vid.Duration > 0 && start >= vid.Duration {
+			apiError(w, fmt.Errorf("start %s is outside of the video", start), http.StatusBadRequest)
+			return
+		}
+		audio, err := audioFromQuery(r, vid, user)
+		if err != nil {
+			apiError(w, err, http.StatusBadRequest)
+			return
+		}
 
-	pictureHandler.HandleFunc("/{id}", func(w http.ResponseWriter, r *http.Request) {
-		var id = r.PathValue("id")
-		var pics []models.Picture
-		if tx := conn.WithContext(r.Context()).Find(&pics, models.Picture{Id: id}); tx.Error != nil {
-			log.Err(err).Send()
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		w, release, ok := limitStream(limiter, w, r, user, vid)
+		if !ok {
 			return
 		}
+		defer release()
+
+		// The output is produced while it is sent, byte ranges cannot be served
+		w.Header().Set("Content-Type", remux.MimeType)
+		w.Header().Set("Accept-Ranges", "none")
+		w.Header().Set("Cache-Control", "no-store")
+		if err := remux.Stream(r.Context(), w, vid, remux.Options{Start: start, Audio: audio}); err != nil {
+			log.Err(err).Str("id", vid.Id).Msg("Cannot remux video")
+		}
+	}))
 
-		switch len(pics) {
-		case 0:
-			http.Error(w, fmt.Sprintf("Cannot find image with id: `%s`", id), http.StatusNotFound)
-		case 1:
-			var ct = map[string]string{
-				".jpg":  "image/jpeg",
-				".jpeg": "image/jpeg",
-				".png":  "image/png",
-				".gif":  "image/gif",
+	videoHandler.HandleFunc("GET /subtitles/{id}/{track}", CheckStreamAuth(conn, signer, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+		vid, status, err := findVideo(conn, r, r.PathValue("id"), user)
+		if err != nil {
+			apiError(w, err, status)
+			return
+		}
+		var track = r.PathValue("track")
+		if strings.HasPrefix(track, "s-") {
+			// A subtitle stream embedded in the container
+			idx := slices.IndexFunc(vid.Streams, func(s models.VideoStream) bool { return s.Id == track })
+			if idx < 0 {
+				apiError(w, fmt.Errorf("cannot find subtitle with id=`%s` for video id=`%s`", track, vid.Id), http.StatusNotFound)
+				return
 			}
-			mimeType, ok := ct[filepath.Ext(strings.ToLower(pics[0].FilePath))]
-			if !ok {
-				http.Error(w, "Invalid picture extension", http.StatusInternalServerError)
+			if embeddedSubtitles == nil {
+				apiError(w, errors.New("subtitle extraction is disabled"), http.StatusNotFound)
 				return
 			}
-			file, err := os.ReadFile(pics[0].FilePath)
+			out, err := embeddedSubtitles.Get(r.Context(), vid, &vid.Streams[idx])
 			if err != nil {
-				log.Err(err).Send()
-				http.Error(w, fmt.Sprintf("Cannot find file with id: `%s`", id), http.StatusNotFound)
+				log.Err(err).Str("id", vid.Id).Str("stream", track).Msg("Cannot extract subtitle")
+				apiError(w, err, http.StatusUnprocessableEntity)
+				return
+			}
+			w.Header().Set("Content-Type", subtitles.MimeType)
+			w.Header().Set("Cache-Control", "no-cache")
+			http.ServeFile(w, r, out)
+			return
+		}
+
+		sub, err := models.FindSubtitle(conn.WithContext(r.Context()), vid.Id, track)
+		if err != nil {
+			apiError(w, err, http.StatusNotFound)
+			return
+		}
+		fd, err := os.Open(sub.FilePath)
+		if err != nil {
+			apiError(w, fmt.Errorf("cannot open subtitle with id=\"%s\"", sub.Id), http.StatusNotFound)
+			return
+		}
+		defer fd.Close()
+
+		vtt, err := subtitles.ToVtt(fd, sub.Format)
+		if err != nil {
+			log.Err(err).Str("file", sub.FilePath).Msg("Cannot convert subtitle")
+			apiError(w, err, http.StatusUnprocessableEntity)
+			return
+		}
+		w.Header().Set("Content-Type", subtitles.MimeType)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(vtt)
+	}))
+
+	videoHandler.HandleFunc("GET /thumbnail/{id}", CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+		vid, status, err := findVideo(conn, r, r.PathValue("id"), user)
+		if err != nil {
+			apiError(w, err, status)
+			return
+		}
+
+		if thumbnails != nil {
+			thumb, err := thumbnails.Get(r.Context(), vid)
+			if err == nil {
+				// Private, shared caches would serve the protected folders to anyone
+				w.Header().Set("Cache-Control", "private, max-age=604800")
+				w.Header().Set("Content-Type", "image/jpeg")
+				http.ServeFile(w, r, thumb)
+				return
+			}
+			log.Err(err).Str("id", vid.Id).Msg("Cannot generate thumbnail")
+		}
+
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write(thumbnail.Placeholder)
+	}))
+
+	videoHandler.HandleFunc("GET /trickplay/{id}/{file}", CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+		if previews == nil {
+			apiError(w, errors.New("previews are disabled"), http.StatusNotFound)
+			return
+		}
+
+		var id = r.PathValue("id")
+		vid, status, err := findVideo(conn, r, id, user)
+		if err != nil {
+			apiError(w, err, status)
+			return
+		}
+		if !previews.Exists(id) {
+			previews.Queue(*vid)
+			apiError(w, fmt.Errorf("preview for video id=\"%s\" is not available yet", id), http.StatusNotFound)
+			return
+		}
+
+		file, err := previews.File(id, r.PathValue("file"))
+		if err != nil {
+			apiError(w, err, http.StatusBadRequest)
+			return
+		}
+		if strings.HasSuffix(file, ".vtt") {
+			w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+		}
+		w.Header().Set("Cache-Control", "private, max-age=86400")
+		http.ServeFile(w, r, file)
+	}))
+
+	videoHandler.HandleFunc("GET /hls/{id}/{file}", CheckStreamAuth(conn, signer, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+		if streams == nil {
+			apiError(w, errors.New("HLS streaming is disabled"), http.StatusNotFound)
+			return
+		}
+		if r.PathValue("file") != "master.m3u8" {
+			apiError(w, fmt.Errorf("cannot find file `%s`", r.PathValue("file")), http.StatusNotFound)
+			return
+		}
+		vid, status, err := findHlsVideo(conn, r, user)
+		if err != nil {
+			apiError(w, err, status)
+			return
+		}
+
+		maxQuality, err := maxQualityFromQuery(r, user)
+		if err != nil {
+			apiError(w, err, http.StatusBadRequest)
+			return
+		}
+		audio, err := audioFromQuery(r, vid, user)
+		if err != nil {
+			apiError(w, err, http.StatusBadRequest)
+			return
+		}
+		var variants = streams.Variants(vid, maxQuality)
+		for idx := range variants {
+			variants[idx] = variants[idx].WithAudio(audio)
+		}
+
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.Header().Set("Cache-Control", "no-cache")
+		// The audio track is part of the variant id
+		w.Write([]byte(hls.MasterPlaylist(vid, variants, streamQuery(r, nil))))
+	}))
+
+	videoHandler.HandleFunc("GET /hls/{id}/{variant}/{file}", CheckStreamAuth(conn, signer, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+		if streams == nil {
+			apiError(w, errors.New("HLS streaming is disabled"), http.StatusNotFound)
+			return
+		}
+		vid, status, err := findHlsVideo(conn, r, user)
+		if err != nil {
+			apiError(w, err, status)
+			return
+		}
+		maxQuality, err := maxQualityFromQuery(r, user)
+		if err != nil {
+			apiError(w, err, http.StatusBadRequest)
+			return
+		}
+		variant, ok := streams.Variant(vid, r.PathValue("variant"), maxQuality)
+		if !ok {
+			apiError(w, fmt.Errorf("cannot find variant `%s`", r.PathValue("variant")), http.StatusNotFound)
+			return
+		}
+
+		var file = r.PathValue("file")
+		if file == "index.m3u8" {
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Write([]byte(streams.MediaPlaylist(vid, streamQuery(r, nil))))
+			return
+		}
+
+		index, err := strconv.Atoi(strings.TrimSuffix(file, ".ts"))
+		if err != nil || !strings.HasSuffix(file, ".ts") {
+			apiError(w, fmt.Errorf("cannot find file `%s`", file), http.StatusNotFound)
+			return
+		}
+		// The slot is taken before the segment since the transcoding is the expensive part
+		w, release, ok := limitStream(limiter, w, r, user, vid)
+		if !ok {
+			return
+		}
+		defer release()
+		segment, err := streams.Segment(r.Context(), vid, variant, index)
+		if err != nil {
+			if errors.Is(err, hls.ErrSegmentNotFound) {
+				apiError(w, err, http.StatusNotFound)
 				return
 			}
-			w.Header().Set("Content-Type", mimeType)
-			w.Write(file)
-		default:
-			http.Error(w, "Found multiple images with the same id", http.StatusInternalServerError)
+			log.Err(err).Str("id", vid.Id).Str("variant", variant.Id()).Int("segment", index).Msg("Cannot generate HLS segment")
+			apiError(w, err, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "video/mp2t")
+		w.Header().Set("Cache-Control", "private, max-age=86400")
+		http.ServeFile(w, r, segment)
+	}))
+
+	pictureHandler := webserver.NewMux()
+
+	pictureHandler.HandleFunc("/{id}", CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+		pic, status, err := findPicture(conn, r, r.PathValue("id"), user)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		mediaType, ok := media.Detect(pic.FilePath)
+		if !ok || mediaType.Kind != media.KindPicture {
+			http.Error(w, "Invalid picture extension", http.StatusInternalServerError)
+			return
 		}
-	})
+		file, err := os.ReadFile(pic.FilePath)
+		if err != nil {
+			log.Err(err).Send()
+			http.Error(w, fmt.Sprintf("Cannot find file with id: `%s`", pic.Id), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", mediaType.MimeType)
+		w.Write(file)
+	}))
 
 	WebServer.HandleMux("/video", videoHandler)
 	WebServer.HandleMux("/picture", pictureHandler)
 	WebServer.HandleMux("/actions", handleActions(webserver.NewMux(), conn))
-	WebServer.HandleMux("/api/v1", handleApiV1(webserver.NewMux(), conn, videoUpdated))
+	var fsWatcher *watcher.Watcher
+	if configs != nil && configs.EnableWatcher {
+		if fsWatcher, err = watcher.New(conn, configs.WatcherDebounce); err != nil {
+			log.Err(err).Msg("Cannot start the filesystem watcher")
+		} else {
+			fsWatcher.OnVideo = onVideo
+		}
+	}
+
+	var scanWorkers int
+	if configs != nil {
+		scanWorkers = configs.ScanWorkers
+	}
+	var libScanner = scanner.New(conn, scanWorkers)
+	libScanner.OnVideo = onVideo
+	libScanner.OnFinish = func(p scanner.Progress) {
+		if thumbnails != nil {
+			thumbnails.QueueMissing(videos.Get())
+		}
+	}
+
+	WebServer.HandleMux("/api/v1", handleApiV1(webserver.NewMux(), conn, videos, fsWatcher, libScanner, signer))
+
+	if fsWatcher != nil {
+		if err := fsWatcher.Sync(); err != nil {
+			log.Err(err).Send()
+		}
+		go fsWatcher.Run(context.Background())
+	}
 
 	if configs != nil && configs.EnableGraphql {
 
@@ -218,17 +613,44 @@ func AddWebsite(fsys embed.FS, startDir string, fileCounter prometheus.Gauge, co
 						Ref: WebServer.OpenApi.GetRef("schemas", "folder"),
 					},
 				},
+				"tags": oapi.OpenApiSchema{
+					Type: "array",
+					Items: &oapi.OpenApiSchema{
+						Ref: WebServer.OpenApi.GetRef("schemas", "tag"),
+					},
+				},
+			},
+		})
+
+		WebServer.OpenApi.Components.Schemas.New("video-stream", oapi.OpenApiSchema{
+			Type: "object",
+			Properties: oapi.SchemaCollection{
+				"id":            oapi.GetSchema("string"),
+				"index":         oapi.GetSchema(0),
+				"type":          oapi.GetSchema("string"),
+				"codec":         oapi.GetSchema("string"),
+				"profile":       oapi.GetSchema("string"),
+				"width":         oapi.GetSchema(0),
+				"height":        oapi.GetSchema(0),
+				"frameRate":     oapi.GetSchema(float64(0)),
+				"bitRate":       oapi.GetSchema(int64(0)),
+				"channels":      oapi.GetSchema(0),
+				"channelLayout": oapi.GetSchema("string"),
+				"language":      oapi.GetSchema("string"),
+				"default":       oapi.GetSchema(true),
+				"forced":        oapi.GetSchema(true),
 			},
 		})
 
 		WebServer.OpenApi.Components.Schemas.New("video", oapi.OpenApiSchema{
 			Type: "object",
 			Properties: oapi.SchemaCollection{
-				"id":       oapi.GetSchema("string"),
-				"title":    oapi.GetSchema("string"),
-				"filepath": oapi.GetSchema("string"),
-				"duration": oapi.GetSchema(int64(0)),
-				"size":     oapi.GetSchema(int64(0)),
+				"id":          oapi.GetSchema("string"),
+				"title":       oapi.GetSchema("string"),
+				"filepath":    oapi.GetSchema("string"),
+				"duration":    oapi.GetSchema(int64(0)),
+				"size":        oapi.GetSchema(int64(0)),
+				"fingerprint": oapi.GetSchema("string"),
 				"folder": oapi.OpenApiSchema{
 					Type: "array",
 					Items: &oapi.OpenApiSchema{
@@ -242,6 +664,203 @@ func AddWebsite(fsys embed.FS, startDir string, fileCounter prometheus.Gauge, co
 						"watched": oapi.GetSchema(true),
 					},
 				},
+				"streams": oapi.OpenApiSchema{
+					Type: "array",
+					Items: &oapi.OpenApiSchema{
+						Ref: WebServer.OpenApi.GetRef("schemas", "video-stream"),
+					},
+				},
+				"subtitles": oapi.OpenApiSchema{
+					Type: "array",
+					Items: &oapi.OpenApiSchema{
+						Ref: WebServer.OpenApi.GetRef("schemas", "subtitle"),
+					},
+				},
+				"progress": oapi.OpenApiSchema{
+					Ref: WebServer.OpenApi.GetRef("schemas", "watch-progress"),
+				},
+				"tags": oapi.OpenApiSchema{
+					Type: "array",
+					Items: &oapi.OpenApiSchema{
+						Ref: WebServer.OpenApi.GetRef("schemas", "tag"),
+					},
+				},
+			},
+		})
+
+		WebServer.OpenApi.Components.Schemas.New("tag", oapi.OpenApiSchema{
+			Type: "object",
+			Properties: oapi.SchemaCollection{
+				"id":   oapi.GetSchema("string"),
+				"name": oapi.GetSchema("string"),
+			},
+		})
+
+		WebServer.OpenApi.Components.Schemas.New("tag-count", oapi.OpenApiSchema{
+			Type: "object",
+			Properties: oapi.SchemaCollection{
+				"id":       oapi.GetSchema("string"),
+				"name":     oapi.GetSchema("string"),
+				"videos":   oapi.GetSchema(int64(0)),
+				"pictures": oapi.GetSchema(int64(0)),
+				"count":    oapi.GetSchema(int64(0)),
+			},
+		})
+
+		WebServer.OpenApi.Components.Schemas.New("watch-progress", oapi.OpenApiSchema{
+			Type: "object",
+			Properties: oapi.SchemaCollection{
+				"videoId":     oapi.GetSchema("string"),
+				"position":    oapi.GetSchema(float64(0)),
+				"watched":     oapi.GetSchema(float64(0)),
+				"completed":   oapi.GetSchema(true),
+				"lastWatched": oapi.GetSchema("string"),
+			},
+		})
+
+		WebServer.OpenApi.Components.Schemas.New("history-page", oapi.OpenApiSchema{
+			Type: "object",
+			Properties: oapi.SchemaCollection{
+				"entries": oapi.OpenApiSchema{
+					Type: "array",
+					Items: &oapi.OpenApiSchema{
+						Type: "object",
+						Properties: oapi.SchemaCollection{
+							"id":            oapi.GetSchema(0),
+							"videoId":       oapi.GetSchema("string"),
+							"startPosition": oapi.GetSchema(float64(0)),
+							"endPosition":   oapi.GetSchema(float64(0)),
+							"startedAt":     oapi.GetSchema("string"),
+							"endedAt":       oapi.GetSchema("string"),
+							"client":        oapi.GetSchema("string"),
+							"video": oapi.OpenApiSchema{
+								Ref: WebServer.OpenApi.GetRef("schemas", "video"),
+							},
+						},
+					},
+				},
+				"offset": oapi.GetSchema(0),
+				"limit":  oapi.GetSchema(0),
+				"total":  oapi.GetSchema(int64(0)),
+			},
+		})
+
+		WebServer.OpenApi.Components.Schemas.New("playlist", oapi.OpenApiSchema{
+			Type: "object",
+			Properties: oapi.SchemaCollection{
+				"id":          oapi.GetSchema("string"),
+				"ownerId":     oapi.GetSchema("string"),
+				"name":        oapi.GetSchema("string"),
+				"description": oapi.GetSchema("string"),
+				"visibility":  oapi.GetSchema("string"),
+				"createdAt":   oapi.GetSchema("string"),
+				"updatedAt":   oapi.GetSchema("string"),
+				"entries": oapi.OpenApiSchema{
+					Type: "array",
+					Items: &oapi.OpenApiSchema{
+						Type: "object",
+						Properties: oapi.SchemaCollection{
+							"id":       oapi.GetSchema(0),
+							"videoId":  oapi.GetSchema("string"),
+							"position": oapi.GetSchema(0),
+							"video": oapi.OpenApiSchema{
+								Ref: WebServer.OpenApi.GetRef("schemas", "video"),
+							},
+						},
+					},
+				},
+			},
+		})
+
+		WebServer.OpenApi.Components.Schemas.New("subtitle", oapi.OpenApiSchema{
+			Type: "object",
+			Properties: oapi.SchemaCollection{
+				"id":              oapi.GetSchema("string"),
+				"filePath":        oapi.GetSchema("string"),
+				"format":          oapi.GetSchema("string"),
+				"language":        oapi.GetSchema("string"),
+				"label":           oapi.GetSchema("string"),
+				"default":         oapi.GetSchema(true),
+				"forced":          oapi.GetSchema(true),
+				"hearingImpaired": oapi.GetSchema(true),
+			},
+		})
+
+		WebServer.OpenApi.Components.Schemas.New("signed-urls", oapi.OpenApiSchema{
+			Type: "object",
+			Properties: oapi.SchemaCollection{
+				"expiresAt": oapi.GetSchema("string"),
+				"query":     oapi.GetSchema("string"),
+				"stream":    oapi.GetSchema("string"),
+				"hls":       oapi.GetSchema("string"),
+				"subtitles": oapi.OpenApiSchema{
+					Type: "array",
+					Items: &oapi.OpenApiSchema{
+						Ref: WebServer.OpenApi.GetRef("schemas", "subtitle"),
+					},
+				},
+			},
+		})
+
+		WebServer.OpenApi.Components.Schemas.New("folder-node", oapi.OpenApiSchema{
+			Type: "object",
+			Properties: oapi.SchemaCollection{
+				"name":     oapi.GetSchema("string"),
+				"path":     oapi.GetSchema("string"),
+				"videos":   oapi.GetSchema(int64(0)),
+				"pictures": oapi.GetSchema(int64(0)),
+				"size":     oapi.GetSchema(int64(0)),
+				"duration": oapi.GetSchema(int64(0)),
+				"children": oapi.OpenApiSchema{
+					Type: "array",
+					Items: &oapi.OpenApiSchema{
+						Ref: WebServer.OpenApi.GetRef("schemas", "folder-node"),
+					},
+				},
+			},
+		})
+
+		WebServer.OpenApi.Components.Schemas.New("folder-contents", oapi.OpenApiSchema{
+			Type: "object",
+			Properties: oapi.SchemaCollection{
+				"path": oapi.GetSchema("string"),
+				"folders": oapi.OpenApiSchema{
+					Type: "array",
+					Items: &oapi.OpenApiSchema{
+						Ref: WebServer.OpenApi.GetRef("schemas", "folder-node"),
+					},
+				},
+				"videos": oapi.OpenApiSchema{
+					Type: "array",
+					Items: &oapi.OpenApiSchema{
+						Ref: WebServer.OpenApi.GetRef("schemas", "video"),
+					},
+				},
+				"pictures": oapi.OpenApiSchema{
+					Type: "array",
+					Items: &oapi.OpenApiSchema{
+						Ref: WebServer.OpenApi.GetRef("schemas", "picture"),
+					},
+				},
+				"offset": oapi.GetSchema(0),
+				"limit":  oapi.GetSchema(0),
+				"total":  oapi.GetSchema(int64(0)),
+			},
+		})
+
+		WebServer.OpenApi.Components.Schemas.New("duplicate-group", oapi.OpenApiSchema{
+			Type: "object",
+			Properties: oapi.SchemaCollection{
+				"fingerprint": oapi.GetSchema("string"),
+				"size":        oapi.GetSchema(int64(0)),
+				"duration":    oapi.GetSchema(int64(0)),
+				"wasted":      oapi.GetSchema(int64(0)),
+				"videos": oapi.OpenApiSchema{
+					Type: "array",
+					Items: &oapi.OpenApiSchema{
+						Ref: WebServer.OpenApi.GetRef("schemas", "video"),
+					},
+				},
 			},
 		})
 
@@ -258,6 +877,17 @@ func AddWebsite(fsys embed.FS, startDir string, fileCounter prometheus.Gauge, co
 						"isAdmin": oapi.GetSchema(true),
 					},
 				},
+				"preferences": oapi.OpenApiSchema{
+					Ref: WebServer.OpenApi.GetRef("schemas", "preferences"),
+				},
+			},
+		})
+
+		WebServer.OpenApi.Components.Schemas.New("preferences", oapi.OpenApiSchema{
+			Type: "object",
+			Properties: oapi.SchemaCollection{
+				"maxQuality":    oapi.GetSchema(0),
+				"audioLanguage": oapi.GetSchema("string"),
 			},
 		})
 
@@ -271,9 +901,31 @@ func AddWebsite(fsys embed.FS, startDir string, fileCounter prometheus.Gauge, co
 			},
 		})
 
+		WebServer.OpenApi.Components.Schemas.New("scan-progress", oapi.OpenApiSchema{
+			Type: "object",
+			Properties: oapi.SchemaCollection{
+				"running":    oapi.GetSchema(true),
+				"seen":       oapi.GetSchema(int64(0)),
+				"probed":     oapi.GetSchema(int64(0)),
+				"failed":     oapi.GetSchema(int64(0)),
+				"created":    oapi.GetSchema(int64(0)),
+				"relinked":   oapi.GetSchema(int64(0)),
+				"startedAt":  oapi.GetSchema("string"),
+				"finishedAt": oapi.GetSchema("string"),
+				"error":      oapi.GetSchema("string"),
+			},
+		})
+
 		// WebServer.OpenApi.Components.Schemas.New("api-videos")
 
-		WebServer.HandleFunc(configs.GraphqlEndpoint, gql.Handler(conn))
+		var gqlHandler = gql.Handler(conn)
+		WebServer.HandleFunc(configs.GraphqlEndpoint, CheckAuth(conn, func(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+			var ctx = gql.WithVideoUpdate(gql.WithUser(r.Context(), user), func(v models.Video) {
+				updateVideoCache(videos, v)
+			})
+			ctx = gql.WithScanner(ctx, libScanner)
+			gqlHandler(w, r.WithContext(ctx))
+		}))
 		WebServer.HandleFunc(configs.GraphqlPlaygroundEndpoint, func(w http.ResponseWriter, r *http.Request) {
 			if err := gql.Playground(w, configs.GraphqlEndpoint); err != nil {
 				log.Err(err).Send()
@@ -2,8 +2,22 @@ package routes
 
 import (
 	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"full/libs/hls"
+	"full/libs/media"
 	"full/libs/models"
+	"full/libs/playback"
+	"full/libs/routes/oapi"
+	"full/libs/signedurl"
+	"full/libs/throttle"
+	"full/libs/trickplay"
+	"io"
+	"net"
+	"net/http"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -53,33 +67,361 @@ func SessionManager(conn *gorm.DB) {
 	}
 }
 
+// GetMimeType returns the mime type of the file from the media registry, nil when unknown
 func GetMimeType(file string) *string {
-	var mimeMap = map[string]string{
-		".css":   "text/css",
-		".csv":   "text/csv",
-		".gif":   "image/gif",
-		".html":  "text/html",
-		".jepg":  "image/jpeg",
-		".jpg":   "image/jpeg",
-		".js":    "text/javascript",
-		".json":  "application/json",
-		".md":    "text/markdown",
-		".mjs":   "text/javascript",
-		".otf":   "font/otf",
-		".pdf":   "application/pdf",
-		".php":   "application/x-httpd-php",
-		".svg":   "image/svg+xml",
-		".ttf":   "font/ttf",
-		".webp":  "image/webp",
-		".woff":  "font/woff",
-		".woff2": "font/woff2",
-		".xml":   "application/xml",
-	}
-	ext := strings.ToLower(path.Ext(file))
-
-	mime, ok := mimeMap[ext]
+	t, ok := media.Detect(file)
 	if !ok {
 		return nil
 	}
-	return &mime
+	return &t.MimeType
+}
+
+func streamFilterFromQuery(r *http.Request) (filter models.StreamFilter, err error) {
+	var query = r.URL.Query()
+	filter.VideoCodec = query.Get("videoCodec")
+	filter.AudioCodec = query.Get("audioCodec")
+	filter.AudioLanguage = query.Get("audioLanguage")
+	filter.SubtitleLanguage = query.Get("subtitleLanguage")
+	if minHeight := query.Get("minHeight"); len(minHeight) > 0 {
+		if filter.MinHeight, err = strconv.Atoi(minHeight); err != nil {
+			return filter, fmt.Errorf("invalid minHeight `%s`", minHeight)
+		}
+	}
+	return filter, nil
+}
+
+func streamFilterParameters() []oapi.OpenApiParameter {
+	return []oapi.OpenApiParameter{
+		{Name: "videoCodec", In: "query", Description: "Codec of a video stream, like hevc", Schema: oapi.GetSchema("string")},
+		{Name: "audioCodec", In: "query", Description: "Codec of an audio stream, like aac", Schema: oapi.GetSchema("string")},
+		{Name: "minHeight", In: "query", Description: "Minimum height of a video stream, like 1080", Schema: oapi.GetSchema(0)},
+		{Name: "audioLanguage", In: "query", Description: "Language of an audio stream, like ita", Schema: oapi.GetSchema("string")},
+		{Name: "subtitleLanguage", In: "query", Description: "Language of a subtitle stream, like eng", Schema: oapi.GetSchema("string")},
+	}
+}
+
+// queryList returns the values of a query parameter, it can be repeated and hold comma separated values
+func queryList(r *http.Request, name string) []string {
+	var out []string
+	for _, value := range r.URL.Query()[name] {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				out = append(out, item)
+			}
+		}
+	}
+	return out
+}
+
+func tagFilterFromQuery(r *http.Request) (models.TagFilter, error) {
+	return models.NewTagFilter(queryList(r, "tagsAny"), queryList(r, "tagsAll"), queryList(r, "tagsNone"))
+}
+
+func tagFilterParameters() []oapi.OpenApiParameter {
+	return []oapi.OpenApiParameter{
+		{Name: "tagsAny", In: "query", Description: "Comma separated tags, at least one is required", Schema: oapi.GetSchema("string")},
+		{Name: "tagsAll", In: "query", Description: "Comma separated tags, all of them are required", Schema: oapi.GetSchema("string")},
+		{Name: "tagsNone", In: "query", Description: "Comma separated tags, none of them is allowed", Schema: oapi.GetSchema("string")},
+	}
+}
+
+// authorize checks that the user can access the content stored in the folder,
+// anonymous users get 401 and the content of unregistered folders 403
+func authorize(conn *gorm.DB, r *http.Request, folder *models.Folder, user *models.User) (int, error) {
+	var err = folder.Authorize(conn.WithContext(r.Context()), user)
+	switch {
+	case err == nil:
+		return http.StatusOK, nil
+	case errors.Is(err, models.ErrLoginRequired):
+		return http.StatusUnauthorized, err
+	case errors.Is(err, models.ErrFolderNotRegistered):
+		return http.StatusForbidden, err
+	}
+	return http.StatusInternalServerError, err
+}
+
+// findVideo returns the video with the given id together with the status code
+// describing the failure, if any. The folder of the video must be accessible by the
+// user, unless the request is signed for the video
+func findVideo(conn *gorm.DB, r *http.Request, id string, user *models.User) (*models.Video, int, error) {
+	var data []models.Video
+	if tx := conn.WithContext(r.Context()).Preload("Streams").Preload("Subtitles").Find(&data, models.Video{Id: id}); tx.Error != nil {
+		return nil, http.StatusInternalServerError, tx.Error
+	}
+
+	switch len(data) {
+	case 0:
+		return nil, http.StatusNotFound, fmt.Errorf("cannot find video with id=\"%s\"", id)
+	case 1:
+		if signedVideo(r) == data[0].Id {
+			return &data[0], http.StatusOK, nil
+		}
+		if status, err := authorize(conn, r, data[0].Folder, user); err != nil {
+			return nil, status, err
+		}
+		return &data[0], http.StatusOK, nil
+	default:
+		return nil, http.StatusNotFound, fmt.Errorf("found multiple videos with id=\"%s\"", id)
+	}
+}
+
+// findPicture returns the picture with the given id, like findVideo
+func findPicture(conn *gorm.DB, r *http.Request, id string, user *models.User) (*models.Picture, int, error) {
+	var data []models.Picture
+	if tx := conn.WithContext(r.Context()).Find(&data, models.Picture{Id: id}); tx.Error != nil {
+		return nil, http.StatusInternalServerError, tx.Error
+	}
+
+	switch len(data) {
+	case 0:
+		return nil, http.StatusNotFound, fmt.Errorf("cannot find picture with id=`%s`", id)
+	case 1:
+		if status, err := authorize(conn, r, data[0].Folder, user); err != nil {
+			return nil, status, err
+		}
+		return &data[0], http.StatusOK, nil
+	default:
+		return nil, http.StatusInternalServerError, fmt.Errorf("found %d pictures with id=`%s`", len(data), id)
+	}
+}
+
+// findHlsVideo returns the video of an HLS request, it must exist on the disk and have a known duration
+func findHlsVideo(conn *gorm.DB, r *http.Request, user *models.User) (*models.Video, int, error) {
+	vid, status, err := findVideo(conn, r, r.PathValue("id"), user)
+	if err != nil {
+		return nil, status, err
+	}
+	if !vid.CheckFile(conn.WithContext(r.Context())) {
+		return nil, http.StatusNotFound, fmt.Errorf("cannot find video with id=\"%s\"", vid.Id)
+	}
+	if vid.Duration <= 0 {
+		return nil, http.StatusUnprocessableEntity, fmt.Errorf("duration of video id=\"%s\" is unknown", vid.Id)
+	}
+	return vid, http.StatusOK, nil
+}
+
+// audioFromQuery returns the audio track chosen with the audio (index of the stream
+// inside the container) or the audioLanguage query parameters, the preferred language
+// of the user is used otherwise, a nil user ignores it. It returns nil when the main
+// track is going to be played
+func audioFromQuery(r *http.Request, vid *models.Video, user *models.User) (*models.VideoStream, error) {
+	var query = r.URL.Query()
+	var s *models.VideoStream
+	switch {
+	case len(query.Get("audio")) > 0:
+		index, err := strconv.Atoi(query.Get("audio"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid audio track `%s`", query.Get("audio"))
+		}
+		if s = vid.AudioStream(index); s == nil {
+			return nil, fmt.Errorf("cannot find audio track %d in video id=\"%s\"", index, vid.Id)
+		}
+	case len(query.Get("audioLanguage")) > 0:
+		if s = vid.AudioStreamIn(query.Get("audioLanguage")); s == nil {
+			return nil, fmt.Errorf("cannot find audio track in `%s` in video id=\"%s\"", query.Get("audioLanguage"), vid.Id)
+		}
+	case user != nil && len(user.Preferences.AudioLanguage) > 0:
+		// The preference is a hint, the videos without the language play the main track
+		s = vid.AudioStreamIn(user.Preferences.AudioLanguage)
+	}
+	if main := vid.MainAudioStream(); s != nil && main != nil && main.Index == s.Index {
+		return nil, nil
+	}
+	return s, nil
+}
+
+// maxQualityFromQuery returns the height of the highest HLS variant offered,
+// the query parameter wins over the preference of the logged user
+func maxQualityFromQuery(r *http.Request, user *models.User) (int, error) {
+	maxQuality, err := hls.ParseQuality(r.URL.Query().Get("maxQuality"))
+	if err != nil {
+		return 0, err
+	}
+	if maxQuality == 0 && user != nil {
+		maxQuality = user.Preferences.MaxQuality
+	}
+	return maxQuality, nil
+}
+
+// streamQuery is the query string of the urls pointing to another stream of the
+// video: the audio track, the maximum quality and the signature of the request, when it is signed
+func streamQuery(r *http.Request, audio *models.VideoStream) string {
+	var query = signedurl.Params(r.URL.Query())
+	if maxQuality := r.URL.Query().Get("maxQuality"); len(maxQuality) > 0 {
+		query.Set("maxQuality", maxQuality)
+	}
+	if audio != nil {
+		query.Set("audio", strconv.Itoa(audio.Index))
+	}
+	if len(query) == 0 {
+		return ""
+	}
+	return "?" + query.Encode()
+}
+
+// limitStream counts the stream of the video against the limits of the user and throttles its writes,
+// the request is answered with 429 and false is returned when a limit is reached
+func limitStream(limiter *throttle.Limiter, w http.ResponseWriter, r *http.Request, user *models.User, vid *models.Video) (http.ResponseWriter, func(), bool) {
+	if limiter == nil {
+		return w, func() {}, true
+	}
+	// The visitors without a user are told apart by their address
+	var key = "ip:" + r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		key = "ip:" + host
+	}
+	if user != nil {
+		key = "user:" + user.Id
+	}
+	release, err := limiter.Acquire(key, vid.Id)
+	if err != nil {
+		w.Header().Set("Retry-After", strconv.Itoa(int(throttle.RetryAfter/time.Second)))
+		apiError(w, err, http.StatusTooManyRequests)
+		return w, nil, false
+	}
+	return limiter.Writer(r.Context(), w, key), release, true
+}
+
+// startFromQuery reads the start query parameter, either seconds (90.5) or a duration (1m30s)
+func startFromQuery(r *http.Request) (time.Duration, error) {
+	var value = r.URL.Query().Get("start")
+	if len(value) == 0 {
+		return 0, nil
+	}
+	var start time.Duration
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		start = time.Duration(seconds * float64(time.Second))
+	} else if start, err = time.ParseDuration(value); err != nil {
+		return 0, fmt.Errorf("invalid start `%s`", value)
+	}
+	if start < 0 {
+		return 0, fmt.Errorf("start cannot be negative")
+	}
+	return start, nil
+}
+
+// videoInfo is the payload of /video/info, the video together with what the
+// server can offer for it
+type videoInfo struct {
+	*models.Video
+	Preview *trickplay.Info `json:"preview,omitempty"`
+	// Hls is the url of the master playlist, when HLS streaming is enabled
+	Hls string `json:"hls,omitempty"`
+	// Playback is the plan for a client playing what every browser supports
+	Playback *playback.Plan `json:"playback,omitempty"`
+	// Subtitles replaces the files of the video with every track the player
+	// can choose, embedded streams included
+	Subtitles []models.SubtitleTrack `json:"subtitles,omitempty"`
+}
+
+func newVideoInfo(vid *models.Video) videoInfo {
+	return videoInfo{Video: vid, Subtitles: vid.SubtitleTracks()}
+}
+
+// signedUrls are the stream urls of a video usable without the session cookie
+type signedUrls struct {
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Query is the signature, it is accepted by every stream route of the video
+	Query     string                 `json:"query"`
+	Stream    string                 `json:"stream"`
+	Hls       string                 `json:"hls,omitempty"`
+	Subtitles []models.SubtitleTrack `json:"subtitles,omitempty"`
+}
+
+func newSignedUrls(vid *models.Video, expires time.Time, query string) signedUrls {
+	var out = signedUrls{
+		ExpiresAt: expires,
+		Query:     query,
+		Stream:    fmt.Sprintf("/video/stream/%s?%s", vid.Id, query),
+	}
+	if vid.Duration > 0 {
+		out.Hls = fmt.Sprintf("/video/hls/%s/master.m3u8?%s", vid.Id, query)
+	}
+	for _, t := range vid.SubtitleTracks() {
+		if len(t.Url) > 0 {
+			t.Url += "?" + query
+		}
+		out.Subtitles = append(out.Subtitles, t)
+	}
+	return out
+}
+
+// findFolder returns the folder with the given id, folders requiring
+// authentication are not returned to anonymous users
+func findFolder(conn *gorm.DB, r *http.Request, id string, user *models.User) (*models.Folder, int, error) {
+	folders, err := models.LoadFolders(conn.WithContext(r.Context()), models.Folder{Id: id})
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	switch {
+	case len(folders) == 0:
+		return nil, http.StatusNotFound, fmt.Errorf("cannot find folder with id=\"%s\"", id)
+	case len(folders) > 1:
+		return nil, http.StatusNotFound, fmt.Errorf("found multiple folders with id=\"%s\"", id)
+	case !folders[0].CanAccess(user):
+		return nil, http.StatusUnauthorized, fmt.Errorf("folder with id=\"%s\" requires authentication", id)
+	}
+	return &folders[0], http.StatusOK, nil
+}
+
+// pageFromQuery reads the offset and limit query parameters, missing values are zero
+func pageFromQuery(r *http.Request) (offset int, limit int, err error) {
+	var query = r.URL.Query()
+	if value := query.Get("offset"); len(value) > 0 {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid offset `%s`", value)
+		}
+	}
+	if value := query.Get("limit"); len(value) > 0 {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			return 0, 0, fmt.Errorf("invalid limit `%s`", value)
+		}
+	}
+	return offset, limit, nil
+}
+
+// findPlaylist returns the playlist when the user can see it, edit requires the user to own it.
+// The private playlists of the others are not found at all
+func findPlaylist(conn *gorm.DB, r *http.Request, id string, user *models.User, edit bool) (*models.Playlist, int, error) {
+	if edit && user == nil {
+		return nil, http.StatusUnauthorized, errors.New("login required")
+	}
+	playlist, err := models.LoadPlaylist(conn.WithContext(r.Context()), id)
+	if err != nil {
+		if errors.Is(err, models.ErrPlaylistNotFound) {
+			return nil, http.StatusNotFound, err
+		}
+		log.Err(err).Send()
+		return nil, http.StatusInternalServerError, err
+	}
+	if !playlist.CanView(user) {
+		return nil, http.StatusNotFound, fmt.Errorf("%w with id=`%s`", models.ErrPlaylistNotFound, id)
+	}
+	if edit && !playlist.CanEdit(user) {
+		return nil, http.StatusForbidden, models.ErrPlaylistForbidden
+	}
+	return playlist, http.StatusOK, nil
+}
+
+// requireAdmin returns the status code for users that are not administrators
+func requireAdmin(user *models.User) (int, error) {
+	switch {
+	case user == nil:
+		return http.StatusUnauthorized, models.ErrLoginRequired
+	case !user.Perms.IsAdmin:
+		return http.StatusForbidden, models.ErrAdminRequired
+	}
+	return http.StatusOK, nil
+}
+
+// decodeBody reads the json body of the request
+func decodeBody[T any](r *http.Request) (T, error) {
+	var out T
+	decoder := json.NewDecoder(io.LimitReader(r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&out); err != nil {
+		return out, fmt.Errorf("invalid body: %w", err)
+	}
+	return out, nil
 }
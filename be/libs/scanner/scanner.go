@@ -0,0 +1,468 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"full/libs/models"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+const batchSize int = 100
+
+var ErrAlreadyRunning = errors.New("a scan is already running")
+
+type Progress struct {
+	Running    bool      `json:"running"`
+	Seen       int64     `json:"seen"`
+	Probed     int64     `json:"probed"`
+	Failed     int64     `json:"failed"`
+	Created    int64     `json:"created"`
+	Relinked   int64     `json:"relinked"`
+	StartedAt  time.Time `json:"startedAt,omitzero"`
+	FinishedAt time.Time `json:"finishedAt,omitzero"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// job is a video waiting for the workers, stored videos are only completed
+// with the fingerprint and the streams they are missing
+type job struct {
+	video  *models.Video
+	probe  bool
+	stored bool
+}
+
+// library holds the stored videos while a scan is running
+type library struct {
+	known   map[string]*models.Video
+	byPath  map[string]*models.Video
+	missing map[string]*models.Video
+	mut     sync.Mutex
+}
+
+// claim flags a missing video as existing again, it fails when the video has
+// already been relinked to another file
+func (l *library) claim(v *models.Video) bool {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if _, ok := l.missing[v.Id]; !ok {
+		return false
+	}
+	delete(l.missing, v.Id)
+	v.Attributes.Exists = true
+	return true
+}
+
+// takeMissing returns and removes the missing video matching the content of v
+func (l *library) takeMissing(v *models.Video) *models.Video {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	for id, m := range l.missing {
+		if v.MatchesMissing(m) {
+			delete(l.missing, id)
+			return m
+		}
+	}
+	return nil
+}
+
+type Scanner struct {
+	conn    *gorm.DB
+	workers int
+	timeout time.Duration
+
+	// OnVideo is called for every video created or flagged as existing again
+	OnVideo func(v models.Video)
+	// OnProgress is called every time a counter changes
+	OnProgress func(p Progress)
+	// OnFinish is called once the scan is over, even when it failed
+	OnFinish func(p Progress)
+
+	running                                 atomic.Bool
+	seen, probed, failed, created, relinked atomic.Int64
+	startedAt, finishedAt                   time.Time
+	lastErr                                 error
+	cancel                                  context.CancelFunc
+	mut                                     sync.Mutex
+}
+
+// New returns a scanner running at most workers ffprobe processes at the same time,
+// a value <= 0 uses the number of CPUs
+func New(conn *gorm.DB, workers int) *Scanner {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return &Scanner{
+		conn:    conn,
+		workers: workers,
+		timeout: models.ProbeTimeout,
+	}
+}
+
+func (s *Scanner) Progress() Progress {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	var p = Progress{
+		Running:    s.running.Load(),
+		Seen:       s.seen.Load(),
+		Probed:     s.probed.Load(),
+		Failed:     s.failed.Load(),
+		Created:    s.created.Load(),
+		Relinked:   s.relinked.Load(),
+		StartedAt:  s.startedAt,
+		FinishedAt: s.finishedAt,
+	}
+	if s.lastErr != nil {
+		p.Error = s.lastErr.Error()
+	}
+	return p
+}
+
+// Cancel stops the running scan, if any
+func (s *Scanner) Cancel() bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.cancel == nil {
+		return false
+	}
+	s.cancel()
+	return true
+}
+
+func (s *Scanner) notifyProgress() {
+	if s.OnProgress != nil {
+		s.OnProgress(s.Progress())
+	}
+}
+
+func (s *Scanner) notifyVideo(v models.Video) {
+	if s.OnVideo != nil {
+		s.OnVideo(v)
+	}
+}
+
+// Scan walks the given folders, or every registered folder when none is given,
+// and stores the new videos and pictures found
+func (s *Scanner) Scan(ctx context.Context, folders ...models.Folder) error {
+	if !s.running.CompareAndSwap(false, true) {
+		return ErrAlreadyRunning
+	}
+	ctx, cancel := context.WithCancel(ctx)
+
+	s.mut.Lock()
+	s.cancel = cancel
+	s.startedAt = time.Now()
+	s.finishedAt = time.Time{}
+	s.lastErr = nil
+	s.seen.Store(0)
+	s.probed.Store(0)
+	s.failed.Store(0)
+	s.created.Store(0)
+	s.relinked.Store(0)
+	s.mut.Unlock()
+
+	err := s.scan(ctx, folders)
+
+	s.mut.Lock()
+	cancel()
+	s.cancel = nil
+	s.finishedAt = time.Now()
+	s.lastErr = err
+	s.mut.Unlock()
+	s.running.Store(false)
+	s.notifyProgress()
+	if s.OnFinish != nil {
+		s.OnFinish(s.Progress())
+	}
+
+	log.Info().
+		Int64("seen", s.seen.Load()).
+		Int64("probed", s.probed.Load()).
+		Int64("failed", s.failed.Load()).
+		Int64("created", s.created.Load()).
+		Int64("relinked", s.relinked.Load()).
+		Dur("elapsed", time.Since(s.startedAt)).
+		Msg("Scan completed")
+	return err
+}
+
+func (s *Scanner) scan(ctx context.Context, folders []models.Folder) error {
+	var conn = s.conn.WithContext(ctx)
+
+	if len(folders) == 0 {
+		var err error
+		if folders, err = models.LoadFolders(conn); err != nil {
+			return err
+		}
+	}
+
+	var rows []models.Video
+	if tx := conn.Preload("Streams").Preload("Subtitles").Find(&rows); tx.Error != nil {
+		return tx.Error
+	}
+	var lib = &library{
+		known:   make(map[string]*models.Video, len(rows)),
+		byPath:  map[string]*models.Video{},
+		missing: map[string]*models.Video{},
+	}
+	for idx := range rows {
+		var v = &rows[idx]
+		lib.known[v.Id] = v
+		// The files moved while the server was down are missing, the walk relinks them
+		if v.Attributes.Exists && !v.CheckFile(conn) {
+			log.Info().Bool("exists", false).Str("id", v.Id).Str("file", v.FilePath).Msg("Updated video exist flag")
+			s.notifyVideo(*v)
+		}
+		if v.Attributes.Exists {
+			lib.byPath[v.FilePath] = v
+		} else {
+			lib.missing[v.Id] = v
+		}
+	}
+
+	var (
+		jobs    = make(chan job)
+		results = make(chan job)
+		workers sync.WaitGroup
+		writer  sync.WaitGroup
+	)
+
+	for range s.workers {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for j := range jobs {
+				if len(j.video.Fingerprint) == 0 {
+					if err := j.video.GenerateFingerprint(); err != nil {
+						log.Err(err).Str("file", j.video.FilePath).Msg("Cannot fingerprint video")
+					}
+				}
+				if !j.probe {
+					results <- j
+					continue
+				}
+
+				probeCtx, cancel := context.WithTimeout(ctx, s.timeout)
+				err := j.video.Probe(probeCtx)
+				cancel()
+				if ctx.Err() != nil {
+					continue
+				}
+				if err != nil {
+					s.failed.Add(1)
+					log.Err(err).Str("file", j.video.FilePath).Str("id", j.video.Id).Send()
+				} else {
+					s.probed.Add(1)
+				}
+				s.notifyProgress()
+				results <- j
+			}
+		}()
+	}
+
+	writer.Add(1)
+	go func() {
+		defer writer.Done()
+		var batch []*models.Video
+		var flush = func() {
+			if len(batch) == 0 {
+				return
+			}
+			if tx := s.conn.CreateInBatches(batch, batchSize); tx.Error != nil {
+				log.Err(tx.Error).Send()
+			} else {
+				s.created.Add(int64(len(batch)))
+				for _, v := range batch {
+					log.Info().Str("id", v.Id).Str("title", v.Title).Msg("Created")
+					s.notifyVideo(*v)
+				}
+			}
+			batch = nil
+		}
+		for j := range results {
+			if j.stored {
+				var columns = map[string]any{"fingerprint": j.video.Fingerprint}
+				if j.probe {
+					columns["duration"] = j.video.Duration
+					columns["probe_failed"] = j.video.ProbeFailed
+					if err := j.video.ReplaceStreams(s.conn); err != nil {
+						log.Err(err).Send()
+					}
+				}
+				if tx := s.conn.Model(j.video).UpdateColumns(columns); tx.Error != nil {
+					log.Err(tx.Error).Send()
+				}
+				s.notifyVideo(*j.video)
+				continue
+			}
+
+			if m := lib.takeMissing(j.video); m != nil {
+				if err := m.Relink(s.conn, j.video); err != nil {
+					log.Err(err).Send()
+				} else {
+					s.relinked.Add(1)
+					s.notifyVideo(*m)
+					continue
+				}
+			}
+
+			batch = append(batch, j.video)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		}
+		flush()
+	}()
+
+	var err = s.walk(ctx, conn, folders, lib, jobs)
+	close(jobs)
+	workers.Wait()
+	close(results)
+	writer.Wait()
+
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+// syncSubtitles stores the subtitles found next to the stored video, found is
+// the same file just read from the folder
+func (s *Scanner) syncSubtitles(conn *gorm.DB, stored *models.Video, found *models.Video) {
+	var subtitles = found.Subtitles
+	if stored.Id != found.Id {
+		// The ids of the subtitles depend on the id of the video
+		var linked = models.Video{Id: stored.Id, Subtitles: slices.Clone(found.Subtitles)}
+		linked.LinkSubtitles()
+		subtitles = linked.Subtitles
+	}
+	changed, err := stored.UpdateSubtitles(conn, subtitles)
+	if err != nil {
+		log.Err(err).Str("id", stored.Id).Msg("Cannot update subtitles")
+		return
+	}
+	if changed {
+		log.Info().Str("id", stored.Id).Int("subtitles", len(stored.Subtitles)).Msg("Updated subtitles")
+		s.notifyVideo(*stored)
+	}
+}
+
+func (s *Scanner) walk(ctx context.Context, conn *gorm.DB, folders []models.Folder, lib *library, jobs chan<- job) error {
+	var queued = map[string]bool{}
+	var send = func(j job) error {
+		select {
+		case jobs <- j:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	for _, f := range folders {
+		f.AddOrigin()
+
+		for _, v := range f.GetVideos() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			s.seen.Add(1)
+
+			existing, isKnown := lib.known[v.Id]
+			if !isKnown {
+				// Relinked videos keep their original id
+				existing, isKnown = lib.byPath[v.FilePath]
+				isKnown = isKnown && existing.Size == v.Size
+			}
+			if isKnown {
+				s.syncSubtitles(conn, existing, v)
+			}
+			switch {
+			case isKnown && existing.Attributes.Exists:
+				var j = job{video: existing, stored: true, probe: len(existing.Streams) == 0 && !existing.ProbeFailed}
+				if (j.probe || len(existing.Fingerprint) == 0) && !queued[existing.Id] {
+					queued[existing.Id] = true
+					if err := send(j); err != nil {
+						return err
+					}
+				}
+				continue
+			case isKnown:
+				if !lib.claim(existing) {
+					continue
+				}
+				if tx := conn.Model(existing).UpdateColumns(map[string]any{"attr_exists": true}); tx.Error != nil {
+					log.Err(tx.Error).Send()
+					continue
+				}
+				log.Info().Bool("exists", true).Str("id", existing.Id).Msg("Updated video exist flag")
+				s.notifyVideo(*existing)
+			case !queued[v.Id]:
+				queued[v.Id] = true
+				if err := send(job{video: v, probe: true}); err != nil {
+					return err
+				}
+			}
+		}
+		s.notifyProgress()
+
+		// The videos stored before the rules changed are not part of the folder anymore
+		for _, v := range lib.byPath {
+			if !v.Attributes.Exists || v.Folder == nil || v.Folder.Id != f.Id || f.Allows(v.FilePath, false) {
+				continue
+			}
+			v.Attributes.Exists = false
+			if tx := conn.Model(v).UpdateColumns(map[string]any{"attr_exists": false}); tx.Error != nil {
+				log.Err(tx.Error).Send()
+				continue
+			}
+			log.Info().Str("id", v.Id).Str("file", v.FilePath).Msg("Video excluded by the scan rules")
+			s.notifyVideo(*v)
+		}
+
+		s.storePictures(conn, &f)
+	}
+	return nil
+}
+
+// storePictures stores the pictures of the folder not known yet. The ids are looked up
+// in chunks to stay under the limit of bound variables, the failures count as failed
+func (s *Scanner) storePictures(conn *gorm.DB, f *models.Folder) {
+	var pics = f.GetPictures()
+	var picExists = map[string]bool{}
+	for chunk := range slices.Chunk(pics, batchSize) {
+		var ids = make([]string, 0, len(chunk))
+		for _, p := range chunk {
+			ids = append(ids, p.Id)
+		}
+		var known []string
+		if tx := conn.Model(&models.Picture{}).Where("id IN ?", ids).Pluck("id", &known); tx.Error != nil {
+			log.Err(tx.Error).Str("folder", f.Path).Msg("Cannot load the stored pictures")
+			s.failed.Add(int64(len(pics)))
+			return
+		}
+		for _, id := range known {
+			picExists[id] = true
+		}
+	}
+
+	var newPics []*models.Picture
+	for _, p := range pics {
+		if !picExists[p.Id] {
+			picExists[p.Id] = true
+			newPics = append(newPics, p)
+		}
+	}
+	if len(newPics) > 0 {
+		if tx := conn.CreateInBatches(newPics, batchSize); tx.Error != nil {
+			log.Err(tx.Error).Str("folder", f.Path).Msg("Cannot store the new pictures")
+			s.failed.Add(int64(len(newPics)))
+		}
+	}
+}
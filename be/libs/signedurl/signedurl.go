@@ -0,0 +1,124 @@
+package signedurl
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultLifetime time.Duration = time.Hour * 6
+	MaxLifetime     time.Duration = time.Hour * 24 * 7
+
+	// Query parameters added to the signed urls
+	ParamExpires   string = "exp"
+	ParamUser      string = "uid"
+	ParamSignature string = "sig"
+
+	minSecretSize int = 32
+)
+
+var (
+	ErrInvalid = errors.New("invalid url signature")
+	ErrExpired = errors.New("signed url expired")
+)
+
+// Claims are what a signed url grants: the streams of one video until it
+// expires, optionally on behalf of a user
+type Claims struct {
+	VideoId string
+	UserId  string
+	Expires time.Time
+}
+
+// Signer mints and verifies the signed urls, changing its secret revokes every url signed before
+type Signer struct {
+	secret []byte
+}
+
+func New(secret []byte) (*Signer, error) {
+	if len(secret) < minSecretSize {
+		return nil, fmt.Errorf("the url secret must be at least %d bytes long", minSecretSize)
+	}
+	return &Signer{secret: secret}, nil
+}
+
+// LoadSecret reads the secret from the file, a random one is generated and
+// stored there when the file does not exist yet
+func LoadSecret(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return []byte(strings.TrimSpace(string(data))), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	var random = make([]byte, minSecretSize)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	var secret = hex.EncodeToString(random)
+	if err := os.WriteFile(path, []byte(secret+"\n"), 0o600); err != nil {
+		return nil, err
+	}
+	return []byte(secret), nil
+}
+
+func (s *Signer) signature(c Claims) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s\n%s\n%d", c.VideoId, c.UserId, c.Expires.Unix())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sign returns the query parameters granting the claims
+func (s *Signer) Sign(c Claims) url.Values {
+	var query = url.Values{}
+	query.Set(ParamExpires, strconv.FormatInt(c.Expires.Unix(), 10))
+	if len(c.UserId) > 0 {
+		query.Set(ParamUser, c.UserId)
+	}
+	query.Set(ParamSignature, s.signature(c))
+	return query
+}
+
+// IsSigned reports whether the query carries a signature
+func IsSigned(query url.Values) bool {
+	return query.Has(ParamSignature)
+}
+
+// Verify checks the signature of the query for the given video
+func (s *Signer) Verify(videoId string, query url.Values) (Claims, error) {
+	exp, err := strconv.ParseInt(query.Get(ParamExpires), 10, 64)
+	if err != nil {
+		return Claims{}, ErrInvalid
+	}
+	var c = Claims{VideoId: videoId, UserId: query.Get(ParamUser), Expires: time.Unix(exp, 0)}
+	if !hmac.Equal([]byte(query.Get(ParamSignature)), []byte(s.signature(c))) {
+		return Claims{}, ErrInvalid
+	}
+	if time.Now().After(c.Expires) {
+		return Claims{}, ErrExpired
+	}
+	return c, nil
+}
+
+// Params returns only the signature parameters of the query, they are copied
+// to the urls of the files referenced by a signed playlist
+func Params(query url.Values) url.Values {
+	var out = url.Values{}
+	for _, key := range []string{ParamExpires, ParamUser, ParamSignature} {
+		if query.Has(key) {
+			out.Set(key, query.Get(key))
+		}
+	}
+	return out
+}
@@ -0,0 +1,72 @@
+package signedurl
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	signer, err := New([]byte(strings.Repeat("s", minSecretSize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := New([]byte(strings.Repeat("o", minSecretSize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expires = time.Now().Add(time.Hour).Truncate(time.Second)
+	var valid = Claims{VideoId: "v-1", UserId: "u-1", Expires: expires}
+	var anonymous = Claims{VideoId: "v-1", Expires: expires}
+	var expired = Claims{VideoId: "v-1", UserId: "u-1", Expires: time.Now().Add(-time.Minute).Truncate(time.Second)}
+
+	var with = func(query url.Values, key string, value string) url.Values {
+		var out = url.Values{}
+		for k, v := range query {
+			out[k] = v
+		}
+		if len(value) == 0 {
+			out.Del(key)
+		} else {
+			out.Set(key, value)
+		}
+		return out
+	}
+
+	var tests = []struct {
+		name    string
+		videoId string
+		query   url.Values
+		want    Claims
+		wantErr error
+	}{
+		{name: "valid", videoId: "v-1", query: signer.Sign(valid), want: valid},
+		{name: "valid without user", videoId: "v-1", query: signer.Sign(anonymous), want: anonymous},
+		{name: "other video", videoId: "v-2", query: signer.Sign(valid), wantErr: ErrInvalid},
+		{name: "other secret", videoId: "v-1", query: other.Sign(valid), wantErr: ErrInvalid},
+		{name: "expired", videoId: "v-1", query: signer.Sign(expired), wantErr: ErrExpired},
+		{name: "changed user", videoId: "v-1", query: with(signer.Sign(valid), ParamUser, "u-2"), wantErr: ErrInvalid},
+		{name: "user added", videoId: "v-1", query: with(signer.Sign(anonymous), ParamUser, "u-1"), wantErr: ErrInvalid},
+		{name: "user removed", videoId: "v-1", query: with(signer.Sign(valid), ParamUser, ""), wantErr: ErrInvalid},
+		{name: "extended expiry", videoId: "v-1", query: with(signer.Sign(expired), ParamExpires, "99999999999"), wantErr: ErrInvalid},
+		{name: "invalid expiry", videoId: "v-1", query: with(signer.Sign(valid), ParamExpires, "soon"), wantErr: ErrInvalid},
+		{name: "missing expiry", videoId: "v-1", query: with(signer.Sign(valid), ParamExpires, ""), wantErr: ErrInvalid},
+		{name: "missing signature", videoId: "v-1", query: with(signer.Sign(valid), ParamSignature, ""), wantErr: ErrInvalid},
+		{name: "wrong signature", videoId: "v-1", query: with(signer.Sign(valid), ParamSignature, strings.Repeat("0", 64)), wantErr: ErrInvalid},
+		{name: "empty query", videoId: "v-1", query: url.Values{}, wantErr: ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := signer.Verify(tt.videoId, tt.query)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+			if got.VideoId != tt.want.VideoId || got.UserId != tt.want.UserId || !got.Expires.Equal(tt.want.Expires) {
+				t.Errorf("Verify() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
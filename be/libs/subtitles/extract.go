@@ -0,0 +1,145 @@
+package subtitles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"full/libs/ffmpeg"
+	"full/libs/models"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// The whole container is read to find the packets of the stream
+	extractTimeout time.Duration = time.Minute * 5
+	retryAfter     time.Duration = time.Minute * 10
+)
+
+var ErrImageBased = errors.New("image based subtitles cannot be converted to WebVTT")
+
+// Extractor converts the subtitle streams embedded in the videos to WebVTT
+// files, once per stream
+type Extractor struct {
+	dir string
+
+	inflight map[string]chan struct{}
+	failed   map[string]time.Time
+	mut      sync.Mutex
+}
+
+func NewExtractor(dir string) (*Extractor, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Extractor{
+		dir:      dir,
+		inflight: map[string]chan struct{}{},
+		failed:   map[string]time.Time{},
+	}, nil
+}
+
+func (e *Extractor) Path(videoId string, index int) string {
+	return filepath.Join(e.dir, videoId, strconv.Itoa(index)+".vtt")
+}
+
+// cached reports whether the file of the stream is there and newer than the video
+func (e *Extractor) cached(v *models.Video, out string) bool {
+	info, err := os.Stat(out)
+	if err != nil {
+		return false
+	}
+	if src, err := os.Stat(v.FilePath); err == nil && src.ModTime().After(info.ModTime()) {
+		return false
+	}
+	return true
+}
+
+// Get returns the path of the WebVTT file of the stream, extracting it when
+// it is not cached yet. Concurrent requests for the same stream wait for a single ffmpeg process
+func (e *Extractor) Get(ctx context.Context, v *models.Video, s *models.VideoStream) (string, error) {
+	if s.Type != models.StreamTypeSubtitle {
+		return "", fmt.Errorf("stream id=`%s` is not a subtitle", s.Id)
+	}
+	if !s.IsTextSubtitle() {
+		return "", fmt.Errorf("%w: %s", ErrImageBased, s.Codec)
+	}
+	var out = e.Path(v.Id, s.Index)
+	if e.cached(v, out) {
+		return out, nil
+	}
+
+	e.mut.Lock()
+	if failedAt, ok := e.failed[out]; ok && time.Since(failedAt) < retryAfter {
+		e.mut.Unlock()
+		return "", fmt.Errorf("subtitle extraction for stream id=`%s` failed recently", s.Id)
+	}
+	wait, running := e.inflight[out]
+	if !running {
+		wait = make(chan struct{})
+		e.inflight[out] = wait
+	}
+	e.mut.Unlock()
+
+	if running {
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		if _, err := os.Stat(out); err != nil {
+			return "", fmt.Errorf("cannot extract subtitle stream id=`%s`", s.Id)
+		}
+		return out, nil
+	}
+
+	defer func() {
+		e.mut.Lock()
+		delete(e.inflight, out)
+		e.mut.Unlock()
+		close(wait)
+	}()
+
+	// The extraction outlives the request, the file is useful for the next one anyway
+	extractCtx, cancel := context.WithTimeout(context.Background(), extractTimeout)
+	defer cancel()
+	if err := e.extract(extractCtx, v, s, out); err != nil {
+		e.mut.Lock()
+		e.failed[out] = time.Now()
+		e.mut.Unlock()
+		return "", err
+	}
+	return out, nil
+}
+
+func (e *Extractor) extract(ctx context.Context, v *models.Video, s *models.VideoStream, out string) error {
+	if _, err := os.Stat(v.FilePath); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+		return err
+	}
+
+	var tmp = out + ".tmp.vtt"
+	defer os.Remove(tmp)
+
+	if err := ffmpeg.Run(ctx,
+		"-i", v.FilePath,
+		"-map", fmt.Sprintf("0:%d", s.Index),
+		"-c:s", "webvtt",
+		"-f", "webvtt",
+		"-y", tmp,
+	); err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(tmp); err != nil {
+		return err
+	} else if info.Size() == 0 {
+		return errors.New("ffmpeg produced an empty subtitle")
+	}
+	return os.Rename(tmp, out)
+}
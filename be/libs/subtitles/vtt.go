@@ -0,0 +1,221 @@
+package subtitles
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const MimeType string = "text/vtt; charset=utf-8"
+
+// MaxSize is the largest subtitle file converted, real files are far smaller
+const MaxSize int64 = 16 << 20
+
+type cue struct {
+	start, end time.Duration
+	text       string
+}
+
+var (
+	srtTiming = regexp.MustCompile(`^\s*(\d+):(\d{1,2}):(\d{1,2})[,.](\d{1,3})\s*-->\s*(\d+):(\d{1,2}):(\d{1,2})[,.](\d{1,3})`)
+	srtFont   = regexp.MustCompile(`(?i)</?font[^>]*>`)
+	// Overrides like {\an8} or {\i1}
+	assTags = regexp.MustCompile(`\{[^}]*\}`)
+)
+
+// ToVtt converts a subtitle file to WebVTT, format is the extension of the
+// file: srt, ass, ssa or vtt
+func ToVtt(r io.Reader, format string) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxSize))
+	if err != nil {
+		return nil, err
+	}
+	var text = decode(data)
+
+	var cues []cue
+	switch strings.ToLower(strings.TrimPrefix(format, ".")) {
+	case "vtt":
+		if !strings.HasPrefix(text, "WEBVTT") {
+			return nil, fmt.Errorf("missing WEBVTT header")
+		}
+		return []byte(text), nil
+	case "srt":
+		cues = parseSrt(text)
+	case "ass", "ssa":
+		if cues, err = parseAss(text); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported subtitle format `%s`", format)
+	}
+	if len(cues) == 0 {
+		return nil, fmt.Errorf("cannot find any cue")
+	}
+
+	slices.SortStableFunc(cues, func(a, b cue) int { return cmp.Compare(a.start, b.start) })
+	var out bytes.Buffer
+	out.WriteString("WEBVTT\n\n")
+	for _, c := range cues {
+		fmt.Fprintf(&out, "%s --> %s\n%s\n\n", timestamp(c.start), timestamp(c.end), c.text)
+	}
+	return out.Bytes(), nil
+}
+
+// decode strips the byte order mark and the carriage returns, files which are
+// not valid UTF-8 are read as Latin-1, the most common encoding of old subtitles
+func decode(data []byte) string {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	var text string
+	if utf8.Valid(data) {
+		text = string(data)
+	} else {
+		var runes = make([]rune, len(data))
+		for idx, b := range data {
+			runes[idx] = rune(b)
+		}
+		text = string(runes)
+	}
+	return strings.ReplaceAll(text, "\r", "")
+}
+
+func timestamp(d time.Duration) string {
+	var ms = d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3_600_000, ms/60_000%60, ms/1000%60, ms%1000)
+}
+
+func duration(h, m, s, fraction string) time.Duration {
+	hours, _ := strconv.Atoi(h)
+	minutes, _ := strconv.Atoi(m)
+	seconds, _ := strconv.Atoi(s)
+	// The fraction is in hundredths for ASS and in thousandths for SRT
+	millis, _ := strconv.Atoi((fraction + "00")[:3])
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+		time.Duration(seconds)*time.Second + time.Duration(millis)*time.Millisecond
+}
+
+// escape keeps the characters that start a tag or an entity in WebVTT as text
+func escape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+func parseSrt(text string) (cues []cue) {
+	var current *cue
+	var lines []string
+	var flush = func() {
+		if current != nil {
+			current.text = strings.TrimSpace(strings.Join(lines, "\n"))
+			if len(current.text) > 0 {
+				cues = append(cues, *current)
+			}
+		}
+		current, lines = nil, nil
+	}
+
+	var scanner = bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 0, 64<<10), int(MaxSize))
+	for scanner.Scan() {
+		var line = scanner.Text()
+		if m := srtTiming.FindStringSubmatch(line); m != nil {
+			flush()
+			current = &cue{start: duration(m[1], m[2], m[3], m[4]), end: duration(m[5], m[6], m[7], m[8])}
+			continue
+		}
+		if current == nil {
+			// Counters and garbage before the first timing
+			continue
+		}
+		if len(strings.TrimSpace(line)) == 0 {
+			flush()
+			continue
+		}
+		// SRT allows the same tags as WebVTT but font, and the ASS overrides some tools leave
+		line = assTags.ReplaceAllString(srtFont.ReplaceAllString(line, ""), "")
+		lines = append(lines, strings.ReplaceAll(line, "&", "&amp;"))
+	}
+	flush()
+
+	// The counter of the next cue was read as text when the blank line is missing
+	for idx := range cues {
+		var text = cues[idx].text
+		if cut := strings.LastIndex(text, "\n"); cut >= 0 && strings.TrimSpace(text[cut+1:]) == strconv.Itoa(idx+2) {
+			cues[idx].text = text[:cut]
+		}
+	}
+	return cues
+}
+
+func parseAss(text string) ([]cue, error) {
+	var cues []cue
+	var inEvents bool
+	var format []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			inEvents = strings.EqualFold(line, "[Events]")
+			continue
+		}
+		if !inEvents {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "Format":
+			format = nil
+			for _, f := range strings.Split(value, ",") {
+				format = append(format, strings.ToLower(strings.TrimSpace(f)))
+			}
+		case "Dialogue":
+			if len(format) == 0 {
+				return nil, fmt.Errorf("dialogue before the events format")
+			}
+			// The text is the last field and it may contain commas
+			var fields = strings.SplitN(strings.TrimSpace(value), ",", len(format))
+			if len(fields) < len(format) {
+				continue
+			}
+			var get = func(name string) string {
+				if idx := slices.Index(format, name); idx >= 0 {
+					return strings.TrimSpace(fields[idx])
+				}
+				return ""
+			}
+			start, okStart := assTime(get("start"))
+			end, okEnd := assTime(get("end"))
+			if !okStart || !okEnd {
+				continue
+			}
+			var body = assTags.ReplaceAllString(fields[len(fields)-1], "")
+			body = strings.NewReplacer(`\N`, "\n", `\n`, "\n", `\h`, " ").Replace(body)
+			body = strings.TrimSpace(escape(body))
+			if len(body) == 0 {
+				continue
+			}
+			cues = append(cues, cue{start: start, end: end, text: body})
+		}
+	}
+	return cues, nil
+}
+
+// assTime reads the H:MM:SS.cc timestamps of ASS
+func assTime(s string) (time.Duration, bool) {
+	hms, fraction, ok := strings.Cut(s, ".")
+	if !ok {
+		return 0, false
+	}
+	var parts = strings.Split(hms, ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	return duration(parts[0], parts[1], parts[2], fraction), true
+}
@@ -0,0 +1,93 @@
+package subtitles
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToVtt(t *testing.T) {
+	const assHeader = "[Script Info]\nTitle: test\n\n[Events]\nFormat: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n"
+
+	var tests = []struct {
+		name    string
+		input   string
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "srt",
+			input:  "1\n00:00:01,000 --> 00:00:02,500\nHello\n\n2\n00:00:03,000 --> 00:00:04,000\nWorld\n",
+			format: "srt",
+			want:   "WEBVTT\n\n00:00:01.000 --> 00:00:02.500\nHello\n\n00:00:03.000 --> 00:00:04.000\nWorld\n\n",
+		},
+		{
+			name:   "srt with bom, carriage returns and dot",
+			input:  "\xef\xbb\xbf1\r\n00:00:01.000 --> 00:00:02.000\r\nHello\r\n",
+			format: ".SRT",
+			want:   "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nHello\n\n",
+		},
+		{
+			name:   "srt tags and entities",
+			input:  "1\n00:00:01,000 --> 00:00:02,000\n<font color=\"red\">{\\an8}<i>Tom & Jerry</i></font>\n",
+			format: "srt",
+			want:   "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\n<i>Tom &amp; Jerry</i>\n\n",
+		},
+		{
+			name:   "srt missing blank line",
+			input:  "1\n00:00:01,000 --> 00:00:02,000\nFirst\n2\n00:00:03,000 --> 00:00:04,000\nSecond\n",
+			format: "srt",
+			want:   "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nFirst\n\n00:00:03.000 --> 00:00:04.000\nSecond\n\n",
+		},
+		{
+			name:   "srt unsorted",
+			input:  "1\n00:01:00,000 --> 00:01:01,000\nLater\n\n2\n00:00:01,000 --> 00:00:02,000\nSooner\n",
+			format: "srt",
+			want:   "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nSooner\n\n00:01:00.000 --> 00:01:01.000\nLater\n\n",
+		},
+		{
+			name:   "latin-1",
+			input:  "1\n00:00:01,000 --> 00:00:02,000\nPerch\xe8\n",
+			format: "srt",
+			want:   "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nPerchè\n\n",
+		},
+		{
+			name:   "ass",
+			input:  assHeader + "Dialogue: 0,0:00:01.50,0:00:03.00,Default,,0,0,0,,{\\i1}Hello, world\\Nsecond <line>\n",
+			format: "ass",
+			want:   "WEBVTT\n\n00:00:01.500 --> 00:00:03.000\nHello, world\nsecond &lt;line&gt;\n\n",
+		},
+		{
+			name:   "ssa with hours",
+			input:  assHeader + "Dialogue: 0,1:02:03.04,1:02:05.00,Default,,0,0,0,,Late\n",
+			format: "ssa",
+			want:   "WEBVTT\n\n01:02:03.040 --> 01:02:05.000\nLate\n\n",
+		},
+		{
+			name:    "ass without format",
+			input:   "[Events]\nDialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,Hello\n",
+			format:  "ass",
+			wantErr: true,
+		},
+		{
+			name:   "vtt",
+			input:  "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nHello\n",
+			format: "vtt",
+			want:   "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nHello\n",
+		},
+		{name: "vtt without header", input: "00:00:01.000 --> 00:00:02.000\nHello\n", format: "vtt", wantErr: true},
+		{name: "no cues", input: "garbage\n", format: "srt", wantErr: true},
+		{name: "unsupported format", input: "data", format: "sub", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToVtt(strings.NewReader(tt.input), tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ToVtt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("ToVtt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
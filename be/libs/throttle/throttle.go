@@ -0,0 +1,211 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// Streams end whenever the viewer stops, the client is told to retry soon
+	RetryAfter time.Duration = time.Second * 30
+
+	// Writes are split in chunks so a single one never waits for too long
+	maxChunk int = 32 << 10
+)
+
+var (
+	ErrUserLimit  = errors.New("too many streams for this user")
+	ErrTotalLimit = errors.New("too many streams on the server")
+)
+
+type Config struct {
+	// MaxPerUser is the number of streams a single user can watch at the same time, 0 means no limit
+	MaxPerUser int
+	// MaxTotal is the number of streams served at the same time, 0 means no limit
+	MaxTotal int
+	// UserBandwidth is the maximum number of bytes per second sent to a single
+	// user across all their streams, 0 means no limit
+	UserBandwidth int64
+
+	// Active counts the streams being served, it can be nil
+	Active prometheus.Gauge
+	// Rejected counts the streams refused by a limit, labeled by the limit, it can be nil
+	Rejected *prometheus.CounterVec
+}
+
+// Limiter counts the active streams of every user and shares the bandwidth
+// of a user between their streams. A stream is a video watched by a user, the
+// overlapping requests of a player for the same video share its slot
+type Limiter struct {
+	cfg Config
+	// active counts the requests of every stream, by user and by video
+	active  map[string]map[string]int
+	buckets map[string]*bucket
+	total   int
+	mut     sync.Mutex
+}
+
+func New(cfg Config) *Limiter {
+	return &Limiter{
+		cfg:     cfg,
+		active:  map[string]map[string]int{},
+		buckets: map[string]*bucket{},
+	}
+}
+
+func (l *Limiter) reject(limit string, err error) (func(), error) {
+	if l.cfg.Rejected != nil {
+		l.cfg.Rejected.WithLabelValues(limit).Inc()
+	}
+	return nil, err
+}
+
+// Acquire registers a request of the user for the stream, release must be
+// called when it ends. Only a stream not already active counts against the limits
+func (l *Limiter) Acquire(key string, stream string) (release func(), err error) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	var streams = l.active[key]
+	if streams[stream] == 0 {
+		if l.cfg.MaxPerUser > 0 && len(streams) >= l.cfg.MaxPerUser {
+			return l.reject("user", ErrUserLimit)
+		}
+		if l.cfg.MaxTotal > 0 && l.total >= l.cfg.MaxTotal {
+			return l.reject("total", ErrTotalLimit)
+		}
+		if streams == nil {
+			streams = map[string]int{}
+			l.active[key] = streams
+		}
+		l.total++
+		if l.cfg.Active != nil {
+			l.cfg.Active.Inc()
+		}
+	}
+	streams[stream]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { l.release(key, stream) })
+	}, nil
+}
+
+func (l *Limiter) release(key string, stream string) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	var streams = l.active[key]
+	if streams[stream]--; streams[stream] > 0 {
+		return
+	}
+	delete(streams, stream)
+	l.total--
+	if l.cfg.Active != nil {
+		l.cfg.Active.Dec()
+	}
+	if len(streams) == 0 {
+		delete(l.active, key)
+		delete(l.buckets, key)
+	}
+}
+
+// Writer throttles w to the bandwidth of the user, w is returned as is when there is no limit
+func (l *Limiter) Writer(ctx context.Context, w http.ResponseWriter, key string) http.ResponseWriter {
+	if l.cfg.UserBandwidth <= 0 {
+		return w
+	}
+	l.mut.Lock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = newBucket(l.cfg.UserBandwidth)
+		l.buckets[key] = b
+	}
+	l.mut.Unlock()
+	return &writer{ResponseWriter: w, ctx: ctx, bucket: b}
+}
+
+// bucket is a token bucket holding at most one second of bandwidth
+type bucket struct {
+	rate   int64
+	tokens float64
+	last   time.Time
+	mut    sync.Mutex
+}
+
+func newBucket(rate int64) *bucket {
+	return &bucket{rate: rate, tokens: float64(rate), last: time.Now()}
+}
+
+// reserve takes n tokens at the time now and returns how long to wait for them
+func (b *bucket) reserve(now time.Time, n int) time.Duration {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	// A writer waiting for the lock may bring a time older than the last reservation
+	if now.Before(b.last) {
+		now = b.last
+	}
+	b.tokens = min(float64(b.rate), b.tokens+now.Sub(b.last).Seconds()*float64(b.rate))
+	b.last = now
+	// The tokens are reserved even when they are missing, the next writers wait for them
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / float64(b.rate) * float64(time.Second))
+}
+
+// wait takes n tokens, blocking until they are available
+func (b *bucket) wait(ctx context.Context, n int) error {
+	var delay = b.reserve(time.Now(), n)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type writer struct {
+	http.ResponseWriter
+	ctx    context.Context
+	bucket *bucket
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	var chunk = min(maxChunk, int(w.bucket.rate))
+	var written int
+	for len(p) > 0 {
+		var n = min(chunk, len(p))
+		if err := w.bucket.wait(w.ctx, n); err != nil {
+			return written, err
+		}
+		n, err := w.ResponseWriter.Write(p[:n])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (w *writer) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
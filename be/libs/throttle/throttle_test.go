@@ -0,0 +1,137 @@
+package throttle
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBucketReserve(t *testing.T) {
+	type step struct {
+		after time.Duration
+		n     int
+		want  time.Duration
+	}
+	var tests = []struct {
+		name  string
+		rate  int64
+		steps []step
+	}{
+		{
+			name:  "within the burst",
+			rate:  1000,
+			steps: []step{{n: 400}, {n: 600}},
+		},
+		{
+			name:  "above the burst",
+			rate:  1000,
+			steps: []step{{n: 1500, want: 500 * time.Millisecond}},
+		},
+		{
+			name:  "reservations queue up",
+			rate:  1000,
+			steps: []step{{n: 1000}, {n: 500, want: 500 * time.Millisecond}, {n: 500, want: time.Second}},
+		},
+		{
+			name:  "refill over time",
+			rate:  1000,
+			steps: []step{{n: 1000}, {after: 250 * time.Millisecond, n: 250}, {n: 250, want: 250 * time.Millisecond}},
+		},
+		{
+			name:  "refill is capped at one second",
+			rate:  1000,
+			steps: []step{{n: 1000}, {after: 10 * time.Second, n: 1000}, {n: 100, want: 100 * time.Millisecond}},
+		},
+		{
+			name:  "debt is paid before refilling",
+			rate:  1000,
+			steps: []step{{n: 3000, want: 2 * time.Second}, {after: time.Second, n: 1000, want: 2 * time.Second}},
+		},
+		{
+			name:  "older time",
+			rate:  1000,
+			steps: []step{{n: 1000}, {after: -time.Second, n: 500, want: 500 * time.Millisecond}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b = newBucket(tt.rate)
+			var now = b.last
+			for idx, s := range tt.steps {
+				now = now.Add(s.after)
+				if got := b.reserve(now, s.n); got != s.want {
+					t.Errorf("step %d: reserve(%d) = %s, want %s", idx, s.n, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterAcquire(t *testing.T) {
+	type request struct {
+		user, video string
+		wantErr     error
+	}
+	var tests = []struct {
+		name     string
+		cfg      Config
+		requests []request
+	}{
+		{
+			name:     "no limits",
+			cfg:      Config{},
+			requests: []request{{"u1", "v1", nil}, {"u1", "v2", nil}, {"u2", "v1", nil}},
+		},
+		{
+			name:     "overlapping requests of a stream",
+			cfg:      Config{MaxPerUser: 1, MaxTotal: 1},
+			requests: []request{{"u1", "v1", nil}, {"u1", "v1", nil}, {"u1", "v1", nil}},
+		},
+		{
+			name:     "user limit",
+			cfg:      Config{MaxPerUser: 1},
+			requests: []request{{"u1", "v1", nil}, {"u1", "v2", ErrUserLimit}, {"u2", "v2", nil}},
+		},
+		{
+			name:     "total limit",
+			cfg:      Config{MaxTotal: 2},
+			requests: []request{{"u1", "v1", nil}, {"u2", "v1", nil}, {"u3", "v1", ErrTotalLimit}, {"u1", "v1", nil}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var l = New(tt.cfg)
+			for idx, r := range tt.requests {
+				if _, err := l.Acquire(r.user, r.video); !errors.Is(err, r.wantErr) {
+					t.Errorf("request %d: Acquire(%s, %s) error = %v, want %v", idx, r.user, r.video, err, r.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterRelease(t *testing.T) {
+	var l = New(Config{MaxPerUser: 1})
+	first, err := l.Acquire("u1", "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := l.Acquire("u1", "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The slot is kept until the last request of the stream ends
+	first()
+	first()
+	if _, err := l.Acquire("u1", "v2"); !errors.Is(err, ErrUserLimit) {
+		t.Fatalf("Acquire() with an active stream error = %v, want %v", err, ErrUserLimit)
+	}
+	second()
+	if _, err := l.Acquire("u1", "v2"); err != nil {
+		t.Fatalf("Acquire() after the release error = %v", err)
+	}
+	if l.total != 1 {
+		t.Errorf("total = %d, want 1", l.total)
+	}
+}
@@ -0,0 +1,216 @@
+package thumbnail
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"full/libs/ffmpeg"
+	"full/libs/models"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultWidth    int    = 320
+	DefaultPosition string = "10%"
+
+	generateTimeout time.Duration = time.Minute
+	retryAfter      time.Duration = time.Minute * 10
+	queueSize       int           = 1024
+)
+
+//go:embed placeholder.svg
+var Placeholder []byte
+
+// Position is the point of the video where the frame is taken, either an
+// absolute offset or a fraction of the duration
+type Position struct {
+	Offset   time.Duration
+	Fraction float64
+}
+
+// ParsePosition accepts values like "10%" or "1m30s"
+func ParsePosition(value string) (Position, error) {
+	value = strings.TrimSpace(value)
+	if percent, ok := strings.CutSuffix(value, "%"); ok {
+		f, err := strconv.ParseFloat(percent, 64)
+		if err != nil || f < 0 || f > 100 {
+			return Position{}, fmt.Errorf("invalid thumbnail position `%s`", value)
+		}
+		return Position{Fraction: f / 100}, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return Position{}, fmt.Errorf("invalid thumbnail position `%s`", value)
+	}
+	return Position{Offset: d}, nil
+}
+
+func (p Position) At(duration time.Duration) time.Duration {
+	if p.Fraction > 0 && duration > 0 {
+		return time.Duration(float64(duration) * p.Fraction)
+	}
+	if duration > 0 && p.Offset >= duration {
+		return duration / 2
+	}
+	return p.Offset
+}
+
+type Generator struct {
+	dir      string
+	width    int
+	position Position
+
+	inflight map[string]chan struct{}
+	failed   map[string]time.Time
+	mut      sync.Mutex
+	queue    chan models.Video
+}
+
+func New(dir string, width int, position Position) (*Generator, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if width <= 0 {
+		width = DefaultWidth
+	}
+	g := &Generator{
+		dir:      dir,
+		width:    width,
+		position: position,
+		inflight: map[string]chan struct{}{},
+		failed:   map[string]time.Time{},
+		queue:    make(chan models.Video, queueSize),
+	}
+	go g.run()
+	return g, nil
+}
+
+func (g *Generator) Path(videoId string) string {
+	return filepath.Join(g.dir, videoId+".jpg")
+}
+
+func (g *Generator) Exists(videoId string) bool {
+	_, err := os.Stat(g.Path(videoId))
+	return err == nil
+}
+
+// Get returns the path of the thumbnail, generating it when it is not cached yet.
+// Concurrent requests for the same video wait for a single ffmpeg process
+func (g *Generator) Get(ctx context.Context, v *models.Video) (string, error) {
+	var out = g.Path(v.Id)
+	if _, err := os.Stat(out); err == nil {
+		return out, nil
+	}
+
+	g.mut.Lock()
+	if failedAt, ok := g.failed[v.Id]; ok && time.Since(failedAt) < retryAfter {
+		g.mut.Unlock()
+		return "", fmt.Errorf("thumbnail generation for video id=`%s` failed recently", v.Id)
+	}
+	wait, running := g.inflight[v.Id]
+	if !running {
+		wait = make(chan struct{})
+		g.inflight[v.Id] = wait
+	}
+	g.mut.Unlock()
+
+	if running {
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		if _, err := os.Stat(out); err != nil {
+			return "", fmt.Errorf("cannot generate thumbnail for video id=`%s`", v.Id)
+		}
+		return out, nil
+	}
+
+	defer func() {
+		g.mut.Lock()
+		delete(g.inflight, v.Id)
+		g.mut.Unlock()
+		close(wait)
+	}()
+
+	// The generation outlives the request, the file is useful for the next one anyway
+	genCtx, cancel := context.WithTimeout(context.Background(), generateTimeout)
+	defer cancel()
+	if err := g.generate(genCtx, v, out); err != nil {
+		g.mut.Lock()
+		g.failed[v.Id] = time.Now()
+		g.mut.Unlock()
+		return "", err
+	}
+	return out, nil
+}
+
+func (g *Generator) generate(ctx context.Context, v *models.Video, out string) error {
+	if _, err := os.Stat(v.FilePath); err != nil {
+		return err
+	}
+
+	var tmp = out + ".tmp.jpg"
+	defer os.Remove(tmp)
+
+	if err := ffmpeg.Run(ctx,
+		"-ss", ffmpeg.Timestamp(g.position.At(v.Duration)),
+		"-i", v.FilePath,
+		"-frames:v", "1",
+		"-vf", fmt.Sprintf("scale=%d:-2", g.width),
+		"-q:v", "3",
+		"-y", tmp,
+	); err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(tmp); err != nil {
+		return err
+	} else if info.Size() == 0 {
+		return errors.New("ffmpeg produced an empty thumbnail")
+	}
+	return os.Rename(tmp, out)
+}
+
+// Queue schedules the generation of the thumbnail in background
+func (g *Generator) Queue(v models.Video) {
+	if !v.Attributes.Exists || g.Exists(v.Id) {
+		return
+	}
+	select {
+	case g.queue <- v:
+	default:
+		log.Warn().Str("id", v.Id).Msg("Thumbnail queue is full")
+	}
+}
+
+// QueueMissing schedules the generation of every thumbnail not cached yet
+func (g *Generator) QueueMissing(videos []models.Video) {
+	for _, v := range videos {
+		g.Queue(v)
+	}
+}
+
+func (g *Generator) run() {
+	for v := range g.queue {
+		if _, err := g.Get(context.Background(), &v); err != nil {
+			log.Err(err).Str("id", v.Id).Str("file", v.FilePath).Msg("Cannot generate thumbnail")
+		}
+	}
+}
+
+// Remove deletes the cached thumbnail of the video
+func (g *Generator) Remove(videoId string) error {
+	if err := os.Remove(g.Path(videoId)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
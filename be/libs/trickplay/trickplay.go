@@ -0,0 +1,229 @@
+package trickplay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"full/libs/ffmpeg"
+	"full/libs/models"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultInterval time.Duration = time.Second * 10
+	DefaultWidth    int           = 160
+
+	// Every sprite sheet holds Columns x Rows frames
+	Columns int = 10
+	Rows    int = 10
+
+	VttName string = "thumbnails.vtt"
+
+	generateTimeout time.Duration = time.Minute * 30
+	retryAfter      time.Duration = time.Hour
+	queueSize       int           = 256
+)
+
+// Info describes the preview of a video as exposed in its info payload
+type Info struct {
+	Available bool          `json:"available"`
+	Pending   bool          `json:"pending,omitempty"`
+	Vtt       string        `json:"vtt,omitempty"`
+	Interval  time.Duration `json:"interval,omitempty"`
+}
+
+type Generator struct {
+	dir      string
+	interval time.Duration
+	width    int
+
+	inflight map[string]bool
+	failed   map[string]time.Time
+	mut      sync.Mutex
+	queue    chan models.Video
+}
+
+// New returns a generator taking a frame every interval, scaled to width pixels.
+// The sheets are generated one video at a time by a single background worker
+func New(dir string, interval time.Duration, width int) (*Generator, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if interval < time.Second {
+		interval = DefaultInterval
+	}
+	if width <= 0 {
+		width = DefaultWidth
+	}
+	g := &Generator{
+		dir:      dir,
+		interval: interval,
+		width:    width,
+		inflight: map[string]bool{},
+		failed:   map[string]time.Time{},
+		queue:    make(chan models.Video, queueSize),
+	}
+	go g.run()
+	return g, nil
+}
+
+// Dir returns the folder holding the sprite sheets and the vtt of the video
+func (g *Generator) Dir(videoId string) string {
+	return filepath.Join(g.dir, videoId)
+}
+
+// File returns the path of a generated file, name must be a single path element
+func (g *Generator) File(videoId string, name string) (string, error) {
+	if len(name) == 0 || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid preview file `%s`", name)
+	}
+	return filepath.Join(g.Dir(videoId), name), nil
+}
+
+func (g *Generator) Exists(videoId string) bool {
+	_, err := os.Stat(filepath.Join(g.Dir(videoId), VttName))
+	return err == nil
+}
+
+// Info reports the availability of the preview, vttUrl is the public url of the vtt file
+func (g *Generator) Info(v *models.Video, vttUrl string) Info {
+	if g.Exists(v.Id) {
+		return Info{Available: true, Vtt: vttUrl, Interval: g.interval}
+	}
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	return Info{Pending: g.inflight[v.Id]}
+}
+
+// Queue schedules the generation of the preview in background, it returns
+// false when the preview cannot be generated right now
+func (g *Generator) Queue(v models.Video) bool {
+	if !v.Attributes.Exists || v.Duration <= 0 || g.Exists(v.Id) {
+		return false
+	}
+
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	if g.inflight[v.Id] {
+		return true
+	}
+	if failedAt, ok := g.failed[v.Id]; ok && time.Since(failedAt) < retryAfter {
+		return false
+	}
+	select {
+	case g.queue <- v:
+		g.inflight[v.Id] = true
+		return true
+	default:
+		log.Warn().Str("id", v.Id).Msg("Preview queue is full")
+		return false
+	}
+}
+
+func (g *Generator) run() {
+	for v := range g.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), generateTimeout)
+		var started = time.Now()
+		err := g.generate(ctx, &v)
+		cancel()
+
+		g.mut.Lock()
+		delete(g.inflight, v.Id)
+		if err != nil {
+			g.failed[v.Id] = time.Now()
+		}
+		g.mut.Unlock()
+
+		if err != nil {
+			log.Err(err).Str("id", v.Id).Str("file", v.FilePath).Msg("Cannot generate preview")
+			continue
+		}
+		log.Info().Str("id", v.Id).Dur("elapsed", time.Since(started)).Msg("Generated preview")
+	}
+}
+
+// frameSize returns the size of a single frame keeping the aspect ratio of the video
+func (g *Generator) frameSize(v *models.Video) (int, int) {
+	var height = g.width * 9 / 16
+	if s := v.MainVideoStream(); s != nil && s.Width > 0 && s.Height > 0 {
+		height = int(math.Round(float64(g.width) * float64(s.Height) / float64(s.Width)))
+	}
+	// ffmpeg needs even sizes
+	return g.width, max(2, height-height%2)
+}
+
+func (g *Generator) generate(ctx context.Context, v *models.Video) error {
+	if _, err := os.Stat(v.FilePath); err != nil {
+		return err
+	}
+
+	// Everything is written in a temporary folder and moved at the end,
+	// so a half generated preview is never served
+	tmp, err := os.MkdirTemp(g.dir, ".tmp-"+v.Id+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	var width, height = g.frameSize(v)
+	if err := ffmpeg.Run(ctx,
+		"-skip_frame", "nokey",
+		"-i", v.FilePath,
+		"-an", "-sn",
+		"-vf", fmt.Sprintf("fps=1/%g,scale=%d:%d,tile=%dx%d", g.interval.Seconds(), width, height, Columns, Rows),
+		"-q:v", "5",
+		filepath.Join(tmp, "%d.jpg"),
+	); err != nil {
+		return err
+	}
+
+	var frames = int(math.Ceil(v.Duration.Seconds() / g.interval.Seconds()))
+	if err := os.WriteFile(filepath.Join(tmp, VttName), buildVtt(v.Duration, g.interval, frames, width, height), 0o644); err != nil {
+		return err
+	}
+
+	var out = g.Dir(v.Id)
+	if err := os.RemoveAll(out); err != nil {
+		return err
+	}
+	return os.Rename(tmp, out)
+}
+
+// buildVtt maps every interval of the video to its frame inside the sprite
+// sheets, the sheets are numbered from 1 like the ffmpeg output
+func buildVtt(duration time.Duration, interval time.Duration, frames int, width int, height int) []byte {
+	var sb strings.Builder
+	sb.WriteString("WEBVTT\n")
+
+	var perSheet = Columns * Rows
+	for i := range frames {
+		var start = interval * time.Duration(i)
+		var end = min(start+interval, duration)
+		var pos = i % perSheet
+		fmt.Fprintf(&sb, "\n%s --> %s\n%d.jpg#xywh=%d,%d,%d,%d\n",
+			vttTimestamp(start), vttTimestamp(end),
+			i/perSheet+1,
+			(pos%Columns)*width, (pos/Columns)*height, width, height,
+		)
+	}
+	return []byte(sb.String())
+}
+
+func vttTimestamp(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60, d.Milliseconds()%1000)
+}
+
+// Remove deletes the cached preview of the video
+func (g *Generator) Remove(videoId string) error {
+	if err := os.RemoveAll(g.Dir(videoId)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
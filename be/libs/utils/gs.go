@@ -26,3 +26,18 @@ func NewGetterSetter[T any](initialData T) *GS[T] {
 	data.Setter <- initialData
 	return data
 }
+
+// Get returns the current data, the readers must use it instead of Getter
+func (gs *GS[T]) Get() T {
+	gs.mut.Lock()
+	defer gs.mut.Unlock()
+	return gs.Getter
+}
+
+// Update replaces the current data with the value returned by fn while holding the lock.
+// The readers may still be using current, fn must return a copy instead of changing it
+func (gs *GS[T]) Update(fn func(current T) T) {
+	gs.mut.Lock()
+	gs.Getter = fn(gs.Getter)
+	gs.mut.Unlock()
+}
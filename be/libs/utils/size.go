@@ -0,0 +1,26 @@
+package utils
+
+import "fmt"
+
+// FormatSize returns a human readable size like 1.50GB
+func FormatSize(bytes int64) string {
+	const (
+		KB = 1 << 10
+		MB = 1 << 20
+		GB = 1 << 30
+		TB = 1 << 40
+	)
+
+	switch {
+	case bytes >= TB:
+		return fmt.Sprintf("%.2fTB", float64(bytes)/TB)
+	case bytes >= GB:
+		return fmt.Sprintf("%.2fGB", float64(bytes)/GB)
+	case bytes >= MB:
+		return fmt.Sprintf("%.2fMB", float64(bytes)/MB)
+	case bytes >= KB:
+		return fmt.Sprintf("%.2fKB", float64(bytes)/KB)
+	default:
+		return fmt.Sprintf("%dB", bytes)
+	}
+}
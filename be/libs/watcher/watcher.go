@@ -0,0 +1,406 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"full/libs/media"
+	"full/libs/models"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+const DefaultDebounce time.Duration = time.Second * 3
+
+type Watcher struct {
+	conn     *gorm.DB
+	fsw      *fsnotify.Watcher
+	debounce time.Duration
+	folders  map[string]models.Folder
+	timers   map[string]*time.Timer
+	mut      sync.Mutex
+
+	// OnVideo is called every time a video is created, updated or marked as missing
+	OnVideo func(v models.Video)
+}
+
+func New(conn *gorm.DB, debounce time.Duration) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if debounce <= 0 {
+		debounce = DefaultDebounce
+	}
+	return &Watcher{
+		conn:     conn,
+		fsw:      fsw,
+		debounce: debounce,
+		folders:  map[string]models.Folder{},
+		timers:   map[string]*time.Timer{},
+	}, nil
+}
+
+// Sync adds a watch for every registered folder not watched yet and
+// removes the watches of the folders deleted from the database
+func (w *Watcher) Sync() error {
+	folders, err := models.LoadFolders(w.conn)
+	if err != nil {
+		return err
+	}
+
+	w.mut.Lock()
+	defer w.mut.Unlock()
+
+	var current = map[string]bool{}
+	for _, f := range folders {
+		current[f.Path] = true
+		f.AddOrigin()
+		if old, ok := w.folders[f.Path]; ok {
+			w.folders[f.Path] = f
+			if !reflect.DeepEqual(old.Rules, f.Rules) {
+				// Folders allowed by the new rules are not watched yet
+				w.addRecursive(f, f.Path)
+			}
+			continue
+		}
+		w.folders[f.Path] = f
+		w.addRecursive(f, f.Path)
+		log.Info().Str("path", f.Path).Msg("Watching folder")
+	}
+
+	for p := range w.folders {
+		if current[p] {
+			continue
+		}
+		delete(w.folders, p)
+		for _, watched := range w.fsw.WatchList() {
+			if watched == p || strings.HasPrefix(watched, p+string(filepath.Separator)) {
+				w.fsw.Remove(watched)
+			}
+		}
+		log.Info().Str("path", p).Msg("Stopped watching folder")
+	}
+	return nil
+}
+
+// addRecursive watches dir and its sub folders allowed by the rules of root
+func (w *Watcher) addRecursive(root models.Folder, dir string) {
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Err(err).Str("path", p).Send()
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if !root.Allows(p, true) {
+			return filepath.SkipDir
+		}
+		if err := w.fsw.Add(p); err != nil {
+			log.Err(err).Str("path", p).Msg("Cannot watch folder")
+		}
+		return nil
+	})
+	if err != nil {
+		log.Err(err).Send()
+	}
+}
+
+func (w *Watcher) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			w.Close()
+			return
+		case evt, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			w.schedule(evt.Name)
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			log.Err(err).Msg("Watcher error")
+		}
+	}
+}
+
+func (w *Watcher) Close() error {
+	w.mut.Lock()
+	for p, t := range w.timers {
+		t.Stop()
+		delete(w.timers, p)
+	}
+	w.mut.Unlock()
+	return w.fsw.Close()
+}
+
+// schedule delays the handling of a path until no other event has been
+// received for it within the debounce window, this way a large copy
+// produces a single update
+func (w *Watcher) schedule(p string) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+
+	if t, ok := w.timers[p]; ok {
+		t.Reset(w.debounce)
+		return
+	}
+	w.timers[p] = time.AfterFunc(w.debounce, func() {
+		w.mut.Lock()
+		delete(w.timers, p)
+		w.mut.Unlock()
+		w.handle(p)
+	})
+}
+
+func (w *Watcher) rootOf(p string) (models.Folder, bool) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+
+	var found models.Folder
+	var ok bool
+	for _, f := range w.folders {
+		if f.Contains(p) && len(f.Path) > len(found.Path) {
+			found, ok = f, true
+		}
+	}
+	return found, ok
+}
+
+func (w *Watcher) handle(p string) {
+	root, ok := w.rootOf(p)
+	if !ok {
+		return
+	}
+
+	if models.IsSubtitle(p) {
+		w.subtitleChanged(p)
+		return
+	}
+
+	info, err := os.Stat(p)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Err(err).Str("path", p).Send()
+			return
+		}
+		w.removed(p)
+		return
+	}
+
+	if !root.Allows(p, info.IsDir()) {
+		return
+	}
+
+	if info.IsDir() {
+		w.addRecursive(root, p)
+		var sub = root.Sub(p)
+		for _, v := range sub.GetVideos() {
+			w.videoChanged(v)
+		}
+		for _, pic := range sub.GetPictures() {
+			w.pictureChanged(pic)
+		}
+		return
+	}
+
+	switch t, ok := media.Detect(p); {
+	case !ok:
+		return
+	case t.Kind == media.KindVideo:
+		v, err := models.NewVideo(p, root.Sub(filepath.Dir(p)))
+		if err != nil {
+			log.Err(err).Str("path", p).Send()
+			return
+		}
+		w.videoChanged(v)
+	case t.Kind == media.KindPicture:
+		var pic = models.NewPicture(p)
+		pic.Folder = root.Sub(filepath.Dir(p))
+		w.pictureChanged(&pic)
+	}
+}
+
+func (w *Watcher) videoChanged(v *models.Video) {
+	var res []models.Video
+	if tx := w.conn.Find(&res, models.Video{Id: v.Id}); tx.Error != nil {
+		log.Err(tx.Error).Send()
+		return
+	}
+
+	if len(res) == 0 {
+		// Relinked videos keep their original id
+		if tx := w.conn.Where("file_path = ? AND size = ? AND attr_exists = ?", v.FilePath, v.Size, true).Find(&res); tx.Error != nil {
+			log.Err(tx.Error).Send()
+			return
+		}
+	}
+
+	switch {
+	case len(res) == 0:
+		if err := v.GenerateFingerprint(); err != nil {
+			log.Err(err).Str("file", v.FilePath).Msg("Cannot fingerprint video")
+		}
+		// The duration matches the missing rows stored without a fingerprint
+		if err := v.GetDuration(); err != nil {
+			log.Err(err).Str("file", v.FilePath).Str("id", v.Id).Send()
+		}
+		// The source of a move may still be waiting for its debounce
+		w.flushRemoved()
+		m, err := v.FindMissing(w.conn)
+		if err != nil {
+			log.Err(err).Send()
+			return
+		}
+		if m != nil {
+			if err := m.Relink(w.conn, v); err != nil {
+				log.Err(err).Send()
+				return
+			}
+			v = m
+			break
+		}
+
+		if tx := w.conn.Create(v); tx.Error != nil {
+			log.Err(tx.Error).Send()
+			return
+		}
+		log.Info().Str("id", v.Id).Str("title", v.Title).Msg("Created")
+	case !res[0].Attributes.Exists:
+		v = &res[0]
+		v.Attributes.Exists = true
+		if tx := w.conn.Model(v).UpdateColumns(map[string]any{"attr_exists": true}); tx.Error != nil {
+			log.Err(tx.Error).Send()
+			return
+		}
+		log.Info().Str("id", v.Id).Msg("Updated video exist flag")
+	default:
+		return
+	}
+	w.notify(*v)
+
+	// A rewritten file gets a new id, the previous rows for the same path are stale
+	var stale []models.Video
+	if tx := w.conn.Where("file_path = ? AND id <> ? AND attr_exists = ?", v.FilePath, v.Id, true).Find(&stale); tx.Error != nil {
+		log.Err(tx.Error).Send()
+		return
+	}
+	for _, s := range stale {
+		w.markMissing(s)
+	}
+}
+
+// subtitleChanged updates the subtitles of the videos the file may belong to,
+// the ones in its folder and the ones above a Subs folder
+func (w *Watcher) subtitleChanged(p string) {
+	var dirs = []string{filepath.Dir(p), filepath.Dir(filepath.Dir(p)), filepath.Dir(filepath.Dir(filepath.Dir(p)))}
+
+	var vids []models.Video
+	if tx := w.conn.Where("folder_path IN ? AND attr_exists = ?", dirs, true).Find(&vids); tx.Error != nil {
+		log.Err(tx.Error).Send()
+		return
+	}
+	for _, v := range vids {
+		changed, err := v.SyncSubtitles(w.conn)
+		if err != nil {
+			log.Err(err).Str("id", v.Id).Msg("Cannot update subtitles")
+			continue
+		}
+		if changed {
+			log.Info().Str("id", v.Id).Int("subtitles", len(v.Subtitles)).Msg("Updated subtitles")
+			w.notify(v)
+		}
+	}
+}
+
+func (w *Watcher) pictureChanged(p *models.Picture) {
+	var res []models.Picture
+	if tx := w.conn.Find(&res, models.Picture{Id: p.Id}); tx.Error != nil {
+		log.Err(tx.Error).Send()
+		return
+	}
+	if len(res) == 0 {
+		if tx := w.conn.Create(p); tx.Error != nil {
+			log.Err(tx.Error).Send()
+		}
+		return
+	}
+	if tx := w.conn.Model(&res[0]).UpdateColumns(map[string]any{"size": p.Size}); tx.Error != nil {
+		log.Err(tx.Error).Send()
+	}
+}
+
+// flushRemoved handles right away the pending paths that do not exist anymore
+func (w *Watcher) flushRemoved() {
+	var gone []string
+	w.mut.Lock()
+	for p, t := range w.timers {
+		if _, err := os.Lstat(p); errors.Is(err, os.ErrNotExist) && t.Stop() {
+			delete(w.timers, p)
+			gone = append(gone, p)
+		}
+	}
+	w.mut.Unlock()
+
+	for _, p := range gone {
+		w.removed(p)
+	}
+}
+
+// removed handles a path that disappeared from disk, it may be a single
+// file or a whole folder
+func (w *Watcher) removed(p string) {
+	var prefix = p + string(filepath.Separator)
+
+	var vids []models.Video
+	if tx := w.conn.Where("(file_path = ? OR substr(file_path, 1, ?) = ?) AND attr_exists = ?", p, utf8.RuneCountInString(prefix), prefix, true).Find(&vids); tx.Error != nil {
+		log.Err(tx.Error).Send()
+	}
+	for _, v := range vids {
+		w.markMissing(v)
+	}
+
+	// One by one, the hook needs the id to remove the tags
+	var pics []models.Picture
+	if tx := w.conn.Where("file_path = ? OR substr(file_path, 1, ?) = ?", p, utf8.RuneCountInString(prefix), prefix).Find(&pics); tx.Error != nil {
+		log.Err(tx.Error).Send()
+	}
+	for _, pic := range pics {
+		if tx := w.conn.Delete(&pic); tx.Error != nil {
+			log.Err(tx.Error).Send()
+		}
+	}
+	if len(pics) > 0 {
+		if err := models.PruneTags(w.conn); err != nil {
+			log.Err(err).Send()
+		}
+	}
+}
+
+func (w *Watcher) markMissing(v models.Video) {
+	v.Attributes.Exists = false
+	if tx := w.conn.Model(&v).UpdateColumns(map[string]any{"attr_exists": false}); tx.Error != nil {
+		log.Err(tx.Error).Send()
+		return
+	}
+	log.Info().Str("id", v.Id).Str("file", v.FilePath).Msg("Video marked as missing")
+	w.notify(v)
+}
+
+func (w *Watcher) notify(v models.Video) {
+	if w.OnVideo != nil {
+		w.OnVideo(v)
+	}
+}
@@ -39,9 +39,134 @@ export type ApiVideo = {
         exists: boolean;
         watched: boolean;
     },
+    streams?: ApiVideoStream[];
+    // Progress of the logged user, missing when the video was never watched
+    progress?: ApiWatchProgress;
+    tags?: ApiTag[];
     customUrl?: string;
 }
 
+export type ApiTag = {
+    id: string;
+    name: string;
+}
+
+// Tag cloud entry, only the videos and the pictures the user can access are counted
+export type ApiTagCount = ApiTag & {
+    videos: number;
+    pictures: number;
+    count: number;
+}
+
+// position and watched are seconds
+export type ApiWatchProgress = {
+    videoId: string;
+    position: number;
+    watched: number;
+    completed: boolean;
+    lastWatched: string;
+}
+
+// A playback session, the positions are seconds
+export type ApiHistoryEntry = {
+    id: number;
+    videoId: string;
+    startPosition: number;
+    endPosition: number;
+    startedAt: string;
+    endedAt: string;
+    client?: string;
+    video?: ApiVideo;
+}
+
+export type ApiPlaylistEntry = {
+    id: number;
+    videoId: string;
+    position: number;
+    // Missing when the user cannot access the video
+    video?: ApiVideo;
+}
+
+export type ApiPlaylist = {
+    id: string;
+    ownerId: string;
+    name: string;
+    description?: string;
+    visibility: 'private' | 'shared';
+    createdAt: string;
+    updatedAt: string;
+    entries: ApiPlaylistEntry[];
+}
+
+export type ApiHistoryPage = {
+    entries: ApiHistoryEntry[];
+    offset: number;
+    limit: number;
+    total: number;
+}
+
+export type ApiVideoStream = {
+    id: string;
+    index: number;
+    type: 'video' | 'audio' | 'subtitle';
+    codec: string;
+    profile?: string;
+    width?: number;
+    height?: number;
+    frameRate?: number;
+    bitRate?: number;
+    channels?: number;
+    channelLayout?: string;
+    language?: string;
+    default: boolean;
+    forced: boolean;
+    hearingImpaired?: boolean;
+}
+
+export type ApiVideoInfo = ApiVideo & {
+    preview?: {
+        available: boolean;
+        pending?: boolean;
+        vtt?: string;
+        interval?: number;
+    };
+    hls?: string;
+    playback?: ApiPlaybackPlan;
+    subtitles?: ApiSubtitle[];
+}
+
+export type ApiSubtitle = {
+    id: string;
+    source: 'sidecar' | 'embedded';
+    format: string;
+    language?: string;
+    label: string;
+    default: boolean;
+    forced: boolean;
+    hearingImpaired: boolean;
+    // Image based streams like PGS cannot be shown and have no url
+    supported: boolean;
+    url?: string;
+}
+
+// Stream urls usable without the session cookie, like by a cast device
+export type ApiSignedUrls = {
+    expiresAt: string;
+    query: string;
+    stream: string;
+    hls?: string;
+    subtitles?: ApiSubtitle[];
+}
+
+export type ApiPlaybackPlan = {
+    method: "direct" | "remux" | "transcode";
+    url: string;
+    reason: string;
+    container?: string;
+    videoCodec?: string;
+    audioCodec?: string;
+}
+
 export type ApiPicture = {
     id: string;
     filePath: string;
@@ -51,10 +176,11 @@ export type ApiPicture = {
         id: string;
         path: string;
     }
+    tags?: ApiTag[];
 }
 
 export type ApiPage = {
     id: string;
     title: string;
     url: string;
-}
\ No newline at end of file
+}
\ No newline at end of file